@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// awsDefaultEndpoint is used for AWS profiles without "endpoint_url"
+	awsDefaultEndpoint = "s3.amazonaws.com"
+)
+
+// awsProfile contains the settings of a profile in the shared config files of the AWS CLI.
+type awsProfile struct {
+	Name            string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+	EndpointURL     string
+	// RoleARN is assumed with the credentials of SourceProfile or the token in WebIdentityTokenFile.
+	RoleARN              string
+	SourceProfile        string
+	WebIdentityTokenFile string
+	RoleSessionName      string
+	DurationSeconds      string
+	ExternalID           string
+}
+
+// assumeRole returns the role configuration of a profile or nil if it does not assume a role.
+func (p awsProfile) assumeRole() *assumeRole {
+	if len(p.RoleARN) == 0 {
+		return nil
+	}
+	cfg := &assumeRole{RoleARN: p.RoleARN, SessionName: p.RoleSessionName, ExternalID: p.ExternalID, WebIdentityTokenFile: p.WebIdentityTokenFile}
+	if len(p.DurationSeconds) > 0 {
+		cfg.Duration = p.DurationSeconds + "s"
+	}
+	return cfg
+}
+
+// awsConfigFiles returns the shared credentials and config file, which can be moved by the same environment variables as for the AWS CLI.
+func awsConfigFiles() (string, string, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", "", err
+	}
+	credentialsFile := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if len(credentialsFile) == 0 {
+		credentialsFile = path.Join(usr.HomeDir, ".aws", "credentials")
+	}
+	configFile := os.Getenv("AWS_CONFIG_FILE")
+	if len(configFile) == 0 {
+		configFile = path.Join(usr.HomeDir, ".aws", "config")
+	}
+	return credentialsFile, configFile, nil
+}
+
+// readINI parses an AWS config file into sections of key-value pairs. Indented keys below an empty value like "s3 =" are prefixed with its key and a dot. A missing file is treated as empty.
+func readINI(filePath string) (map[string]map[string]string, error) {
+	sections := make(map[string]map[string]string)
+	f, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return sections, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var section map[string]string
+	parent := ""
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			name := strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			if sections[name] == nil {
+				sections[name] = make(map[string]string)
+			}
+			section, parent = sections[name], ""
+			continue
+		}
+
+		pos := strings.Index(trimmed, "=")
+		if section == nil || pos < 0 {
+			return nil, fmt.Errorf("malformed line %d in %q", lineNo, filePath)
+		}
+		key, value := strings.ToLower(strings.TrimSpace(trimmed[:pos])), strings.TrimSpace(trimmed[pos+1:])
+		if indented := line[0] == ' ' || line[0] == '\t'; indented && len(parent) > 0 {
+			section[parent+"."+key] = value
+			continue
+		}
+		section[key] = value
+		parent = ""
+		if len(value) == 0 {
+			parent = key
+		}
+	}
+	return sections, scanner.Err()
+}
+
+// awsProfileName returns the given profile name, or the one selected by AWS_PROFILE, or "default".
+func awsProfileName(name string) string {
+	if len(name) > 0 {
+		return name
+	}
+	if name := os.Getenv("AWS_PROFILE"); len(name) > 0 {
+		return name
+	}
+	return "default"
+}
+
+// loadAWSProfile reads a profile from the shared credentials and config files. The credentials file takes precedence. Profiles assuming a role get the credentials of their source profile.
+func loadAWSProfile(name string) (awsProfile, error) {
+	profile, err := readAWSProfile(awsProfileName(name))
+	if err != nil {
+		return awsProfile{}, err
+	}
+	if len(profile.RoleARN) > 0 && len(profile.SourceProfile) > 0 && len(profile.WebIdentityTokenFile) == 0 {
+		source, err := readAWSProfile(profile.SourceProfile)
+		if err != nil {
+			return awsProfile{}, fmt.Errorf("source profile of AWS profile %q: %s", profile.Name, err.Error())
+		}
+		profile.AccessKeyID, profile.SecretAccessKey, profile.SessionToken = source.AccessKeyID, source.SecretAccessKey, source.SessionToken
+	}
+	return profile, nil
+}
+
+func readAWSProfile(name string) (awsProfile, error) {
+	credentialsFile, configFile, err := awsConfigFiles()
+	if err != nil {
+		return awsProfile{}, err
+	}
+	credentials, err := readINI(credentialsFile)
+	if err != nil {
+		return awsProfile{}, err
+	}
+	config, err := readINI(configFile)
+	if err != nil {
+		return awsProfile{}, err
+	}
+
+	// profiles in the config file are named "profile {name}" except for the default profile
+	configSection, ok := config["profile "+name]
+	if !ok {
+		configSection, ok = config[name]
+	}
+	credentialsSection, hasCredentials := credentials[name]
+	if !ok && !hasCredentials {
+		return awsProfile{}, fmt.Errorf("AWS profile %q does not exist", name)
+	}
+
+	get := func(key string) string {
+		if value, ok := credentialsSection[key]; ok {
+			return value
+		}
+		return configSection[key]
+	}
+	profile := awsProfile{
+		Name:            name,
+		AccessKeyID:     get("aws_access_key_id"),
+		SecretAccessKey: get("aws_secret_access_key"),
+		SessionToken:    get("aws_session_token"),
+		Region:          get("region"),
+		EndpointURL:     get("s3.endpoint_url"),
+
+		RoleARN:              get("role_arn"),
+		SourceProfile:        get("source_profile"),
+		WebIdentityTokenFile: get("web_identity_token_file"),
+		RoleSessionName:      get("role_session_name"),
+		DurationSeconds:      get("duration_seconds"),
+		ExternalID:           get("external_id"),
+	}
+	if len(profile.EndpointURL) == 0 {
+		profile.EndpointURL = get("endpoint_url")
+	}
+	return profile, nil
+}
+
+// listAWSProfiles returns the sorted names of all profiles in the shared credentials and config files.
+func listAWSProfiles() ([]string, error) {
+	credentialsFile, configFile, err := awsConfigFiles()
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := readINI(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	config, err := readINI(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for name := range credentials {
+		names[name] = true
+	}
+	for name := range config {
+		if strings.HasPrefix(name, "profile ") {
+			names[strings.TrimSpace(name[len("profile "):])] = true
+		} else if name == "default" {
+			names[name] = true
+		}
+	}
+
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// applyCredentialChain completes a target with the credentials of the first source in the order command line flags, AWS environment variables, s3client environment and AWS profile. Endpoint and region are only taken from later sources if the target has none. fromFlags is set for targets given on the command line, whose credentials are never replaced.
+func applyCredentialChain(target *S3Target, profileName string, fromFlags bool) error {
+	if !fromFlags || len(target.AccessKey) == 0 {
+		if accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); len(accessKey) > 0 && len(secretKey) > 0 {
+			if len(target.SourceFile) > 0 && target.AccessKey != accessKey {
+				printlnf("Using the credentials of AWS_ACCESS_KEY_ID instead of environment %q", target.Key)
+			}
+			target.AccessKey, target.SecretKey, target.EncryptedSecrets = accessKey, secretKey, nil
+			target.SessionToken, target.SessionExpiration = os.Getenv("AWS_SESSION_TOKEN"), nil
+			// set by tools like aws-vault that export temporary credentials
+			for _, name := range []string{"AWS_CREDENTIAL_EXPIRATION", "AWS_SESSION_EXPIRATION"} {
+				if expiration, err := time.Parse(time.RFC3339, os.Getenv(name)); err == nil {
+					target.SessionExpiration = &expiration
+					break
+				}
+			}
+		}
+	}
+	if !target.hasCredentials() && target.AssumeRole == nil {
+		// web identities of Kubernetes service accounts
+		if roleARN, tokenFile := os.Getenv("AWS_ROLE_ARN"), os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"); len(roleARN) > 0 && len(tokenFile) > 0 {
+			target.AssumeRole = &assumeRole{RoleARN: roleARN, SessionName: os.Getenv("AWS_ROLE_SESSION_NAME"), WebIdentityTokenFile: tokenFile}
+		}
+	}
+	if len(target.Endpoint) == 0 {
+		for _, name := range []string{"AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"} {
+			if url := os.Getenv(name); len(url) > 0 {
+				target.Endpoint, target.Secure = splitEndpointURL(url)
+				break
+			}
+		}
+	}
+	if len(target.Region) == 0 {
+		target.Region = os.Getenv("AWS_REGION")
+		if len(target.Region) == 0 {
+			target.Region = os.Getenv("AWS_DEFAULT_REGION")
+		}
+	}
+
+	// the profile is only read if selected explicitly or required
+	if len(profileName) > 0 || !target.hasCredentials() || len(target.Endpoint) == 0 {
+		profile, err := loadAWSProfile(profileName)
+		if err != nil && len(profileName) > 0 {
+			return err
+		}
+		if err == nil {
+			if !target.hasCredentials() {
+				target.AccessKey, target.SecretKey, target.SessionToken = profile.AccessKeyID, profile.SecretAccessKey, profile.SessionToken
+				if target.AssumeRole == nil {
+					target.AssumeRole = profile.assumeRole()
+				}
+			}
+			if len(target.Endpoint) == 0 && len(profile.EndpointURL) > 0 {
+				target.Endpoint, target.Secure = splitEndpointURL(profile.EndpointURL)
+			}
+			if len(target.Region) == 0 {
+				target.Region = profile.Region
+			}
+		}
+	}
+
+	if len(target.Endpoint) == 0 {
+		target.Endpoint, target.Secure = awsDefaultEndpoint, true
+	}
+	return nil
+}
+
+// splitEndpointURL returns host and scheme of an endpoint URL. URLs without scheme are secure.
+func splitEndpointURL(url string) (string, bool) {
+	endpoint, secure, ok := splitScheme(strings.TrimSuffix(url, "/"))
+	if !ok {
+		secure = true
+	}
+	return endpoint, secure
+}
+
+// ambientTarget returns a target without s3client environment if a profile is given, AWS_ACCESS_KEY_ID, AWS_WEB_IDENTITY_TOKEN_FILE or AWS_PROFILE is set, or no s3client environment exists yet but a default AWS profile.
+func ambientTarget(profileName string) (S3Target, bool, error) {
+	key := awsProfileName(profileName)
+	if len(profileName) == 0 && len(os.Getenv("AWS_PROFILE")) == 0 {
+		if len(os.Getenv("AWS_ACCESS_KEY_ID")) > 0 || len(os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")) > 0 {
+			key = "aws"
+		} else if environments, err := getEnvironments(); err != nil || len(environments) > 0 {
+			return S3Target{}, false, err
+		} else if _, err := loadAWSProfile(""); err != nil {
+			return S3Target{}, false, nil
+		}
+	}
+
+	target := S3Target{Key: key}
+	if err := applyCredentialChain(&target, profileName, false); err != nil {
+		return S3Target{}, false, err
+	}
+	if !target.hasCredentials() {
+		if len(profileName) > 0 {
+			return S3Target{}, false, fmt.Errorf("AWS profile %q has no static credentials", key)
+		}
+		// profiles selected by AWS_PROFILE might be meant for other tools only
+		return S3Target{}, false, nil
+	}
+	return target, true, nil
+}
+
+// importAWSProfiles converts the given or all AWS profiles into s3client environments of the same name. Existing environments are only replaced with force.
+func importAWSProfiles(names []string, force bool) error {
+	if len(names) == 0 {
+		var err error
+		if names, err = listAWSProfiles(); err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("no AWS profiles found")
+		}
+	}
+	configDir, err := getConfigDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		return err
+	}
+	masterMode := isMasterMode()
+
+	count := 0
+	for _, name := range names {
+		profile, err := loadAWSProfile(name)
+		if err != nil {
+			printlnf("  skip profile %q: %s", name, err.Error())
+			continue
+		}
+		if err := checkEnvKey(name); err != nil {
+			printlnf("  skip profile %q: %s", name, err.Error())
+			continue
+		}
+		role := profile.assumeRole()
+		if (len(profile.AccessKeyID) == 0 || len(profile.SecretAccessKey) == 0) && (role == nil || len(role.WebIdentityTokenFile) == 0) {
+			printlnf("  skip profile %q: no static credentials", name)
+			continue
+		}
+		if _, err := loadEnv(name); err == nil && !force {
+			printlnf("  skip profile %q: environment already exists. Use \"--force\" to replace it", name)
+			continue
+		}
+
+		target := S3Target{Key: name, Endpoint: awsDefaultEndpoint, Secure: true, AccessKey: profile.AccessKeyID, SecretKey: profile.SecretAccessKey, SessionToken: profile.SessionToken, AssumeRole: role, Region: profile.Region, SourceFile: path.Join(configDir, name+".json")}
+		if len(profile.EndpointURL) > 0 {
+			target.Endpoint, target.Secure = splitEndpointURL(profile.EndpointURL)
+		}
+		if masterMode {
+			target.EncryptedSecrets = &encryptedSecrets{}
+		}
+		if err := writeEnv(target); err != nil {
+			return err
+		}
+		printlnf("  imported profile %q  ->  %s", name, endpointURL(target))
+		count++
+	}
+
+	if count == 1 {
+		printlnf("Imported 1 AWS profile")
+	} else {
+		printlnf("Imported %d AWS profiles", count)
+	}
+	return nil
+}
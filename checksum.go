@@ -0,0 +1,498 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/encrypt"
+	"github.com/sbreitf1/fs"
+)
+
+const (
+	// optional checksums of the content are stored as user metadata, because minio-go does not support the checksum headers of S3
+	metaChecksumSHA256 = "X-Amz-Meta-S3client-Sha256"
+	metaChecksumCRC32C = "X-Amz-Meta-S3client-Crc32c"
+	// metaPartSize records the part size of multipart uploads to compute their ETag
+	metaPartSize = "X-Amz-Meta-S3client-Part-Size"
+)
+
+var (
+	etagPattern = regexp.MustCompile(`^([0-9a-f]{32})(-([0-9]+))?$`)
+	// checksumHeaders maps the names of the optional checksums to their metadata
+	checksumHeaders = map[string]string{"sha256": metaChecksumSHA256, "crc32c": metaChecksumCRC32C}
+)
+
+// getChecksumAlgorithms returns the checksums stored with uploads from "--checksum-algorithm" or the default of the environment.
+func getChecksumAlgorithms(s *Session, flags map[string]string) ([]string, error) {
+	str, ok := flags["--checksum-algorithm"]
+	if !ok {
+		str = s.Target.ChecksumAlgorithm
+	}
+
+	algorithms := make([]string, 0)
+	for _, name := range strings.Split(str, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if len(name) == 0 || name == "none" {
+			continue
+		}
+		if _, ok := checksumHeaders[name]; !ok {
+			return nil, fmt.Errorf("unknown checksum algorithm %q. Possible algorithms are \"sha256\", \"crc32c\" and \"none\"", name)
+		}
+		algorithms = append(algorithms, name)
+	}
+	return algorithms, nil
+}
+
+func newChecksum(header string) hash.Hash {
+	if header == metaChecksumCRC32C {
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	}
+	return sha256.New()
+}
+
+// fileChecksums returns the metadata with the given checksums of a local file.
+func fileChecksums(filePath string, algorithms []string) (map[string]string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hashes := make(map[string]hash.Hash)
+	writers := make([]io.Writer, 0, len(algorithms))
+	for _, name := range algorithms {
+		header := checksumHeaders[name]
+		hashes[header] = newChecksum(header)
+		writers = append(writers, hashes[header])
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return nil, err
+	}
+
+	metadata := make(map[string]string)
+	for header, h := range hashes {
+		metadata[header] = hex.EncodeToString(h.Sum(nil))
+	}
+	return metadata, nil
+}
+
+// hasMD5ETag returns true if objects written with the given server-side encryption get the MD5 of their content as ETag. SSE-KMS and SSE-C ETags are opaque.
+func hasMD5ETag(sse encrypt.ServerSide) bool {
+	return sse == nil || sse.Type() == encrypt.S3
+}
+
+// verifyUpload compares the ETag of an uploaded single-part object with the MD5 of the content sent. The encryption reported by the store decides, because default bucket encryption applies to uploads without SSE headers.
+func verifyUpload(s *Session, bucket, key string, sum []byte, opts minio.PutObjectOptions) error {
+	if !hasMD5ETag(opts.ServerSideEncryption) {
+		return nil
+	}
+	info, err := s.Store.StatObject(bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return err
+	}
+	if name := encryptionName(info.Metadata); name != "" && name != "SSE-S3" {
+		return nil
+	}
+	if etag, expected := strings.Trim(info.ETag, "\""), hex.EncodeToString(sum); etag != expected {
+		return fmt.Errorf("upload of %q is corrupted: ETag %s does not match the MD5 %s of the content sent. Please upload it again", key, etag, expected)
+	}
+	return nil
+}
+
+// checkPartETag compares the ETag of an uploaded part with the MD5 of the content sent.
+func checkPartETag(part minio.ObjectPart, sum []byte, sse encrypt.ServerSide) error {
+	if !hasMD5ETag(sse) {
+		return nil
+	}
+	if etag, expected := strings.Trim(part.ETag, "\""), hex.EncodeToString(sum); etag != expected {
+		return fmt.Errorf("part is corrupted: ETag %s does not match the MD5 %s of the content sent", etag, expected)
+	}
+	return nil
+}
+
+// etagHasher computes the ETag of content like S3: the MD5 of single-part objects, or the MD5 of the concatenated part MD5s with the part count for multipart uploads.
+type etagHasher struct {
+	etag string
+	// guessed is set if the part size of a multipart upload is unknown and all common part sizes are tried
+	guessed bool
+	parts   []*partHasher
+}
+
+// partHasher computes the ETag for a single part size. Single-part objects have a part size of zero.
+type partHasher struct {
+	size    int64
+	written int64
+	current hash.Hash
+	sums    []byte
+	count   int
+}
+
+// newETagHasher returns a hasher for an object with the given ETag and size, or nil if the ETag is no MD5. The part size of multipart uploads is guessed if zero.
+func newETagHasher(etag string, size, partSize int64) *etagHasher {
+	m := etagPattern.FindStringSubmatch(strings.ToLower(strings.Trim(etag, "\"")))
+	if m == nil {
+		return nil
+	}
+	h := &etagHasher{etag: m[0]}
+	if len(m[3]) == 0 {
+		h.parts = []*partHasher{{current: md5.New()}}
+		return h
+	}
+
+	count, err := strconv.Atoi(m[3])
+	if err != nil {
+		return nil
+	}
+	candidates := []int64{partSize}
+	if partSize <= 0 {
+		h.guessed = true
+		candidates = partSizeCandidates(size, count)
+	}
+	for _, partSize := range candidates {
+		h.parts = append(h.parts, &partHasher{size: partSize, current: md5.New()})
+	}
+	if len(h.parts) == 0 {
+		return nil
+	}
+	return h
+}
+
+// partSizeCandidates returns the part sizes of s3client and other common tools that split size bytes into count parts.
+func partSizeCandidates(size int64, count int) []int64 {
+	const mib = 1 << 20
+	// minio-go uses multiples of 64 MiB, the AWS CLI 8 MiB and many SDKs 5 MiB
+	minioPartSize := (size/maxParts + 64*mib - 1) / (64 * mib) * (64 * mib)
+	candidates := make([]int64, 0)
+	seen := make(map[int64]bool)
+	for _, partSize := range []int64{uploadPartSize(size), 5 * mib, 8 * mib, 15 * mib, 16 * mib, 64 * mib, 128 * mib, minioPartSize} {
+		if partSize <= 0 || seen[partSize] {
+			continue
+		}
+		seen[partSize] = true
+		if (size+partSize-1)/partSize == int64(count) {
+			candidates = append(candidates, partSize)
+		}
+	}
+	return candidates
+}
+
+func (h *etagHasher) Write(b []byte) (int, error) {
+	for _, p := range h.parts {
+		p.write(b)
+	}
+	return len(b), nil
+}
+
+// Matches returns true if the content written so far has the expected ETag.
+func (h *etagHasher) Matches() bool {
+	for _, p := range h.parts {
+		if p.etag() == h.etag {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *partHasher) write(b []byte) {
+	for len(b) > 0 {
+		n := len(b)
+		if p.size > 0 && int64(n) > p.size-p.written {
+			n = int(p.size - p.written)
+		}
+		p.current.Write(b[:n])
+		p.written += int64(n)
+		b = b[n:]
+		if p.size > 0 && p.written == p.size {
+			p.sums = p.current.Sum(p.sums)
+			p.current.Reset()
+			p.written = 0
+			p.count++
+		}
+	}
+}
+
+func (p *partHasher) etag() string {
+	if p.size == 0 {
+		return hex.EncodeToString(p.current.Sum(nil))
+	}
+	sums, count := append([]byte{}, p.sums...), p.count
+	if p.written > 0 || count == 0 {
+		sums = p.current.Sum(sums)
+		count++
+	}
+	sum := md5.Sum(sums)
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), count)
+}
+
+// contentVerifier checks content against the ETag and checksum metadata of an object while it is transferred.
+type contentVerifier struct {
+	etag      *etagHasher
+	checksums map[string]hash.Hash
+	expected  map[string]string
+}
+
+// newContentVerifier returns a verifier for the content of an object, or nil if there is nothing to verify. Content encrypted on client side is authenticated on decryption instead.
+func newContentVerifier(info minio.ObjectInfo) *contentVerifier {
+	if len(info.Metadata.Get(metaClientCipher)) > 0 {
+		return nil
+	}
+
+	v := &contentVerifier{checksums: make(map[string]hash.Hash), expected: make(map[string]string)}
+	if name := encryptionName(info.Metadata); name == "" || name == "SSE-S3" {
+		partSize, _ := strconv.ParseInt(info.Metadata.Get(metaPartSize), 10, 64)
+		v.etag = newETagHasher(info.ETag, info.Size, partSize)
+	}
+	for _, header := range []string{metaChecksumSHA256, metaChecksumCRC32C} {
+		if value := info.Metadata.Get(header); len(value) > 0 {
+			v.checksums[header] = newChecksum(header)
+			v.expected[header] = strings.ToLower(value)
+		}
+	}
+	if v.etag == nil && len(v.checksums) == 0 {
+		return nil
+	}
+	return v
+}
+
+func (v *contentVerifier) Write(b []byte) (int, error) {
+	if v.etag != nil {
+		v.etag.Write(b)
+	}
+	for _, h := range v.checksums {
+		h.Write(b)
+	}
+	return len(b), nil
+}
+
+// Check returns an error if the content written does not match the object. It returns false if the content could not be compared, because the part size of a multipart ETag had to be guessed and no guess matched.
+func (v *contentVerifier) Check() (bool, error) {
+	for _, header := range []string{metaChecksumSHA256, metaChecksumCRC32C} {
+		if h, ok := v.checksums[header]; ok {
+			if sum := hex.EncodeToString(h.Sum(nil)); sum != v.expected[header] {
+				return true, fmt.Errorf("%s checksum %s does not match %s", strings.ToLower(header[len("X-Amz-Meta-S3client-"):]), sum, v.expected[header])
+			}
+		}
+	}
+	if v.etag != nil && !v.etag.Matches() {
+		if v.etag.guessed {
+			return len(v.checksums) > 0, nil
+		}
+		return true, fmt.Errorf("MD5 does not match ETag %s", v.etag.etag)
+	}
+	return true, nil
+}
+
+// fileMatchesETag compares a local file with an ETag. The second return value is false if the ETag can not be computed.
+func fileMatchesETag(filePath, etag string, size int64) (bool, bool) {
+	h := newETagHasher(etag, size, 0)
+	if h == nil {
+		return false, false
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false, false
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return false, false
+	}
+	if h.Matches() {
+		return true, true
+	}
+	return false, !h.guessed
+}
+
+// verifyResult is the outcome of the comparison of a single file.
+type verifyResult struct {
+	Path   string
+	Status string
+	Detail string
+}
+
+const (
+	verifyOK         = "ok"
+	verifyMismatch   = "mismatched"
+	verifyMissing    = "missing"
+	verifyExtra      = "extra"
+	verifyUnverified = "unverified"
+)
+
+// verify compares a local file or directory with an object or all objects below a remote directory.
+func verify(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Value: append([]string{"-j"}, encryptionFlags...)})
+	if err != nil {
+		return err
+	}
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"local", "remote"}, MinArgs: 2, RequireBucket: false}); err != nil {
+		return err
+	}
+	sse, err := getEncryption(s, flags)
+	if err != nil {
+		return err
+	}
+	opts := minio.GetObjectOptions{ServerSideEncryption: sse}
+	workers, err := getWorkers(s, flags)
+	if err != nil {
+		return err
+	}
+
+	localPath := args[0]
+	remote, err := resolvePath(s, args[1])
+	if err != nil {
+		return err
+	}
+
+	// files that exist on both sides are compared by content
+	type filePair struct{ Name, FilePath, Key string }
+	pairs := make([]filePair, 0)
+	results := make([]verifyResult, 0)
+	if single, err := fs.IsFile(localPath); err != nil {
+		return err
+	} else if single {
+		key := remote.Key
+		if _, isDir, _, err := stat(s, remote.Bucket, remote.Key); err != nil {
+			return err
+		} else if isDir || remote.IsRoot() {
+			key = remote.Dir() + filepath.Base(localPath)
+		}
+		if exists, err := isFile(s, remote.Bucket, key); err != nil {
+			return err
+		} else if exists {
+			pairs = append(pairs, filePair{Name: localPath, FilePath: localPath, Key: key})
+		} else {
+			results = append(results, verifyResult{Path: localPath, Status: verifyMissing})
+		}
+
+	} else if isDir, err := fs.IsDir(localPath); err != nil {
+		return err
+	} else if isDir {
+		prefix := remote.Dir()
+		localFiles, err := listLocalTree(localPath)
+		if err != nil {
+			return err
+		}
+		remoteFiles, err := listRemoteTree(s, remote.Bucket, prefix)
+		if err != nil {
+			return err
+		}
+		for p := range localFiles {
+			if _, ok := remoteFiles[p]; ok {
+				pairs = append(pairs, filePair{Name: p, FilePath: filepath.Join(localPath, p), Key: prefix + p})
+			} else {
+				results = append(results, verifyResult{Path: p, Status: verifyMissing})
+			}
+		}
+		for p := range remoteFiles {
+			if _, ok := localFiles[p]; !ok {
+				results = append(results, verifyResult{Path: p, Status: verifyExtra})
+			}
+		}
+
+	} else {
+		return fmt.Errorf("Local path %q does not exist", localPath)
+	}
+
+	var mutex sync.Mutex
+	tasks := make([]task, 0, len(pairs))
+	for _, pair := range pairs {
+		pair := pair
+		tasks = append(tasks, task{Label: pair.Name, Run: func(log func(string, ...interface{})) error {
+			result, err := verifyObject(s, pair.FilePath, remote.Bucket, pair.Key, opts)
+			if err != nil {
+				return err
+			}
+			result.Path = pair.Name
+			mutex.Lock()
+			results = append(results, result)
+			mutex.Unlock()
+			return nil
+		}})
+	}
+	if err := runTasks(workers, tasks, nil); err != nil {
+		return err
+	}
+
+	return printVerifyResults(results)
+}
+
+// verifyObject compares a local file with an object by size and by content where possible.
+func verifyObject(s *Session, filePath, bucket, key string, opts minio.GetObjectOptions) (verifyResult, error) {
+	info, err := s.Store.StatObject(bucket, key, minio.StatObjectOptions{GetObjectOptions: opts})
+	if err != nil {
+		return verifyResult{}, err
+	}
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return verifyResult{}, err
+	}
+
+	size := info.Size
+	if len(info.Metadata.Get(metaClientCipher)) > 0 {
+		size = decryptedSize(size)
+	}
+	if fi.Size() != size {
+		return verifyResult{Status: verifyMismatch, Detail: fmt.Sprintf("size %d does not match %d", fi.Size(), size)}, nil
+	}
+
+	v := newContentVerifier(info)
+	if v == nil {
+		return verifyResult{Status: verifyUnverified, Detail: "size only"}, nil
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return verifyResult{}, err
+	}
+	defer f.Close()
+	if _, err := io.Copy(v, f); err != nil {
+		return verifyResult{}, err
+	}
+
+	verified, err := v.Check()
+	if err != nil {
+		return verifyResult{Status: verifyMismatch, Detail: err.Error()}, nil
+	}
+	if !verified {
+		return verifyResult{Status: verifyUnverified, Detail: "size only, unknown part size"}, nil
+	}
+	return verifyResult{Status: verifyOK}, nil
+}
+
+// printVerifyResults lists all files that differ or could not be compared and returns an error if there are differences.
+func printVerifyResults(results []verifyResult) error {
+	sort.Slice(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.Status]++
+		switch result.Status {
+		case verifyMismatch:
+			printlnf("  M  %s  %s(%s)%s", result.Path, colorPrefix, result.Detail, colorEnd)
+		case verifyMissing:
+			printlnf("  -  %s  %s(missing remote)%s", result.Path, colorPrefix, colorEnd)
+		case verifyExtra:
+			printlnf("  +  %s  %s(missing local)%s", result.Path, colorPrefix, colorEnd)
+		case verifyUnverified:
+			printlnf("  ?  %s  %s(%s)%s", result.Path, colorPrefix, result.Detail, colorEnd)
+		}
+	}
+
+	printlnf("Verification completed: %d ok, %d mismatched, %d missing, %d extra, %d unverified",
+		counts[verifyOK], counts[verifyMismatch], counts[verifyMissing], counts[verifyExtra], counts[verifyUnverified])
+	if differences := counts[verifyMismatch] + counts[verifyMissing] + counts[verifyExtra]; differences > 0 {
+		return fmt.Errorf("found %d differences", differences)
+	}
+	return nil
+}
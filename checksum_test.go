@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/md5"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go"
+)
+
+// defaultEncryptionStore behaves like a bucket with default encryption. SSE-KMS returns opaque ETags.
+type defaultEncryptionStore struct {
+	*memoryStore
+	encryption string
+}
+
+func (s defaultEncryptionStore) StatObject(bucket, key string, opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	info, err := s.memoryStore.StatObject(bucket, key, opts)
+	if err == nil && len(s.encryption) > 0 {
+		if s.encryption != "AES256" {
+			info.ETag = "0123456789abcdef0123456789abcdef"
+		}
+		info.Metadata = info.Metadata.Clone()
+		info.Metadata.Set("X-Amz-Server-Side-Encryption", s.encryption)
+	}
+	return info, err
+}
+
+func TestVerifyUpload(t *testing.T) {
+	tests := []struct {
+		encryption string
+		// corrupted uploads the content with a different sum than the one sent
+		corrupted bool
+		err       bool
+	}{
+		{"", false, false},
+		{"", true, true},
+		{"AES256", false, false},
+		{"AES256", true, true},
+		{"aws:kms", false, false},
+		{"aws:kms", true, false},
+	}
+	for _, test := range tests {
+		s := newTestSession(t)
+		store := defaultEncryptionStore{memoryStore: newMemoryStore(), encryption: test.encryption}
+		must(t, store.MakeBucket("b"))
+		s.Store = store
+		_, err := store.PutObject("b", "k", strings.NewReader("content"), 7, minio.PutObjectOptions{})
+		must(t, err)
+
+		sent := "content"
+		if test.corrupted {
+			sent = "changed"
+		}
+		sum := md5.Sum([]byte(sent))
+		err = verifyUpload(s, "b", "k", sum[:], minio.PutObjectOptions{})
+		if (err != nil) != test.err {
+			t.Errorf("encryption %q, corrupted %t: unexpected error %v", test.encryption, test.corrupted, err)
+		}
+	}
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/minio/minio-go"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// clientCipher names the stream format: AES-256-GCM applied to segments of 64 KiB with a separate authentication tag each.
+	clientCipher      = "AES-256-GCM-64K"
+	clientSegmentSize = 64 * 1024
+	clientTagSize     = 16
+	clientKDFKeyFile  = "keyfile"
+	clientKDFScrypt   = "scrypt"
+
+	// the envelope is stored as user metadata next to the encrypted content
+	metaClientCipher = "X-Amz-Meta-S3client-Cipher"
+	metaClientKey    = "X-Amz-Meta-S3client-Key"
+	metaClientKDF    = "X-Amz-Meta-S3client-Kdf"
+	metaClientSalt   = "X-Amz-Meta-S3client-Salt"
+)
+
+// clientEncryption configures the client-side envelope encryption of an environment.
+type clientEncryption struct {
+	// KeyFile contains the 256 bit master key. A passphrase is asked once per session if empty.
+	KeyFile string `json:"keyFile,omitempty"`
+	// Prefixes are the encrypted locations in "bucket:/prefix" notation. All objects are encrypted if empty.
+	Prefixes []string `json:"prefixes,omitempty"`
+}
+
+// clientKeys caches the master keys of a session, because deriving them from a passphrase is slow on purpose.
+type clientKeys struct {
+	mutex      sync.Mutex
+	passphrase []byte
+	// salt is used for all keys derived for uploads of this session
+	salt    []byte
+	derived map[string][]byte
+}
+
+func newClientKeys() *clientKeys {
+	return &clientKeys{derived: make(map[string][]byte)}
+}
+
+// isClientEncrypted returns true if objects written to the given key must be encrypted on the client.
+func isClientEncrypted(s *Session, bucket, key string) bool {
+	cfg := s.Target.ClientEncryption
+	if cfg == nil {
+		return false
+	}
+	if len(cfg.Prefixes) == 0 {
+		return true
+	}
+
+	for _, prefix := range cfg.Prefixes {
+		m := bucketPathPattern.FindStringSubmatch(prefix)
+		if m == nil || m[1] != bucket {
+			continue
+		}
+		dir := cleanKey(m[2])
+		if len(dir) == 0 || key == dir || strings.HasPrefix(key, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// containsClientEncrypted returns true if objects written anywhere below the directory with the given key prefix might have to be encrypted on the client.
+func containsClientEncrypted(s *Session, bucket, dir string) bool {
+	if isClientEncrypted(s, bucket, dir) {
+		return true
+	}
+	cfg := s.Target.ClientEncryption
+	if cfg == nil {
+		return false
+	}
+
+	for _, prefix := range cfg.Prefixes {
+		m := bucketPathPattern.FindStringSubmatch(prefix)
+		if m != nil && m[1] == bucket && strings.HasPrefix(cleanKey(m[2])+"/", dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// isClientMetadata returns true for the reserved metadata of the encryption envelope and checksums.
+func isClientMetadata(header string) bool {
+	return strings.HasPrefix(header, "X-Amz-Meta-S3client-")
+}
+
+// masterKey returns the key that wraps the data keys of objects, reading the key file or deriving it from the passphrase and salt.
+func masterKey(s *Session, kdf string, salt []byte) ([]byte, error) {
+	cfg := s.Target.ClientEncryption
+	if cfg == nil {
+		return nil, fmt.Errorf("object is encrypted on client side, but the environment has no client encryption configured")
+	}
+
+	switch kdf {
+	case clientKDFKeyFile:
+		if len(cfg.KeyFile) == 0 {
+			return nil, fmt.Errorf("object is encrypted with a key file, but the environment uses a passphrase")
+		}
+		return readKeyFile(cfg.KeyFile)
+
+	case clientKDFScrypt:
+		if len(cfg.KeyFile) > 0 {
+			return nil, fmt.Errorf("object is encrypted with a passphrase, but the environment uses a key file")
+		}
+		keys := s.clientKeys
+		keys.mutex.Lock()
+		defer keys.mutex.Unlock()
+
+		if key, ok := keys.derived[string(salt)]; ok {
+			return key, nil
+		}
+		if keys.passphrase == nil {
+			passphrase, err := readPassphrase()
+			if err != nil {
+				return nil, err
+			}
+			keys.passphrase = []byte(passphrase)
+		}
+		key, err := scrypt.Key(keys.passphrase, salt, 1<<15, 8, 1, 32)
+		if err != nil {
+			return nil, err
+		}
+		keys.derived[string(salt)] = key
+		return key, nil
+
+	default:
+		return nil, fmt.Errorf("unknown key derivation %q", kdf)
+	}
+}
+
+// readPassphrase returns the passphrase from S3CLIENT_PASSPHRASE for scripts or asks the user.
+func readPassphrase() (string, error) {
+	if passphrase := os.Getenv("S3CLIENT_PASSPHRASE"); len(passphrase) > 0 {
+		return passphrase, nil
+	}
+	fmt.Print("Encryption Passphrase> ")
+	return readpwNonEmpty()
+}
+
+// newEnvelope creates a random data key for a new object and returns it together with the user metadata that stores it wrapped by the master key.
+func newEnvelope(s *Session) ([]byte, map[string]string, error) {
+	kdf := clientKDFKeyFile
+	var salt []byte
+	if len(s.Target.ClientEncryption.KeyFile) == 0 {
+		kdf = clientKDFScrypt
+		s.clientKeys.mutex.Lock()
+		if s.clientKeys.salt == nil {
+			s.clientKeys.salt = make([]byte, 16)
+			if _, err := rand.Read(s.clientKeys.salt); err != nil {
+				s.clientKeys.mutex.Unlock()
+				return nil, nil, err
+			}
+		}
+		salt = s.clientKeys.salt
+		s.clientKeys.mutex.Unlock()
+	}
+
+	master, err := masterKey(s, kdf, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := newGCM(master)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dataKey := make([]byte, 32)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	wrapped := aead.Seal(nonce, nonce, dataKey, []byte(clientCipher))
+
+	metadata := map[string]string{
+		metaClientCipher: clientCipher,
+		metaClientKey:    base64.StdEncoding.EncodeToString(wrapped),
+		metaClientKDF:    kdf,
+	}
+	if salt != nil {
+		metadata[metaClientSalt] = base64.StdEncoding.EncodeToString(salt)
+	}
+	return dataKey, metadata, nil
+}
+
+// openEnvelope unwraps the data key of an object from its metadata.
+func openEnvelope(s *Session, header http.Header) ([]byte, error) {
+	if name := header.Get(metaClientCipher); name != clientCipher {
+		return nil, fmt.Errorf("unsupported client-side encryption %q", name)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(header.Get(metaClientKey))
+	if err != nil {
+		return nil, fmt.Errorf("malformed data key: %s", err.Error())
+	}
+	salt, err := base64.StdEncoding.DecodeString(header.Get(metaClientSalt))
+	if err != nil {
+		return nil, fmt.Errorf("malformed key salt: %s", err.Error())
+	}
+
+	master, err := masterKey(s, header.Get(metaClientKDF), salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, fmt.Errorf("malformed data key")
+	}
+	dataKey, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(clientCipher))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt data key: wrong key or passphrase")
+	}
+	return dataKey, nil
+}
+
+// encryptUpload wraps the content of an upload into a new envelope. It returns the reader and size to send and adds the envelope to a copy of the user metadata in opts.
+func encryptUpload(s *Session, r io.Reader, size int64, opts *minio.PutObjectOptions) (io.Reader, int64, error) {
+	dataKey, envelope, err := newEnvelope(s)
+	if err != nil {
+		return nil, 0, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	addUserMetadata(opts, envelope)
+	return newEncryptingReader(r, aead, 0, false), encryptedSize(size), nil
+}
+
+// addUserMetadata adds metadata with full header names to a copy of the user metadata in opts.
+func addUserMetadata(opts *minio.PutObjectOptions, headers map[string]string) {
+	// the options are shared by parallel uploads and must not be modified
+	metadata := make(map[string]string)
+	for k, v := range opts.UserMetadata {
+		metadata[k] = v
+	}
+	for k, v := range headers {
+		metadata[strings.TrimPrefix(k, "X-Amz-Meta-")] = v
+	}
+	opts.UserMetadata = metadata
+}
+
+// putEncryptedFile uploads a local file encrypted on the client and returns the MD5 of the encrypted content. The progress bar reports the plaintext read from the file.
+func putEncryptedFile(s *Session, bucket, key, filePath string, opts minio.PutObjectOptions, bar *progressBar) (int64, []byte, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(opts.ContentType) == 0 {
+		if opts.ContentType, err = detectContentType(f); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	var r io.Reader = f
+	if bar != nil {
+		r = io.TeeReader(f, bar)
+	}
+	r, size, err := encryptUpload(s, r, fi.Size(), &opts)
+	if err != nil {
+		return 0, nil, err
+	}
+	hash := md5.New()
+	if _, err := s.Store.PutObject(bucket, key, io.TeeReader(r, hash), size, opts); err != nil {
+		return 0, nil, err
+	}
+	return fi.Size(), hash.Sum(nil), nil
+}
+
+// decryptObject returns the plaintext of an object read from r and its size. Objects without client-side encryption are returned unchanged.
+func decryptObject(s *Session, info minio.ObjectInfo, r io.Reader) (io.Reader, int64, error) {
+	return decryptObjectAt(s, info, r, 0)
+}
+
+// decryptObjectAt is like decryptObject for content read from a plaintext offset, which must be a multiple of the segment size for encrypted objects.
+func decryptObjectAt(s *Session, info minio.ObjectInfo, r io.Reader, offset int64) (io.Reader, int64, error) {
+	if len(info.Metadata.Get(metaClientCipher)) == 0 {
+		return r, info.Size, nil
+	}
+
+	dataKey, err := openEnvelope(s, info.Metadata)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to decrypt %q: %s", info.Key, err.Error())
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &decryptingReader{src: bufio.NewReader(r), aead: aead, counter: uint32(offset / clientSegmentSize), buffer: make([]byte, clientSegmentSize+clientTagSize)}, decryptedSize(info.Size), nil
+}
+
+// checkClientCopy prevents server-side copies of plaintext into encrypted locations, because the server can not encrypt them on behalf of the client.
+func checkClientCopy(s *Session, srcBucket, srcKey, dstBucket, dstKey string, opts copyOptions) error {
+	if !isClientEncrypted(s, dstBucket, dstKey) {
+		return nil
+	}
+	info, err := s.Store.StatObject(srcBucket, srcKey, minio.StatObjectOptions{GetObjectOptions: minio.GetObjectOptions{ServerSideEncryption: opts.SourceEncryption}})
+	if err != nil {
+		return err
+	}
+	if len(info.Metadata.Get(metaClientCipher)) == 0 {
+		return fmt.Errorf("refusing to copy unencrypted object %q into encrypted location %q. Please download and upload it again", srcKey, dstKey)
+	}
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// segmentNonce returns the nonce of a segment. Every data key encrypts a single object, so a counter is sufficient. The final flag prevents undetected truncation at segment boundaries.
+func segmentNonce(counter uint32, final bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint32(nonce[7:11], counter)
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// encryptedOffset returns the position in the encrypted stream of a plaintext offset at a segment boundary.
+func encryptedOffset(offset int64) int64 {
+	return offset / clientSegmentSize * (clientSegmentSize + clientTagSize)
+}
+
+// encryptedSize returns the size of the encrypted stream for plaintext of size n. Even empty content has one segment.
+func encryptedSize(n int64) int64 {
+	segments := (n + clientSegmentSize - 1) / clientSegmentSize
+	if segments == 0 {
+		segments = 1
+	}
+	return n + segments*clientTagSize
+}
+
+// decryptedSize returns the plaintext size of an encrypted stream of size n.
+func decryptedSize(n int64) int64 {
+	segments := (n + clientSegmentSize + clientTagSize - 1) / (clientSegmentSize + clientTagSize)
+	if segments == 0 {
+		segments = 1
+	}
+	if size := n - segments*clientTagSize; size > 0 {
+		return size
+	}
+	return 0
+}
+
+// encryptingReader encrypts the content of src segment by segment.
+type encryptingReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	counter uint32
+	// more is set if src is only a part of the stream, so its last segment is not the final one
+	more   bool
+	buffer []byte
+	sealed []byte
+	out    []byte
+	done   bool
+}
+
+// newEncryptingReader encrypts r as part of a stream starting at the given plaintext offset, which must be a multiple of the segment size.
+func newEncryptingReader(r io.Reader, aead cipher.AEAD, offset int64, more bool) *encryptingReader {
+	return &encryptingReader{src: bufio.NewReader(r), aead: aead, counter: uint32(offset / clientSegmentSize), more: more, buffer: make([]byte, clientSegmentSize)}
+}
+
+func (r *encryptingReader) Read(b []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		n, err := io.ReadFull(r.src, r.buffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		final := n < len(r.buffer)
+		if !final {
+			// the last segment must be marked even if the content ends exactly at a segment boundary
+			if _, err := r.src.Peek(1); err == io.EOF {
+				final = true
+			} else if err != nil {
+				return 0, err
+			}
+		}
+		if !final && r.counter == math.MaxUint32 {
+			return 0, fmt.Errorf("content is too large for client-side encryption")
+		}
+
+		r.sealed = r.aead.Seal(r.sealed[:0], segmentNonce(r.counter, final && !r.more), r.buffer[:n], nil)
+		r.out = r.sealed
+		r.counter++
+		r.done = final
+	}
+
+	n := copy(b, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// decryptingReader decrypts and authenticates the content of src segment by segment.
+type decryptingReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	counter uint32
+	buffer  []byte
+	opened  []byte
+	out     []byte
+	done    bool
+}
+
+func (r *decryptingReader) Read(b []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		n, err := io.ReadFull(r.src, r.buffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		final := n < len(r.buffer)
+		if !final {
+			if _, err := r.src.Peek(1); err == io.EOF {
+				final = true
+			} else if err != nil {
+				return 0, err
+			}
+		}
+
+		if r.opened, err = r.aead.Open(r.opened[:0], segmentNonce(r.counter, final), r.buffer[:n], nil); err != nil {
+			return 0, fmt.Errorf("encrypted content is corrupted or truncated")
+		}
+		r.out = r.opened
+		r.counter++
+		r.done = final
+	}
+
+	n := copy(b, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
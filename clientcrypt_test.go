@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minio/minio-go"
+)
+
+// clientTestSizes contains empty content, a single segment and sizes around segment boundaries.
+var clientTestSizes = []int64{0, 1, clientSegmentSize - 1, clientSegmentSize, clientSegmentSize + 1, 2 * clientSegmentSize, 3*clientSegmentSize + 5}
+
+// randomContent returns n random bytes.
+func randomContent(t *testing.T, n int64) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	_, err := rand.Read(data)
+	must(t, err)
+	return data
+}
+
+// writeKeyFile writes a random master key to a new file in dir and returns its path.
+func writeKeyFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	keyFile := filepath.Join(dir, name)
+	must(t, ioutil.WriteFile(keyFile, randomContent(t, 32), 0600))
+	return keyFile
+}
+
+// newClientSession returns a test session that encrypts all objects with the master key in keyFile, or with the passphrase if keyFile is empty.
+func newClientSession(t *testing.T, keyFile, passphrase string) *Session {
+	t.Helper()
+	s := newTestSession(t)
+	s.Target.ClientEncryption = &clientEncryption{KeyFile: keyFile}
+	if len(keyFile) == 0 {
+		s.clientKeys.passphrase = []byte(passphrase)
+	}
+	return s
+}
+
+// encryptContent encrypts data as a whole stream with the given data key.
+func encryptContent(t *testing.T, dataKey, data []byte) []byte {
+	t.Helper()
+	aead, err := newGCM(dataKey)
+	must(t, err)
+	encrypted, err := ioutil.ReadAll(newEncryptingReader(bytes.NewReader(data), aead, 0, false))
+	must(t, err)
+	return encrypted
+}
+
+// decryptContent decrypts a whole stream with the given data key.
+func decryptContent(dataKey, encrypted []byte) ([]byte, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	r := &decryptingReader{src: bufio.NewReader(bytes.NewReader(encrypted)), aead: aead, buffer: make([]byte, clientSegmentSize+clientTagSize)}
+	return ioutil.ReadAll(r)
+}
+
+func TestClientSizes(t *testing.T) {
+	tests := []struct {
+		size      int64
+		encrypted int64
+	}{
+		{0, clientTagSize},
+		{1, 1 + clientTagSize},
+		{clientSegmentSize - 1, clientSegmentSize - 1 + clientTagSize},
+		{clientSegmentSize, clientSegmentSize + clientTagSize},
+		{clientSegmentSize + 1, clientSegmentSize + 1 + 2*clientTagSize},
+		{2 * clientSegmentSize, 2*clientSegmentSize + 2*clientTagSize},
+		{3*clientSegmentSize + 5, 3*clientSegmentSize + 5 + 4*clientTagSize},
+	}
+	dataKey := randomContent(t, 32)
+	for _, test := range tests {
+		if n := encryptedSize(test.size); n != test.encrypted {
+			t.Errorf("encryptedSize(%d) = %d, expected %d", test.size, n, test.encrypted)
+		}
+		if n := decryptedSize(test.encrypted); n != test.size {
+			t.Errorf("decryptedSize(%d) = %d, expected %d", test.encrypted, n, test.size)
+		}
+		if n := int64(len(encryptContent(t, dataKey, randomContent(t, test.size)))); n != test.encrypted {
+			t.Errorf("content of %d bytes encrypted to %d bytes, expected %d", test.size, n, test.encrypted)
+		}
+	}
+}
+
+func TestSegmentNonce(t *testing.T) {
+	tests := []struct {
+		counter uint32
+		final   bool
+		nonce   []byte
+	}{
+		{0, false, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{0, true, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+		{1, false, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0}},
+		{0x01020304, true, []byte{0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4, 1}},
+	}
+	for _, test := range tests {
+		if nonce := segmentNonce(test.counter, test.final); !bytes.Equal(nonce, test.nonce) {
+			t.Errorf("segmentNonce(%d, %t) = %x, expected %x", test.counter, test.final, nonce, test.nonce)
+		}
+	}
+}
+
+func TestClientStream(t *testing.T) {
+	dataKey := randomContent(t, 32)
+	for _, size := range clientTestSizes {
+		data := randomContent(t, size)
+		encrypted := encryptContent(t, dataKey, data)
+		decrypted, err := decryptContent(dataKey, encrypted)
+		if err != nil || !bytes.Equal(decrypted, data) {
+			t.Errorf("content of %d bytes: decrypted %d bytes, error %v", size, len(decrypted), err)
+		}
+
+		// multipart uploads encrypt every part separately, only the last one contains the final segment
+		if size > clientSegmentSize {
+			aead, err := newGCM(dataKey)
+			must(t, err)
+			first, err := ioutil.ReadAll(newEncryptingReader(bytes.NewReader(data[:clientSegmentSize]), aead, 0, true))
+			must(t, err)
+			second, err := ioutil.ReadAll(newEncryptingReader(bytes.NewReader(data[clientSegmentSize:]), aead, clientSegmentSize, false))
+			must(t, err)
+			if parts := append(first, second...); !bytes.Equal(parts, encrypted) {
+				t.Errorf("content of %d bytes: encrypted parts differ from the whole stream", size)
+			}
+		}
+	}
+}
+
+func TestClientStreamTampered(t *testing.T) {
+	dataKey := randomContent(t, 32)
+	segment := int64(clientSegmentSize + clientTagSize)
+	tests := []struct {
+		name string
+		size int64
+		// tamper returns the modified encrypted content
+		tamper func([]byte) []byte
+	}{
+		{"truncated at segment boundary", 2 * clientSegmentSize, func(b []byte) []byte { return b[:segment] }},
+		{"truncated after first of three segments", 2*clientSegmentSize + 1, func(b []byte) []byte { return b[:segment] }},
+		{"truncated after two of three segments", 2*clientSegmentSize + 1, func(b []byte) []byte { return b[:2*segment] }},
+		{"truncated inside segment", clientSegmentSize + 1, func(b []byte) []byte { return b[:len(b)-1] }},
+		{"empty", 0, func(b []byte) []byte { return nil }},
+		{"modified", clientSegmentSize + 1, func(b []byte) []byte { b[10]++; return b }},
+		{"reordered", 2 * clientSegmentSize, func(b []byte) []byte { return append(append([]byte{}, b[segment:]...), b[:segment]...) }},
+		{"extended", clientSegmentSize, func(b []byte) []byte { return append(b, b...) }},
+	}
+	for _, test := range tests {
+		encrypted := test.tamper(encryptContent(t, dataKey, randomContent(t, test.size)))
+		if _, err := decryptContent(dataKey, encrypted); err == nil {
+			t.Errorf("%s: decrypted without error", test.name)
+		}
+	}
+
+	if _, err := decryptContent(randomContent(t, 32), encryptContent(t, dataKey, []byte("content"))); err == nil {
+		t.Errorf("decrypted with a wrong data key")
+	}
+}
+
+func TestDecryptObjectAt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3client-test")
+	must(t, err)
+	defer os.RemoveAll(dir)
+	s := newClientSession(t, writeKeyFile(t, dir, "key"), "")
+	data := randomContent(t, 3*clientSegmentSize+5)
+	var opts minio.PutObjectOptions
+	r, size, err := encryptUpload(s, bytes.NewReader(data), int64(len(data)), &opts)
+	must(t, err)
+	_, err = s.Store.PutObject("b", "k", r, size, opts)
+	must(t, err)
+	info, err := s.Store.StatObject("b", "k", minio.StatObjectOptions{})
+	must(t, err)
+	obj, err := s.Store.GetObject("b", "k", minio.GetObjectOptions{})
+	must(t, err)
+	encrypted, err := ioutil.ReadAll(obj)
+	must(t, err)
+
+	// resumed downloads request the encrypted content from the start of the first missing segment
+	for _, offset := range []int64{0, clientSegmentSize, 3 * clientSegmentSize} {
+		r, size, err := decryptObjectAt(s, info, bytes.NewReader(encrypted[encryptedOffset(offset):]), offset)
+		must(t, err)
+		if size != int64(len(data)) {
+			t.Errorf("offset %d: plaintext size %d, expected %d", offset, size, len(data))
+		}
+		decrypted, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(decrypted, data[offset:]) {
+			t.Errorf("offset %d: decrypted %d bytes, error %v", offset, len(decrypted), err)
+		}
+	}
+
+	// objects without envelope are returned unchanged
+	info.Metadata = http.Header{}
+	r, size, err = decryptObjectAt(s, info, bytes.NewReader(encrypted), 0)
+	must(t, err)
+	if plain, _ := ioutil.ReadAll(r); size != info.Size || !bytes.Equal(plain, encrypted) {
+		t.Errorf("object without envelope has been modified")
+	}
+}
+
+func TestClientEnvelope(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3client-test")
+	must(t, err)
+	defer os.RemoveAll(dir)
+	key, otherKey := writeKeyFile(t, dir, "key"), writeKeyFile(t, dir, "other")
+	tests := []struct {
+		name   string
+		writer *Session
+		reader *Session
+		// modify changes the stored envelope before reading
+		modify func(http.Header)
+		err    bool
+	}{
+		{"key file", newClientSession(t, key, ""), newClientSession(t, key, ""), nil, false},
+		{"passphrase", newClientSession(t, "", "secret"), newClientSession(t, "", "secret"), nil, false},
+		{"wrong key file", newClientSession(t, key, ""), newClientSession(t, otherKey, ""), nil, true},
+		{"wrong passphrase", newClientSession(t, "", "secret"), newClientSession(t, "", "other"), nil, true},
+		{"passphrase instead of key file", newClientSession(t, key, ""), newClientSession(t, "", "secret"), nil, true},
+		{"unknown cipher", newClientSession(t, key, ""), newClientSession(t, key, ""), func(h http.Header) { h.Set(metaClientCipher, "ROT13") }, true},
+		{"malformed data key", newClientSession(t, key, ""), newClientSession(t, key, ""), func(h http.Header) { h.Set(metaClientKey, "!") }, true},
+		{"truncated data key", newClientSession(t, key, ""), newClientSession(t, key, ""), func(h http.Header) { h.Set(metaClientKey, "AAAA") }, true},
+		{"malformed salt", newClientSession(t, "", "secret"), newClientSession(t, "", "secret"), func(h http.Header) { h.Set(metaClientSalt, "!") }, true},
+		{"changed salt", newClientSession(t, "", "secret"), newClientSession(t, "", "secret"), func(h http.Header) { h.Set(metaClientSalt, "AAAAAAAAAAAAAAAAAAAAAA==") }, true},
+		{"unknown key derivation", newClientSession(t, key, ""), newClientSession(t, key, ""), func(h http.Header) { h.Set(metaClientKDF, "md5") }, true},
+	}
+	for _, test := range tests {
+		dataKey, envelope, err := newEnvelope(test.writer)
+		must(t, err)
+		header := make(http.Header)
+		for k, v := range envelope {
+			header.Set(k, v)
+		}
+		if test.modify != nil {
+			test.modify(header)
+		}
+
+		opened, err := openEnvelope(test.reader, header)
+		if (err != nil) != test.err {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		} else if err == nil && !bytes.Equal(opened, dataKey) {
+			t.Errorf("%s: unwrapped a different data key", test.name)
+		}
+	}
+}
+
+func TestShareUploadEncrypted(t *testing.T) {
+	tests := []struct {
+		arg string
+		err bool
+	}{
+		{"private/data/x", true},
+		{"private/data/", true},
+		{"private/data/sub/", true},
+		// uploads below a directory above the encrypted prefix could also write into it
+		{"private/", true},
+		{"/", true},
+		{"private", false},
+		{"private/other/", false},
+		{"public/", false},
+	}
+	for _, test := range tests {
+		s := newTestSession(t)
+		s.Target.ClientEncryption = &clientEncryption{KeyFile: "unused", Prefixes: []string{"b:/private/data"}}
+		_, err := captureOutput(func() error { return share(s, []string{"--upload", test.arg}) })
+		if (err != nil) != test.err {
+			t.Errorf("share --upload %q: unexpected error %v", test.arg, err)
+		}
+	}
+}
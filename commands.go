@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"strings"
 	"time"
@@ -22,27 +23,54 @@ func help(args []string) error {
 	printlnf("  enter {name}     -  enter bucket with given name")
 	printlnf("  leave            -  leave current bucket")
 	printlnf("  cd               -  enter named directory or \"..\" for parent dir")
-	printlnf("  ls               -  list objects in current bucket and path")
+	printlnf("  ls               -  list objects in current bucket and path. Use \"-l\" to show tags and \"--versions\" to show all versions and delete markers")
 	printlnf("  rm {name}        -  remove object. Use \"-r\" flag to remove all prefixed objects recursively")
-	printlnf("  dl {src} {dst}   -  download a remote object {src} and write to local file {dst}")
-	printlnf("  ul {src} {dst}   -  upload local file {src} to remote object {dst}")
+	printlnf("  dl {src} {dst}   -  download a remote object {src} and write to local file {dst}. Use \"--resume\" to continue an interrupted download from its \".part\" file")
+	printlnf("  ul {src} {dst}   -  upload local file {src} to remote object {dst}. Use \"--content-type\", \"--cache-control\", \"--content-disposition\", \"--meta {key}={value}\" and \"--tag {key}={value}\" to set metadata and tags and \"--resume\" to continue an interrupted upload")
 	printlnf("  mv {src} {dst}   -  copies a remote object {src} to new key {dst} and deletes {src}")
 	printlnf("  cp {src} {dst}   -  copies a remote object {src} to new key {dst}")
+	printlnf("  sync {src} {dst} -  transfer only changed files between a local directory and a remote directory. The remote side is given as \"bucket:/\" or \"s3://\" path or chosen with \"--up\" and \"--down\". Use \"--delete\" to remove extraneous files")
+	printlnf("  verify {local} {remote} - compare a local file or directory with the remote objects by size, ETag and checksums and list mismatched, missing and extra files")
 	printlnf("  touch {name}     -  creates an empty object with key {name}")
 	printlnf("  cat {name}       -  print content of object {name}")
-	printlnf("  find {needle}    -  list all objects with given {needle} in last part of object key")
+	printlnf("  stat {name}      -  show all details of object {name} or a summary of a directory. Use \"--json\" for machine-readable output")
+	printlnf("  setmeta {name}   -  set metadata of object {name} to the following {key}={value} pairs. An empty value removes the key. Use \"-r\" to update all objects of a directory")
+	printlnf("  tag {action}     -  \"get {name}\", \"set {name} {key}={value}...\" or \"rm {name} [{key}...]\" tags of an object. Use \"-r\" for all objects of a directory")
+	printlnf("  versioning {action} - \"enable\", \"suspend\" or show \"status\" of versioning for the current or given bucket")
+	printlnf("  undelete {name}  -  restore a deleted object by removing its latest delete marker")
+	printlnf("  share {name}     -  print a presigned download URL for object {name}. Use \"--expires {duration}\" to change the validity of 24h, \"-r\" for all objects of a directory and \"-o {file}\" to write a URL list")
+	printlnf("  share --upload {name} - print a presigned upload URL. \"--post\", \"--content-type\" and \"--max-size\" create a restricted upload form, a directory allows uploads of any file below it")
+	printlnf("  uploads {action} - \"list [{path}]\" or \"abort {path}\" incomplete multipart uploads. Use \"--older-than {duration}\" to only select stale uploads")
+	printlnf("  find {needle}    -  list all objects with given {needle} in last part of object key. Use \"-r\" to search all subdirectories and \"--tag {key}={value}\" to only list objects with this tag")
 	printlnf("  list {type}      -  list items of any type in [bucket, env]")
 	printlnf("  mkbucket {name}  -  create new bucket with given name")
 	printlnf("  rmbucket {name}  -  delete bucket with given name")
+	printlnf("  policy get {bucket} - print the access policy of a bucket")
+	printlnf("  policy set {bucket} {file} - set the access policy of a bucket from a JSON file or one of the presets \"private\", \"public-read\", \"public-read-prefix {prefix}\" and \"upload-only [{prefix}]\"")
+	printlnf("  lifecycle {action} - \"get [{bucket}]\" shows the lifecycle rules of a bucket, \"set {bucket} {file}\" replaces them by an XML file, \"add {bucket}\" adds a rule from flags and \"rm {bucket} [{id}]\" removes one or all rules")
+	printlnf("  env {action}     -  \"list\", \"show [{env}]\", \"edit [{env}]\", \"rename {env} {new name}\", \"rm {env}\", \"test [{env}]\", \"encrypt [{env}...]\", \"decrypt {env}...\" or \"import-aws [{profile}...]\" saved environments. Secrets are masked in the output")
+	printlnf("  open {env}       -  open an additional environment and switch to it")
+	printlnf("  switch {env}     -  switch to an already opened environment")
+	printlnf("  close {env}      -  close an opened environment")
+	printlnf("")
+	printlnf("Recursive rm, dl, ul, mv, cp and sync accept \"-j {n}\" to process objects with {n} parallel workers")
+	printlnf("All commands that modify data accept \"-n\" to only print the affected objects without changing anything")
+	printlnf("Paths are relative to the current directory. Use \"/\" for the bucket root, \"..\" for the parent directory and \"{bucket}:/{key}\" or \"s3://{bucket}/{key}\" for other buckets. cp, mv and sync also accept \"{env}:{bucket}:/{key}\" for other open environments")
+	printlnf("rm, dl, cp, mv, cat and ls expand the wildcards \"*\", \"?\" and \"**\" against the remote objects, e.g. \"rm logs/*.tmp\"")
+	printlnf("dl and cat accept \"--version-id {id}\" to read an older version. rm with \"--version-id {id}\" permanently deletes this version")
+	printlnf("ul, dl, cp, mv, cat, touch, sync, stat and setmeta accept \"--sse {none|SSE-S3|SSE-KMS|SSE-C}\", \"--kms-key {id}\" and \"--sse-c-key {file}\" to override the server-side encryption of the environment. cp and mv read SSE-C sources with \"--source-sse-c-key {file}\"")
+	printlnf("Objects below the \"clientEncryption\" prefixes of the environment are encrypted on the client by ul, touch and sync and decrypted by dl, cat and sync")
+	printlnf("ul and sync accept \"--checksum-algorithm {sha256|crc32c}\" to store a checksum with every object, which is verified by dl and verify in addition to the ETag")
+	printlnf("ul, mv and cp ask before overwriting existing objects. Use \"--force\" to always overwrite or \"--no-clobber\" to skip existing objects")
 	return nil
 }
 
-func enter(args []string) error {
-	if err := checkArgs(args, argOptions{ArgLabels: []string{"bucket name"}, MinArgs: 1, RequireBucket: false}); err != nil {
+func enter(s *Session, args []string) error {
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"bucket name"}, MinArgs: 1, RequireBucket: false}); err != nil {
 		return err
 	}
 
-	exists, err := minioClient.BucketExists(args[0])
+	exists, err := s.Store.BucketExists(args[0])
 	if err != nil {
 		return err
 	}
@@ -51,23 +79,23 @@ func enter(args []string) error {
 		return fmt.Errorf("bucket %q does not exist", args[0])
 	}
 
-	currentBucket = args[0]
-	currentPrefix = ""
+	s.Bucket = args[0]
+	s.Prefix = ""
 	return nil
 }
 
-func leave(args []string) error {
-	if err := checkArgs(args, argOptions{ArgLabels: []string{}, MinArgs: 0, RequireBucket: true}); err != nil {
+func leave(s *Session, args []string) error {
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{}, MinArgs: 0, RequireBucket: true}); err != nil {
 		return err
 	}
 
-	currentBucket = ""
-	currentPrefix = ""
+	s.Bucket = ""
+	s.Prefix = ""
 	return nil
 }
 
-func cd(args []string) error {
-	if err := checkArgs(args, argOptions{ArgLabels: []string{"dir name"}, MinArgs: 1, RequireBucket: false}); err != nil {
+func cd(s *Session, args []string) error {
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"dir name"}, MinArgs: 1, RequireBucket: false}); err != nil {
 		return err
 	}
 
@@ -79,132 +107,205 @@ func cd(args []string) error {
 		return fmt.Errorf("too many arguments")
 	}
 
-	if len(currentBucket) == 0 {
+	if len(s.Bucket) == 0 && !isBucketPath(args[0]) {
 		printlnf("No bucket entered yet. Entering bucket %q instead", args[0])
-		return enter([]string{args[0]})
+		return enter(s, []string{args[0]})
 	}
 
-	if args[0] == ".." {
-		prefix := strings.TrimRight(currentPrefix, "/")
-		parts := strings.Split(prefix, "/")
-		if len(parts) > 1 {
-			currentPrefix = strings.Join(parts[:len(parts)-1], "/") + "/"
-		} else {
-			currentPrefix = ""
-		}
-	} else {
-		isFile, isDir, _, err := stat(currentPrefix + args[0])
-		if err != nil {
+	p, err := resolvePath(s, args[0])
+	if err != nil {
+		return err
+	}
+
+	if p.Bucket != s.Bucket {
+		if exists, err := s.Store.BucketExists(p.Bucket); err != nil {
 			return err
+		} else if !exists {
+			return fmt.Errorf("bucket %q does not exist", p.Bucket)
 		}
-		if isFile {
-			return fmt.Errorf("%q is a file", args[0])
-		} else if !isDir {
-			return fmt.Errorf("Directory %q not found", args[0])
-		}
+	}
 
-		currentPrefix += args[0]
-		if !strings.HasSuffix(currentPrefix, "/") {
-			currentPrefix += "/"
-		}
+	isFile, isDir, _, err := stat(s, p.Bucket, p.Key)
+	if err != nil {
+		return err
+	}
+	if isFile {
+		return fmt.Errorf("%q is a file", args[0])
+	} else if !isDir {
+		return fmt.Errorf("Directory %q not found", args[0])
 	}
 
+	s.Bucket = p.Bucket
+	s.Prefix = p.Dir()
 	return nil
 }
 
-func ls(args []string) error {
-	if err := checkArgs(args, argOptions{ArgLabels: []string{"dir name"}, MinArgs: 0, RequireBucket: false}); err != nil {
+func ls(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"-l", "--versions"}})
+	if err != nil {
+		return err
+	}
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"dir name"}, MinArgs: 0, RequireBucket: false}); err != nil {
 		return err
 	}
 
-	if len(currentBucket) == 0 {
+	if len(s.Bucket) == 0 && (len(args) == 0 || !isBucketPath(args[0])) {
 		printlnf("No bucket entered yet. Listing buckets instead")
-		return list([]string{"bucket"})
+		return list(s, []string{"bucket"})
 	}
 
-	prefix := currentPrefix
+	dir := "."
 	if len(args) > 0 {
-		if strings.HasSuffix(prefix, "/") {
-			prefix = args[0]
-		} else {
-			prefix = args[0] + "/"
+		dir = args[0]
+		//TODO check existence
+	}
+	p, err := resolvePath(s, dir)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := flags["--versions"]; ok {
+		return printVersions(s, p)
+	}
+
+	var details func(minio.ObjectInfo) string
+	if _, ok := flags["-l"]; ok {
+		// tags are not part of the listing and need one request per object
+		details = func(obj minio.ObjectInfo) string {
+			tags, err := s.Store.GetObjectTags(p.Bucket, obj.Key)
+			if err != nil || len(tags) == 0 {
+				return ""
+			}
+			return fmt.Sprintf("  %s[%s]%s", colorPrefix, formatTags(tags), colorEnd)
 		}
+	}
 
-		//TODO check existence
+	if hasGlob(p.Key) {
+		prefix, list, err := globObjects(s, p)
+		if err != nil {
+			return err
+		}
+		printObjectList(list, prefix, nil, details)
+		return nil
 	}
 
-	return printObjects(prefix, nil, nil)
+	return printObjects(s, p.Bucket, p.Dir(), nil, nil, details)
 }
 
-func rm(args []string) error {
-	if err := checkArgs(args, argOptions{ArgLabels: []string{"object name", "arg"}, MinArgs: 1, RequireBucket: true}); err != nil {
+func rm(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"-r", "-n"}, Value: []string{"-j", "--version-id"}})
+	if err != nil {
+		return err
+	}
+	dryRun := isDryRun(s, flags)
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"object name"}, MinArgs: 1, RequireBucket: false, Mutating: !dryRun}); err != nil {
 		return err
 	}
 
-	prefix := currentPrefix + args[0]
-	isFile, isDir, _, err := stat(prefix)
+	p, err := resolvePath(s, args[0])
+	if err != nil {
+		return err
+	}
+	if p.IsRoot() {
+		return fmt.Errorf("Refusing to remove the bucket root. Use \"rmbucket {name}\" to delete a bucket")
+	}
+	if versionID, ok := flags["--version-id"]; ok {
+		// old versions and delete markers are not visible in the listing, so the object is not checked here
+		return removeVersion(s, p, versionID, dryRun)
+	}
+
+	isFile, isDir, _, err := stat(s, p.Bucket, p.Key)
 	if err != nil {
 		return err
 	}
 
 	//TODO go back to parent dir if dir is now gone
 	if isFile {
-		err := minioClient.RemoveObject(currentBucket, prefix)
+		if dryRun {
+			printDryRun(printlnf, "delete", p.Key)
+			return nil
+		}
+
+		err := s.Store.RemoveObject(p.Bucket, p.Key)
 		if err == nil {
 			printlnf("Object %q has been deleted", args[0])
 		}
 		return err
 
-	} else if isDir {
-		if len(args) < 2 || args[1] != "-r" {
-			return fmt.Errorf("Please use \"rm {name} -r\" when deleting a directory")
+	} else if isDir || hasGlob(p.Key) {
+		if _, ok := flags["-r"]; !ok && isDir {
+			return fmt.Errorf("Please use \"rm -r {name}\" when deleting a directory")
 		}
 
-		doneCh := make(chan struct{})
-		defer close(doneCh)
+		workers, err := getWorkers(s, flags)
+		if err != nil {
+			return err
+		}
 
-		if !strings.HasSuffix(prefix, "/") {
-			prefix += "/"
+		// remove all objects with given prefix or matching the glob
+		prefix, list, err := listSelected(s, p)
+		if err != nil {
+			return err
 		}
 
-		// remove all objects with given prefix
-		objectCh := minioClient.ListObjectsV2(currentBucket, prefix, true, doneCh)
-		for obj := range objectCh {
-			if obj.Err != nil {
-				return fmt.Errorf("failed to access object: %v", obj.Err)
-			}
+		tasks := make([]task, len(list))
+		for i := range list {
+			key := list[i].Key
+			tasks[i] = task{Label: key[len(prefix):], Run: func(log func(string, ...interface{})) error {
+				if dryRun {
+					printDryRun(log, "delete", key)
+					return nil
+				}
 
-			if err := minioClient.RemoveObject(currentBucket, obj.Key); err != nil {
-				return err
-			}
+				if err := s.Store.RemoveObject(p.Bucket, key); err != nil {
+					return err
+				}
 
-			printlnf("  object %q has been deleted", obj.Key[len(prefix):])
+				log("  object %q has been deleted", key[len(prefix):])
+				return nil
+			}}
 		}
 
-		return nil
+		return runTasks(workers, tasks, nil)
 
 	} else {
 		return fmt.Errorf("Object %q does not exist", args[0])
 	}
 }
 
-func dl(args []string) error {
-	if err := checkArgs(args, argOptions{ArgLabels: []string{"source", "destination"}, MinArgs: 2, RequireBucket: true}); err != nil {
+func dl(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"--resume"}, Value: append([]string{"-j", "--version-id"}, encryptionFlags...)})
+	if err != nil {
+		return err
+	}
+	_, resume := flags["--resume"]
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"source", "destination"}, MinArgs: 2, RequireBucket: false}); err != nil {
 		return err
 	}
 
-	//TODO check object exists
+	var opts minio.GetObjectOptions
+	if opts.ServerSideEncryption, err = getEncryption(s, flags); err != nil {
+		return err
+	}
 
-	objKey := currentPrefix + args[0]
-	isFile, isDir, _, err := stat(objKey)
+	src, err := resolvePath(s, args[0])
+	if err != nil {
+		return err
+	}
+	if versionID, ok := flags["--version-id"]; ok {
+		return downloadVersion(s, src, versionID, args[1], opts)
+	}
+	isFile, isDir, size, err := stat(s, src.Bucket, src.Key)
 	if err != nil {
 		return err
 	}
 
 	if isFile {
-		printlnf("Source Object: %s", objKey)
+		printlnf("Source Object: %s", src.Key)
 
-		len, err := downloadObject(objKey, args[1])
+		bar := newProgressBar(args[0], size)
+		len, err := downloadObject(s, src.Bucket, src.Key, args[1], opts, bar, resume)
+		bar.Finish()
 		if err != nil {
 			return err
 		}
@@ -212,45 +313,54 @@ func dl(args []string) error {
 		printlnf("Completed: %s", humanize.IBytes(uint64(len)))
 		return nil
 
-	} else if isDir {
-		printlnf("Source directory: %s", objKey)
-
-		doneCh := make(chan struct{})
-		defer close(doneCh)
+	} else if isDir || hasGlob(src.Key) {
+		printlnf("Source directory: %s", globBase(src.Dir()))
 
-		prefix := objKey
-		if !strings.HasSuffix(prefix, "/") {
-			prefix += "/"
+		workers, err := getWorkers(s, flags)
+		if err != nil {
+			return err
 		}
 
-		// find all objects
-		list := make([]minio.ObjectInfo, 0)
-		objectCh := minioClient.ListObjectsV2(currentBucket, prefix, true, doneCh)
-		for obj := range objectCh {
-			if obj.Err != nil {
-				return fmt.Errorf("failed to access object: %v", obj.Err)
-			}
-
-			list = append(list, obj)
+		// find all objects, relative paths inside the local directory start at the first wildcard
+		prefix, list, err := listSelected(s, src)
+		if err != nil {
+			return err
 		}
 
 		if len(list) == 0 {
 			printlnf("Directory is empty")
 		} else {
-			var totalLen uint64
+			var totalSize int64
+			for _, obj := range list {
+				totalSize += obj.Size
+			}
 
 			localDir := args[1]
 
-			for _, obj := range list {
-				localPath := path.Join(localDir, obj.Key[len(prefix):])
-				os.MkdirAll(path.Dir(localPath), os.ModePerm)
-				printlnf("  downloading file %s", obj.Key[len(prefix):])
-				len, err := downloadObject(obj.Key, localPath)
-				if err != nil {
+			// every task writes its own entry, so no synchronization is required
+			lengths := make([]int64, len(list))
+			tasks := make([]task, len(list))
+			bar := newProgressBar(fmt.Sprintf("%d files", len(list)), totalSize)
+			for i := range list {
+				i, key := i, list[i].Key
+				tasks[i] = task{Label: key[len(prefix):], Run: func(log func(string, ...interface{})) error {
+					localPath := path.Join(localDir, key[len(prefix):])
+					os.MkdirAll(path.Dir(localPath), os.ModePerm)
+					log("  downloading file %s", key[len(prefix):])
+					n, err := downloadObject(s, src.Bucket, key, localPath, opts, bar, resume)
+					lengths[i] = n
 					return err
-				}
+				}}
+			}
+			err := runTasks(workers, tasks, bar)
+			bar.Finish()
+			if err != nil {
+				return err
+			}
 
-				totalLen += uint64(len)
+			var totalLen uint64
+			for _, n := range lengths {
+				totalLen += uint64(n)
 			}
 
 			if len(list) == 1 {
@@ -267,40 +377,224 @@ func dl(args []string) error {
 	}
 }
 
-func downloadObject(objKey, filePath string) (int64, error) {
-	obj, err := minioClient.GetObject(currentBucket, objKey, minio.GetObjectOptions{})
+// downloadObject writes the object to a local file and reports all transferred bytes to the optional progress bar. The content is written to a ".part" file first, which is continued with a ranged request if resume is set. Content encrypted on client side is decrypted, all other content is verified against the ETag and checksums of the object.
+func downloadObject(s *Session, bucket, objKey, filePath string, opts minio.GetObjectOptions, bar *progressBar, resume bool) (int64, error) {
+	info, err := s.Store.StatObject(bucket, objKey, minio.StatObjectOptions{GetObjectOptions: opts})
 	if err != nil {
 		return 0, err
 	}
+	partPath := filePath + ".part"
+	// a checkpoint is only kept for downloads that can be continued later
+	var cpPath string
+	if resume || info.Size >= multipartThreshold {
+		if cpPath, err = checkpointPath(s, "download", bucket, objKey, filePath); err != nil {
+			return 0, err
+		}
+	}
+
+	var offset, remoteOffset int64
+	if resume {
+		if offset, remoteOffset, err = resumeOffset(cpPath, partPath, info); err != nil {
+			return 0, err
+		}
+	}
+
+	var obj io.ReadCloser = ioutil.NopCloser(bytes.NewReader(nil))
+	if remoteOffset < info.Size {
+		// the options of parallel downloads must not share their headers
+		getOpts := minio.GetObjectOptions{ServerSideEncryption: opts.ServerSideEncryption}
+		if remoteOffset > 0 {
+			// the object must not have changed since the partial download
+			getOpts.SetRange(remoteOffset, 0)
+			getOpts.SetMatchETag(info.ETag)
+		}
+		if obj, err = s.Store.GetObject(bucket, objKey, getOpts); err != nil {
+			return 0, err
+		}
+	}
 	defer obj.Close()
 
-	f, err := os.Create(filePath)
+	bar.Add(remoteOffset)
+	var r io.Reader = obj
+	if bar != nil {
+		r = io.TeeReader(obj, bar)
+	}
+	// content encrypted on client side is authenticated by the decryption instead
+	verifier := newContentVerifier(info)
+	if verifier != nil {
+		if offset > 0 {
+			if err := hashPartial(verifier, partPath, offset); err != nil {
+				return 0, err
+			}
+		}
+		r = io.TeeReader(r, verifier)
+	}
+	// the local file must not be touched if the object can not be decrypted
+	if r, _, err = decryptObjectAt(s, info, r, offset); err != nil {
+		return 0, err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(partPath, flags, 0666)
 	if err != nil {
 		return 0, err
 	}
+	if offset > 0 {
+		if err := f.Truncate(offset); err != nil {
+			f.Close()
+			return 0, err
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return 0, err
+		}
+	}
+	if err := writeCheckpoint(cpPath, downloadCheckpoint{Bucket: bucket, Key: objKey, ETag: info.ETag, Size: info.Size}); err != nil {
+		f.Close()
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if len(cpPath) == 0 {
+			// nothing can continue the partial file
+			os.Remove(partPath)
+			return offset + n, fmt.Errorf("download interrupted: %s", err.Error())
+		}
+		return offset + n, fmt.Errorf("download interrupted: %s. Use \"dl --resume\" to continue", err.Error())
+	}
+	if verifier != nil {
+		if _, err := verifier.Check(); err != nil {
+			// corrupted content must not be continued by a later resume
+			os.Remove(partPath)
+			removeCheckpoint(cpPath)
+			return offset + n, fmt.Errorf("download of %q is corrupted: %s", objKey, err.Error())
+		}
+	}
+
+	if err := os.Rename(partPath, filePath); err != nil {
+		return offset + n, err
+	}
+	removeCheckpoint(cpPath)
+	return offset + n, nil
+}
+
+// hashPartial writes the first n bytes of a partial download to the verifier.
+func hashPartial(verifier io.Writer, partPath string, n int64) error {
+	f, err := os.Open(partPath)
+	if err != nil {
+		return err
+	}
 	defer f.Close()
+	_, err = io.CopyN(verifier, f, n)
+	return err
+}
 
-	//TODO download with status bar
-	return io.Copy(f, obj)
+// openObject returns the content of an object together with its headers, which are required to detect client-side encryption.
+func openObject(s *Session, bucket, objKey string, opts minio.GetObjectOptions) (io.ReadCloser, minio.ObjectInfo, error) {
+	info, err := s.Store.StatObject(bucket, objKey, minio.StatObjectOptions{GetObjectOptions: opts})
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+	obj, err := s.Store.GetObject(bucket, objKey, opts)
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+	return obj, info, nil
 }
 
-func ul(args []string) error {
-	if err := checkArgs(args, argOptions{ArgLabels: []string{"source", "destination"}, MinArgs: 2, RequireBucket: true}); err != nil {
+func ul(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"-n", "--force", "--no-clobber", "--resume"}, Value: append([]string{"-j", "--content-type", "--cache-control", "--content-disposition", "--checksum-algorithm"}, encryptionFlags...), Multi: []string{"--meta", "--tag"}})
+	if err != nil {
+		return err
+	}
+	dryRun := isDryRun(s, flags)
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"source", "destination"}, MinArgs: 2, RequireBucket: false, Mutating: !dryRun}); err != nil {
+		return err
+	}
+
+	policy, err := newOverwritePolicy(flags, dryRun)
+	if err != nil {
 		return err
 	}
 
-	//TODO overwrite checks
+	metadata, err := parseMetadataArgs(flagValues(flags, "--meta"))
+	if err != nil {
+		return err
+	}
+	for _, h := range []string{"Content-Type", "Cache-Control", "Content-Disposition"} {
+		if v, ok := flags["--"+strings.ToLower(h)]; ok {
+			metadata[h] = v
+		}
+	}
+	opts := uploadOptions{PutObjectOptions: putOptions(metadata)}
+	if opts.ServerSideEncryption, err = getEncryption(s, flags); err != nil {
+		return err
+	}
+	if opts.Checksums, err = getChecksumAlgorithms(s, flags); err != nil {
+		return err
+	}
+	_, opts.Resume = flags["--resume"]
+	tags, err := parseTagArgs(flagValues(flags, "--tag"))
+	if err != nil {
+		return err
+	}
 
 	localPath := args[0]
-	objKey := currentPrefix + args[1]
+	dst, err := resolvePath(s, args[1])
+	if err != nil {
+		return err
+	}
+	objKey := dst.Key
+	upload := func(localPath, key string, bar *progressBar) (int64, error) {
+		n, err := uploadObject(s, localPath, dst.Bucket, key, opts, bar)
+		if err == nil && len(tags) > 0 {
+			// minio-go can not send tags with the upload itself
+			err = s.Store.SetObjectTags(dst.Bucket, key, tags)
+		}
+		return n, err
+	}
 
 	if isFile, err := fs.IsFile(localPath); err != nil {
 		return err
 	} else if isFile {
+		if dst.IsRoot() {
+			return fmt.Errorf("%q is no valid object name", args[1])
+		}
+
+		dstIsFile, _, _, err := stat(s, dst.Bucket, objKey)
+		if err != nil {
+			return err
+		}
+		if dstIsFile {
+			if ok, err := policy.Allow(objKey); err != nil {
+				return err
+			} else if !ok {
+				printlnf("Object %q already exists and has been skipped", args[1])
+				return nil
+			}
+		}
 
 		printlnf("Upload local file to: %s", objKey)
 
-		len, err := uploadObject(localPath, objKey)
+		if dryRun {
+			printDryRun(printlnf, writeAction(map[string]bool{objKey: dstIsFile}, objKey), objKey)
+			return nil
+		}
+
+		var size int64
+		if fi, err := os.Stat(localPath); err == nil {
+			size = fi.Size()
+		}
+
+		bar := newProgressBar(path.Base(localPath), size)
+		len, err := upload(localPath, objKey, bar)
+		bar.Finish()
 		if err != nil {
 			return err
 		}
@@ -313,221 +607,353 @@ func ul(args []string) error {
 		return err
 	} else if isDir {
 
-		prefix := objKey
-		if !strings.HasSuffix(prefix, "/") {
-			prefix += "/"
-		}
+		prefix := dst.Dir()
 		printlnf("Upload local directory to: %s", objKey)
 
+		workers, err := getWorkers(s, flags)
+		if err != nil {
+			return err
+		}
+
 		localPrefix, _ := path.Abs(localPath)
 		if !strings.HasSuffix(localPrefix, "/") {
 			localPrefix += "/"
 		}
 
-		var totalLen uint64
-		if err := fs.Walk(localPath, func(dir string, f fs.FileInfo, isRoot bool) errors.Error {
-			localPath, _ := path.Abs(path.Join(dir, f.Name()))
-			key := prefix + localPath[len(localPrefix):]
+		existing := make(map[string]bool)
+		if policy.NeedsExisting() || dryRun {
+			if existing, err = remoteKeySet(s, dst.Bucket, prefix); err != nil {
+				return err
+			}
+		}
 
-			printlnf("  upload %s to %s", localPath[len(localPrefix):], key)
+		// collect all files first to know the total size for the progress bar
+		files := make([]string, 0)
+		var totalSize int64
+		var walkErr error
+		if err := fs.Walk(localPath, func(dir string, f fs.FileInfo, isRoot bool) errors.Error {
+			if f.IsDir() {
+				// directories are implicitly created by the object keys
+				return nil
+			}
 
-			len, err := uploadObject(localPath, key)
-			if err != nil {
-				return errors.Wrap(err)
+			localPath, _ := path.Abs(path.Join(dir, f.Name()))
+			if key := prefix + localPath[len(localPrefix):]; existing[key] {
+				// ask before any object is transferred to keep questions and output apart
+				if ok, err := policy.Allow(key); err != nil {
+					walkErr = err
+					return errors.Wrap(err)
+				} else if !ok {
+					printlnf("  skip existing object %q", key)
+					return nil
+				}
 			}
-			totalLen += uint64(len)
+			files = append(files, localPath)
+			totalSize += f.Size()
 			return nil
 		}, nil, nil, nil); err != nil {
+			if walkErr != nil {
+				return walkErr
+			}
 			return err
 		}
 
-		printlnf("Completed: %s", humanize.IBytes(totalLen))
-		return nil
-	}
-
-	return nil
-}
-
-func uploadObject(filePath, objKey string) (int64, error) {
-	//TODO upload with status bar
-	return minioClient.FPutObject(currentBucket, objKey, filePath, minio.PutObjectOptions{})
-}
-
-func mv(args []string) error {
-	if err := checkArgs(args, argOptions{ArgLabels: []string{"source", "destination"}, MinArgs: 2, RequireBucket: true}); err != nil {
-		return err
-	}
+		var bar *progressBar
+		if !dryRun {
+			bar = newProgressBar(fmt.Sprintf("%d files", len(files)), totalSize)
+		}
 
-	isFile, isDir, _, err := stat(currentPrefix + args[0])
-	if err != nil {
-		return err
-	}
+		// every task writes its own entry, so no synchronization is required
+		lengths := make([]int64, len(files))
+		tasks := make([]task, len(files))
+		for i := range files {
+			i, localPath := i, files[i]
+			key := prefix + localPath[len(localPrefix):]
+			tasks[i] = task{Label: localPath[len(localPrefix):], Run: func(log func(string, ...interface{})) error {
+				if dryRun {
+					printDryRun(log, writeAction(existing, key), key)
+					return nil
+				}
 
-	//TODO check destination
+				log("  upload %s to %s", localPath[len(localPrefix):], key)
 
-	if isFile {
-		src := minio.NewSourceInfo(currentBucket, currentPrefix+args[0], nil)
-		dst, err := minio.NewDestinationInfo(currentBucket, currentPrefix+args[1], nil, nil)
+				n, err := upload(localPath, key, bar)
+				lengths[i] = n
+				return err
+			}}
+		}
+		err = runTasks(workers, tasks, bar)
+		bar.Finish()
 		if err != nil {
 			return err
 		}
 
-		//TODO how to move to parent dir?
-
-		// S3 does not support renaming -> copy and delte old one instead
-		if err := minioClient.CopyObject(dst, src); err != nil {
-			return fmt.Errorf("Failed to clone object: %s", err.Error())
+		if dryRun {
+			return nil
 		}
 
-		if err := minioClient.RemoveObject(currentBucket, currentPrefix+args[0]); err != nil {
-			return fmt.Errorf("Unable to delete old object: %s", err.Error())
+		var totalLen uint64
+		for _, n := range lengths {
+			totalLen += uint64(n)
 		}
 
-		printlnf("Object has been moved")
+		printlnf("Completed: %s", humanize.IBytes(totalLen))
 		return nil
+	}
 
-	} else if isDir {
-		doneCh := make(chan struct{})
-		defer close(doneCh)
+	return fmt.Errorf("Local path %q does not exist", localPath)
+}
 
-		prefixSrc := currentPrefix + args[0]
-		if !strings.HasSuffix(prefixSrc, "/") {
-			prefixSrc += "/"
-		}
+// uploadOptions controls how local files are uploaded.
+type uploadOptions struct {
+	minio.PutObjectOptions
+	// Checksums are the algorithms of checksums stored as metadata in addition to the ETag.
+	Checksums []string
+	// Resume continues a previous multipart upload of the same file.
+	Resume bool
+}
 
-		prefixDst := currentPrefix + args[1]
-		if !strings.HasSuffix(prefixDst, "/") {
-			prefixDst += "/"
+// uploadObject writes a local file to the given key and reports all transferred bytes to the optional progress bar. Large files are uploaded in parts that can be resumed. Keys in encrypted locations are encrypted on client side. The ETag of the object is verified against the content sent.
+func uploadObject(s *Session, filePath, bucket, objKey string, opts uploadOptions, bar *progressBar) (int64, error) {
+	putOpts := opts.PutObjectOptions
+	encrypted := isClientEncrypted(s, bucket, objKey)
+	if len(opts.Checksums) > 0 && !encrypted {
+		// encrypted content is authenticated anyway, and checksums of the plaintext would reveal information about it
+		checksums, err := fileChecksums(filePath, opts.Checksums)
+		if err != nil {
+			return 0, err
 		}
+		addUserMetadata(&putOpts, checksums)
+	}
 
-		// find all objects
-		list := make([]minio.ObjectInfo, 0)
-		objectCh := minioClient.ListObjectsV2(currentBucket, prefixSrc, true, doneCh)
-		for obj := range objectCh {
-			if obj.Err != nil {
-				return fmt.Errorf("failed to access object: %v", obj.Err)
-			}
+	if fi, err := os.Stat(filePath); err == nil && fi.Size() >= multipartThreshold {
+		return uploadMultipart(s, filePath, bucket, objKey, putOpts, bar, opts.Resume)
+	}
 
-			list = append(list, obj)
+	var n int64
+	var sum []byte
+	var err error
+	if encrypted {
+		n, sum, err = putEncryptedFile(s, bucket, objKey, filePath, putOpts, bar)
+	} else {
+		if bar != nil {
+			putOpts.Progress = bar
 		}
+		n, sum, err = putFile(s.Store, bucket, objKey, filePath, putOpts)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, verifyUpload(s, bucket, objKey, sum, putOpts)
+}
 
-		if len(list) == 0 {
-			printlnf("Directory is empty")
-		} else {
-			var totalLen uint64
-
-			for _, obj := range list {
-				printlnf("Move file %q", obj.Key[len(prefixSrc):])
-
-				dstKey := prefixDst + obj.Key[len(prefixSrc):]
-				src := minio.NewSourceInfo(currentBucket, obj.Key, nil)
-				dst, err := minio.NewDestinationInfo(currentBucket, dstKey, nil, nil)
-				if err != nil {
-					return err
-				}
-
-				if err := minioClient.CopyObject(dst, src); err != nil {
-					return fmt.Errorf("failed to copy file %q: %s", obj.Key[len(prefixSrc):], err.Error())
-				}
+func mv(s *Session, args []string) error {
+	return copyObjects(s, args, true)
+}
 
-				if err := minioClient.RemoveObject(currentBucket, obj.Key); err != nil {
-					return fmt.Errorf("failed to delete previous file %q: %s", obj.Key[len(prefixSrc):], err.Error())
-				}
+func cp(s *Session, args []string) error {
+	return copyObjects(s, args, false)
+}
 
-				totalLen += uint64(obj.Size)
-			}
+// copyObjects copies a single object or all objects of a directory to a new key and deletes the source objects if move is set. Objects are streamed through the client if source and destination belong to different environments.
+func copyObjects(s *Session, args []string, move bool) error {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"-n", "--force", "--no-clobber"}, Value: append([]string{"-j", "--source-sse-c-key"}, encryptionFlags...)})
+	if err != nil {
+		return err
+	}
+	dryRun := isDryRun(s, flags)
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"source", "destination"}, MinArgs: 2, RequireBucket: false}); err != nil {
+		return err
+	}
 
-			if len(list) == 1 {
-				printlnf("Completed: %s (%d file)", humanize.IBytes(totalLen), len(list))
-			} else {
-				printlnf("Completed: %s (%d files)", humanize.IBytes(totalLen), len(list))
-			}
+	srcSession, src, err := resolveSessionPath(s, args[0])
+	if err != nil {
+		return err
+	}
+	dstSession, dst, err := resolveSessionPath(s, args[1])
+	if err != nil {
+		return err
+	}
+	crossEnv := srcSession != dstSession
+	if !dryRun {
+		if dstSession.Target.ReadOnly {
+			return errReadOnly(dstSession)
+		}
+		if move && srcSession.Target.ReadOnly {
+			return errReadOnly(srcSession)
 		}
-		return nil
-
-	} else {
-		return fmt.Errorf("Object %q does not exist", args[0])
 	}
-}
 
-func cp(args []string) error {
-	if err := checkArgs(args, argOptions{ArgLabels: []string{"source", "destination"}, MinArgs: 2, RequireBucket: true}); err != nil {
+	// the encryption defaults of the destination environment apply
+	var opts copyOptions
+	if opts.Encryption, err = getEncryption(dstSession, flags); err != nil {
+		return err
+	}
+	if opts.SourceEncryption, err = getSourceEncryption(flags, opts.Encryption); err != nil {
 		return err
 	}
+	// servers only copy objects within their own endpoint, streamed copies are encrypted on the client like uploads
+	checkCopy := func(srcKey, dstKey string) error {
+		if crossEnv {
+			return nil
+		}
+		return checkClientCopy(srcSession, src.Bucket, srcKey, dst.Bucket, dstKey, opts)
+	}
+	copyObject := func(srcKey, dstKey string) error {
+		if crossEnv {
+			return streamObject(srcSession, src.Bucket, srcKey, dstSession, dst.Bucket, dstKey, opts)
+		}
+		return srcSession.Store.CopyObject(src.Bucket, srcKey, dst.Bucket, dstKey, opts)
+	}
 
-	isFile, isDir, _, err := stat(currentPrefix + args[0])
+	policy, err := newOverwritePolicy(flags, dryRun)
 	if err != nil {
 		return err
 	}
 
-	//TODO check destination
+	isFile, isDir, _, err := stat(srcSession, src.Bucket, src.Key)
+	if err != nil {
+		return err
+	}
 
 	if isFile {
-		src := minio.NewSourceInfo(currentBucket, currentPrefix+args[0], nil)
-		dst, err := minio.NewDestinationInfo(currentBucket, currentPrefix+args[1], nil, nil)
+		srcKey, dstKey := src.Key, dst.Key
+		if dst.IsRoot() {
+			return fmt.Errorf("%q is no valid object name", args[1])
+		}
+		if src == dst && !crossEnv {
+			return fmt.Errorf("%q and %q are the same object", args[0], args[1])
+		}
+
+		dstIsFile, _, _, err := stat(dstSession, dst.Bucket, dstKey)
 		if err != nil {
 			return err
 		}
+		if err := checkCopy(srcKey, dstKey); err != nil {
+			return err
+		}
+		if dstIsFile {
+			if ok, err := policy.Allow(dstKey); err != nil {
+				return err
+			} else if !ok {
+				printlnf("Object %q already exists and has been skipped", args[1])
+				return nil
+			}
+		}
+
+		if dryRun {
+			printDryRun(printlnf, writeAction(map[string]bool{dstKey: dstIsFile}, dstKey), dstKey)
+			if move {
+				printDryRun(printlnf, "delete", srcKey)
+			}
+			return nil
+		}
 
-		// S3 does not support renaming -> copy and delte old one instead
-		if err := minioClient.CopyObject(dst, src); err != nil {
+		if err := copyObject(srcKey, dstKey); err != nil {
 			return fmt.Errorf("Failed to clone object: %s", err.Error())
 		}
 
-		printlnf("Object has been copied")
-		return nil
+		if move {
+			// S3 does not support renaming -> copy and delete old one instead
+			if err := srcSession.Store.RemoveObject(src.Bucket, srcKey); err != nil {
+				return fmt.Errorf("Unable to delete old object: %s", err.Error())
+			}
 
-	} else if isDir {
-		doneCh := make(chan struct{})
-		defer close(doneCh)
+			printlnf("Object has been moved")
+		} else {
+			printlnf("Object has been copied")
+		}
+		return nil
 
-		prefixSrc := currentPrefix + args[0]
-		if !strings.HasSuffix(prefixSrc, "/") {
-			prefixSrc += "/"
+	} else if isDir || hasGlob(src.Key) {
+		workers, err := getWorkers(s, flags)
+		if err != nil {
+			return err
 		}
 
-		prefixDst := currentPrefix + args[1]
-		if !strings.HasSuffix(prefixDst, "/") {
-			prefixDst += "/"
+		// find all objects, matches of a glob keep their path relative to the first wildcard
+		prefixSrc, list, err := listSelected(srcSession, src)
+		if err != nil {
+			return err
 		}
 
-		// find all objects
-		list := make([]minio.ObjectInfo, 0)
-		objectCh := minioClient.ListObjectsV2(currentBucket, prefixSrc, true, doneCh)
-		for obj := range objectCh {
-			if obj.Err != nil {
-				return fmt.Errorf("failed to access object: %v", obj.Err)
+		prefixDst := dst.Dir()
+		if src.Bucket == dst.Bucket && !crossEnv {
+			if prefixDst == prefixSrc {
+				return fmt.Errorf("%q and %q are the same directory", args[0], args[1])
+			} else if isDir && strings.HasPrefix(prefixDst, prefixSrc) {
+				return fmt.Errorf("Can not copy directory %q into itself", args[0])
 			}
+		}
 
-			list = append(list, obj)
+		existing := make(map[string]bool)
+		if policy.NeedsExisting() || dryRun {
+			if existing, err = remoteKeySet(dstSession, dst.Bucket, prefixDst); err != nil {
+				return err
+			}
 		}
 
 		if len(list) == 0 {
 			printlnf("Directory is empty")
 		} else {
 			var totalLen uint64
-
-			for _, obj := range list {
-				printlnf("Copy file %q", obj.Key[len(prefixSrc):])
-
-				dstKey := prefixDst + obj.Key[len(prefixSrc):]
-				src := minio.NewSourceInfo(currentBucket, obj.Key, nil)
-				dst, err := minio.NewDestinationInfo(currentBucket, dstKey, nil, nil)
-				if err != nil {
-					return err
-				}
-
-				if err := minioClient.CopyObject(dst, src); err != nil {
-					return fmt.Errorf("failed to copy file %q: %s", obj.Key[len(prefixSrc):], err.Error())
+			tasks := make([]task, 0, len(list))
+			for i := range list {
+				key := list[i].Key
+				dstKey := prefixDst + key[len(prefixSrc):]
+
+				// ask before any object is transferred to keep questions and output apart
+				if existing[dstKey] {
+					if ok, err := policy.Allow(dstKey); err != nil {
+						return err
+					} else if !ok {
+						printlnf("  skip existing object %q", dstKey)
+						continue
+					}
 				}
 
-				totalLen += uint64(obj.Size)
+				totalLen += uint64(list[i].Size)
+				tasks = append(tasks, task{Label: key[len(prefixSrc):], Run: func(log func(string, ...interface{})) error {
+					if err := checkCopy(key, dstKey); err != nil {
+						return err
+					}
+					if dryRun {
+						printDryRun(log, writeAction(existing, dstKey), dstKey)
+						if move {
+							printDryRun(log, "delete", key)
+						}
+						return nil
+					}
+
+					if move {
+						log("Move file %q", key[len(prefixSrc):])
+					} else {
+						log("Copy file %q", key[len(prefixSrc):])
+					}
+
+					if err := copyObject(key, dstKey); err != nil {
+						return fmt.Errorf("failed to copy file %q: %s", key[len(prefixSrc):], err.Error())
+					}
+
+					if move {
+						if err := srcSession.Store.RemoveObject(src.Bucket, key); err != nil {
+							return fmt.Errorf("failed to delete previous file %q: %s", key[len(prefixSrc):], err.Error())
+						}
+					}
+					return nil
+				}})
+			}
+			if err := runTasks(workers, tasks, nil); err != nil {
+				return err
+			}
+			if dryRun {
+				return nil
 			}
 
-			if len(list) == 1 {
-				printlnf("Completed: %s (%d file)", humanize.IBytes(totalLen), len(list))
+			if len(tasks) == 1 {
+				printlnf("Completed: %s (%d file)", humanize.IBytes(totalLen), len(tasks))
 			} else {
-				printlnf("Completed: %s (%d files)", humanize.IBytes(totalLen), len(list))
+				printlnf("Completed: %s (%d files)", humanize.IBytes(totalLen), len(tasks))
 			}
 		}
 		return nil
@@ -537,12 +963,55 @@ func cp(args []string) error {
 	}
 }
 
-func touch(args []string) error {
-	if err := checkArgs(args, argOptions{ArgLabels: []string{"object name"}, MinArgs: 1, RequireBucket: true}); err != nil {
+// streamObject copies an object between the stores of two sessions. Client-side encryption is removed with the keys of the source and applied with the keys of the destination.
+func streamObject(src *Session, srcBucket, srcKey string, dst *Session, dstBucket, dstKey string, opts copyOptions) error {
+	obj, info, err := openObject(src, srcBucket, srcKey, minio.GetObjectOptions{ServerSideEncryption: opts.SourceEncryption})
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	r, size, err := decryptObject(src, info, obj)
+	if err != nil {
+		return err
+	}
+
+	// content headers and user metadata are kept like by server-side copies, the envelope and checksums belong to the source object
+	metadata := objectMetadata(info)
+	for header := range metadata {
+		if isClientMetadata(header) {
+			delete(metadata, header)
+		}
+	}
+	putOpts := putOptions(metadata)
+	putOpts.ServerSideEncryption = opts.Encryption
+	if isClientEncrypted(dst, dstBucket, dstKey) {
+		if r, size, err = encryptUpload(dst, r, size, &putOpts); err != nil {
+			return err
+		}
+	}
+	_, err = dst.Store.PutObject(dstBucket, dstKey, r, size, putOpts)
+	return err
+}
+
+func touch(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"-n"}, Value: encryptionFlags})
+	if err != nil {
+		return err
+	}
+	dryRun := isDryRun(s, flags)
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"object name"}, MinArgs: 1, RequireBucket: false, Mutating: !dryRun}); err != nil {
+		return err
+	}
+
+	p, err := resolvePath(s, args[0])
+	if err != nil {
 		return err
 	}
+	if p.IsRoot() {
+		return fmt.Errorf("%q is no valid object name", args[0])
+	}
 
-	exists, err := exists(currentPrefix + args[0])
+	exists, err := exists(s, p.Bucket, p.Key)
 	if err != nil {
 		return err
 	}
@@ -551,8 +1020,25 @@ func touch(args []string) error {
 		return fmt.Errorf("Object %q already exists", args[0])
 	}
 
-	r := bytes.NewReader([]byte{})
-	if _, err := minioClient.PutObject(currentBucket, currentPrefix+args[0], r, 0, minio.PutObjectOptions{}); err != nil {
+	if dryRun {
+		printDryRun(printlnf, "create", p.Key)
+		return nil
+	}
+
+	// the default encryption of the environment also applies to empty objects
+	sse, err := getEncryption(s, flags)
+	if err != nil {
+		return err
+	}
+	opts := minio.PutObjectOptions{ServerSideEncryption: sse}
+	var r io.Reader = bytes.NewReader([]byte{})
+	var size int64
+	if isClientEncrypted(s, p.Bucket, p.Key) {
+		if r, size, err = encryptUpload(s, r, size, &opts); err != nil {
+			return err
+		}
+	}
+	if _, err := s.Store.PutObject(p.Bucket, p.Key, r, size, opts); err != nil {
 		return err
 	}
 
@@ -560,33 +1046,83 @@ func touch(args []string) error {
 	return nil
 }
 
-func cat(args []string) error {
-	if err := checkArgs(args, argOptions{ArgLabels: []string{"object name"}, MinArgs: 1, RequireBucket: true}); err != nil {
+func cat(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Value: append([]string{"--version-id"}, encryptionFlags...)})
+	if err != nil {
+		return err
+	}
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"object name"}, MinArgs: 1, RequireBucket: false}); err != nil {
+		return err
+	}
+	var opts minio.GetObjectOptions
+	if opts.ServerSideEncryption, err = getEncryption(s, flags); err != nil {
 		return err
 	}
 
-	isFile, isDir, _, err := stat(currentPrefix + args[0])
+	p, err := resolvePath(s, args[0])
+	if err != nil {
+		return err
+	}
+	if versionID, ok := flags["--version-id"]; ok {
+		obj, info, err := s.Store.GetObjectVersion(p.Bucket, p.Key, versionID, opts)
+		if err != nil {
+			return err
+		}
+		defer obj.Close()
+		r, size, err := decryptObject(s, info, obj)
+		if err != nil {
+			return err
+		}
+		return printContent(r, p.Key, size)
+	}
+	isFile, isDir, _, err := stat(s, p.Bucket, p.Key)
 	if err != nil {
 		return err
 	}
-	if isDir {
+	if isFile {
+		return catObject(s, p.Bucket, p.Key, opts)
+	} else if isDir {
 		return fmt.Errorf("%q is a directory", args[0])
-	} else if !isFile {
+	} else if !hasGlob(p.Key) {
 		return fmt.Errorf("File %q not found", args[0])
 	}
 
+	// print all matching objects one after another like cat in bash
+	_, list, err := globObjects(s, p)
+	if err != nil {
+		return err
+	}
+	for _, obj := range list {
+		if err := catObject(s, p.Bucket, obj.Key, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func catObject(s *Session, bucket, key string, opts minio.GetObjectOptions) error {
 	//TODO warn for large files
 
-	objKey := currentPrefix + args[0]
-	obj, err := minioClient.GetObject(currentBucket, objKey, minio.GetObjectOptions{})
+	obj, info, err := openObject(s, bucket, key, opts)
 	if err != nil {
 		return err
 	}
 	defer obj.Close()
+	r, size, err := decryptObject(s, info, obj)
+	if err != nil {
+		return err
+	}
+	return printContent(r, key, size)
+}
 
-	//TODO download with status bar
+// printContent reads the whole object content with progress and prints it afterwards.
+func printContent(obj io.Reader, key string, size int64) error {
+	bar := newProgressBar(path.Base(key), size)
 	var buffer bytes.Buffer
-	if _, err := io.Copy(&buffer, obj); err != nil {
+	_, err := io.Copy(&buffer, io.TeeReader(obj, bar))
+	// the content is printed below, so the bar must not remain visible
+	bar.Clear()
+	if err != nil {
 		return err
 	}
 
@@ -594,59 +1130,114 @@ func cat(args []string) error {
 	return nil
 }
 
-func find(args []string) error {
-	if err := checkArgs(args, argOptions{ArgLabels: []string{"needle", "prefix"}, MinArgs: 1, RequireBucket: true}); err != nil {
+func find(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"-r"}, Multi: []string{"--tag"}})
+	if err != nil {
+		return err
+	}
+	tagFilter := flagValues(flags, "--tag")
+	minArgs := 1
+	if len(tagFilter) > 0 {
+		// the needle is optional when searching for tags
+		minArgs = 0
+	}
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"needle", "prefix"}, MinArgs: minArgs, RequireBucket: false}); err != nil {
 		return err
 	}
 
-	needle := args[0]
+	var needle string
+	if len(args) > 0 {
+		needle = args[0]
+	}
 
-	prefix := currentPrefix
+	dir := "."
 	if len(args) > 1 {
-		if strings.HasSuffix(prefix, "/") {
-			prefix = args[1]
-		} else {
-			prefix = args[1] + "/"
+		dir = args[1]
+		//TODO check directory exists
+	}
+	p, err := resolvePath(s, dir)
+	if err != nil {
+		return err
+	}
+
+	// remember the tags fetched by the filter to print them without additional requests
+	findTags := make(map[string]map[string]string)
+	var details func(minio.ObjectInfo) string
+	if len(tagFilter) > 0 {
+		details = func(obj minio.ObjectInfo) string {
+			return fmt.Sprintf("  %s[%s]%s", colorPrefix, formatTags(findTags[obj.Key]), colorEnd)
 		}
+	}
 
-		//TODO check directory exists
+	filter := func(obj minio.ObjectInfo) bool {
+		parts := strings.Split(obj.Key, "/")
+		objectName := parts[len(parts)-1]
+		if len(objectName) == 0 {
+			objectName = parts[len(parts)-2]
+		}
+
+		if !strings.Contains(strings.ToLower(objectName), strings.ToLower(needle)) {
+			return false
+		}
+		if len(tagFilter) > 0 {
+			// directories have no tags
+			if strings.HasSuffix(obj.Key, "/") {
+				return false
+			}
+			tags, err := s.Store.GetObjectTags(p.Bucket, obj.Key)
+			if err != nil || !matchTags(tags, tagFilter) {
+				return false
+			}
+			findTags[obj.Key] = tags
+		}
+		return true
 	}
+	nameFormatter := func(name string) string {
+		if len(needle) == 0 {
+			return name
+		}
 
-	return printObjects(prefix,
-		func(obj minio.ObjectInfo) bool {
-			parts := strings.Split(obj.Key, "/")
-			objectName := parts[len(parts)-1]
-			if len(objectName) == 0 {
-				objectName = parts[len(parts)-2]
+		var sb strings.Builder
+		for i := 0; i < len(name); {
+			relPos := strings.Index(strings.ToLower(name[i:]), strings.ToLower(needle))
+			if relPos == -1 {
+				sb.WriteString(name[i:])
+				break
 			}
 
-			return strings.Contains(strings.ToLower(objectName), strings.ToLower(needle))
-		},
-		func(name string) string {
-			var sb strings.Builder
-			for i := 0; i < len(name); {
-				relPos := strings.Index(strings.ToLower(name[i:]), strings.ToLower(needle))
-				if relPos == -1 {
-					sb.WriteString(name[i:])
-					break
-				}
+			if relPos > 0 {
+				sb.WriteString(name[i : i+relPos])
+			}
 
-				if relPos > 0 {
-					sb.WriteString(name[i : i+relPos])
-				}
+			sb.WriteString(colorHighlight)
+			sb.WriteString(name[i+relPos : i+relPos+len(needle)])
+			sb.WriteString(colorEnd)
 
-				sb.WriteString(colorHighlight)
-				sb.WriteString(name[i+relPos : i+relPos+len(needle)])
-				sb.WriteString(colorEnd)
+			i += relPos + len(needle)
+		}
+		return sb.String()
+	}
 
-				i += relPos + len(needle)
+	if _, ok := flags["-r"]; ok {
+		list, err := listRecursive(s, p.Bucket, p.Dir())
+		if err != nil {
+			return err
+		}
+		matches := make([]minio.ObjectInfo, 0)
+		for _, obj := range list {
+			if filter(obj) {
+				matches = append(matches, obj)
 			}
-			return sb.String()
-		})
+		}
+		printObjectList(matches, p.Dir(), nameFormatter, details)
+		return nil
+	}
+
+	return printObjects(s, p.Bucket, p.Dir(), filter, nameFormatter, details)
 }
 
-func list(args []string) error {
-	if err := checkArgs(args, argOptions{ArgLabels: []string{"list type"}, MinArgs: 1, RequireBucket: false}); err != nil {
+func list(s *Session, args []string) error {
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"list type"}, MinArgs: 1, RequireBucket: false}); err != nil {
 		return err
 	}
 
@@ -654,7 +1245,7 @@ func list(args []string) error {
 	case "buckets":
 		fallthrough
 	case "bucket":
-		buckets, err := minioClient.ListBuckets()
+		buckets, err := s.Store.ListBuckets()
 		if err != nil {
 			return err
 		}
@@ -672,7 +1263,8 @@ func list(args []string) error {
 			}
 		}
 
-	//TODO env
+	case "env":
+		return printEnvironments(s.Target.Key)
 
 	default:
 		return fmt.Errorf("unkown list type %q. Possible parameters are \"bucket\", \"object\" and \"env\"", args[0])
@@ -680,32 +1272,46 @@ func list(args []string) error {
 	return nil
 }
 
-func mkbucket(args []string) error {
-	if err := checkArgs(args, argOptions{ArgLabels: []string{"bucket name"}, MinArgs: 1, RequireBucket: false}); err != nil {
+func mkbucket(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"-n"}})
+	if err != nil {
+		return err
+	}
+	dryRun := isDryRun(s, flags)
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"bucket name"}, MinArgs: 1, RequireBucket: false, Mutating: !dryRun}); err != nil {
 		return err
 	}
 
 	bucketName := args[0]
-	err := minioClient.MakeBucket(bucketName, "")
-	if err != nil {
+	if dryRun {
+		printDryRun(printlnf, "create bucket", bucketName)
+		return nil
+	}
+
+	if err := s.Store.MakeBucket(bucketName); err != nil {
 		return err
 	}
 
-	if len(currentBucket) == 0 {
-		currentBucket = bucketName
+	if len(s.Bucket) == 0 {
+		s.Bucket = bucketName
 	}
 	printlnf("bucket %q created", bucketName)
 	return nil
 }
 
-func rmbucket(args []string) error {
+func rmbucket(s *Session, args []string) error {
 	//TODO --i-know-what-i-do flag to skip questions
-	if err := checkArgs(args, argOptions{ArgLabels: []string{"bucket name"}, MinArgs: 1, RequireBucket: false}); err != nil {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"-n"}})
+	if err != nil {
+		return err
+	}
+	dryRun := isDryRun(s, flags)
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"bucket name"}, MinArgs: 1, RequireBucket: false, Mutating: !dryRun}); err != nil {
 		return err
 	}
 
 	bucketName := args[0]
-	exists, err := minioClient.BucketExists(bucketName)
+	exists, err := s.Store.BucketExists(bucketName)
 	if err != nil {
 		return err
 	}
@@ -714,6 +1320,21 @@ func rmbucket(args []string) error {
 		return fmt.Errorf("bucket %q does not exist", bucketName)
 	}
 
+	if dryRun {
+		// nothing will be deleted, so there is no need for confirmation
+		doneCh := make(chan struct{})
+		defer close(doneCh)
+
+		for obj := range s.Store.ListObjects(bucketName, "", true, doneCh) {
+			if obj.Err != nil {
+				return fmt.Errorf("failed to access object: %v", obj.Err)
+			}
+			printDryRun(printlnf, "delete", obj.Key)
+		}
+		printDryRun(printlnf, "delete bucket", bucketName)
+		return nil
+	}
+
 	printlnf("%s########################################", colorWarning)
 	printlnf("###  WARNING: POSSIBLE LOSS OF DATA  ###")
 	printlnf("########################################%s", colorEnd)
@@ -750,27 +1371,85 @@ func rmbucket(args []string) error {
 	doneCh := make(chan struct{})
 	defer close(doneCh)
 
-	objectCh := minioClient.ListObjectsV2(bucketName, "", true, doneCh)
+	objectCh := s.Store.ListObjects(bucketName, "", true, doneCh)
 	for obj := range objectCh {
 		if obj.Err != nil {
 			return fmt.Errorf("failed to access object: %v", obj.Err)
 		}
 
-		if err := minioClient.RemoveObject(bucketName, obj.Key); err != nil {
+		if err := s.Store.RemoveObject(bucketName, obj.Key); err != nil {
 			return fmt.Errorf("failed to delete object %q: %s", obj.Key, err.Error())
 		}
 	}
 
-	if err := minioClient.RemoveBucket(bucketName); err != nil {
+	if err := s.Store.RemoveBucket(bucketName); err != nil {
 		return err
 	}
 
 	printlnf("Bucket %q has been deleted", bucketName)
-	if currentBucket == bucketName {
+	if s.Bucket == bucketName {
 		// leave deleted bucket if it was entered
-		currentBucket = ""
-		currentPrefix = ""
+		s.Bucket = ""
+		s.Prefix = ""
+	}
+	return nil
+}
+
+func openEnv(sessions *Sessions, args []string) error {
+	if err := checkArgs(sessions.Current(), args, argOptions{ArgLabels: []string{"env name"}, MinArgs: 1, RequireBucket: false}); err != nil {
+		return err
+	}
+
+	if _, ok := sessions.Get(args[0]); ok {
+		printlnf("Environment %q is already open. Switching to it instead", args[0])
+		return sessions.Switch(args[0])
+	}
+
+	if err := checkEnvKey(args[0]); err != nil {
+		return err
+	}
+	target, err := loadOrCreateEnv(args[0])
+	if err != nil {
+		return err
+	}
+
+	if sessions.ReadOnly {
+		target.ReadOnly = true
+	}
+
+	s, err := NewSession(target)
+	if err != nil {
+		return err
+	}
+	s.DryRun = sessions.DryRun
+
+	if len(target.DefaultBucket) > 0 {
+		if err := enter(s, []string{target.DefaultBucket}); err != nil {
+			printlnf(err.Error())
+		}
+	}
+
+	return sessions.Add(s)
+}
+
+func switchEnv(sessions *Sessions, args []string) error {
+	if err := checkArgs(sessions.Current(), args, argOptions{ArgLabels: []string{"env name"}, MinArgs: 1, RequireBucket: false}); err != nil {
+		return err
+	}
+
+	return sessions.Switch(args[0])
+}
+
+func closeEnv(sessions *Sessions, args []string) error {
+	if err := checkArgs(sessions.Current(), args, argOptions{ArgLabels: []string{"env name"}, MinArgs: 1, RequireBucket: false}); err != nil {
+		return err
+	}
+
+	if err := sessions.Close(args[0]); err != nil {
+		return err
 	}
+
+	printlnf("Environment %q has been closed", args[0])
 	return nil
 }
 
@@ -784,58 +1463,141 @@ type argOptions struct {
 	ArgLabels     []string
 	MinArgs       int
 	RequireBucket bool
+	// Mutating commands are refused for read-only environments.
+	Mutating bool
+	// VarArgs allows any number of arguments for the last label.
+	VarArgs bool
 }
 
-func checkArgs(args []string, options argOptions) error {
-	if options.RequireBucket && len(currentBucket) == 0 {
-		return fmt.Errorf("No bucket entered yet. Please list all available buckets via \"list bucket\" and then enter a bucket using \"enter {name}\"")
+func checkArgs(s *Session, args []string, options argOptions) error {
+	if options.Mutating && s.Target.ReadOnly {
+		return errReadOnly(s)
+	}
+
+	if options.RequireBucket && len(s.Bucket) == 0 {
+		return errNoBucket()
 	}
 
 	if len(args) < options.MinArgs {
 		return fmt.Errorf("missing parameter %s", options.ArgLabels[len(args)])
 	}
-	if len(args) > len(options.ArgLabels) {
+	if len(args) > len(options.ArgLabels) && !options.VarArgs {
 		return fmt.Errorf("too many arguments")
 	}
 
 	return nil
 }
 
-func exists(key string) (bool, error) {
-	isFile, isDir, _, err := stat(key)
+// flagSet describes the flags accepted by a command. Value flags consume the following argument, Multi flags are value flags that can be repeated.
+type flagSet struct {
+	Bool  []string
+	Value []string
+	Multi []string
+}
+
+// parseFlags separates all flags from the positional arguments. Bool flags are returned with empty value. Use "--" to pass positional arguments starting with "-".
+func parseFlags(args []string, set flagSet) ([]string, map[string]string, error) {
+	positional := make([]string, 0, len(args))
+	flags := make(map[string]string)
+
+	contains := func(list []string, str string) bool {
+		for _, item := range list {
+			if item == str {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+
+		if len(args[i]) < 2 || !strings.HasPrefix(args[i], "-") {
+			positional = append(positional, args[i])
+		} else if contains(set.Bool, args[i]) {
+			flags[args[i]] = ""
+		} else if contains(set.Value, args[i]) || contains(set.Multi, args[i]) {
+			if i+1 >= len(args) {
+				return nil, nil, fmt.Errorf("missing value for flag %s", args[i])
+			}
+			if _, ok := flags[args[i]]; ok && contains(set.Multi, args[i]) {
+				flags[args[i]] += multiFlagSeparator + args[i+1]
+			} else {
+				flags[args[i]] = args[i+1]
+			}
+			i++
+		} else {
+			return nil, nil, fmt.Errorf("unknown flag %s", args[i])
+		}
+	}
+
+	return positional, flags, nil
+}
+
+// errReadOnly is returned by commands that would modify data of a read-only environment.
+func errReadOnly(s *Session) error {
+	return fmt.Errorf("environment %q is read-only. This command would modify data and has not been executed", s.Target.Key)
+}
+
+// errNoBucket is returned by commands that operate on the current bucket when no bucket has been entered.
+func errNoBucket() error {
+	return fmt.Errorf("No bucket entered yet. Please list all available buckets via \"list bucket\" and then enter a bucket using \"enter {name}\"")
+}
+
+// multiFlagSeparator joins the values of repeated flags. Line breaks can not be part of a single console argument.
+const multiFlagSeparator = "\n"
+
+// flagValues returns all values of a repeatable flag in the given order.
+func flagValues(flags map[string]string, name string) []string {
+	str, ok := flags[name]
+	if !ok {
+		return nil
+	}
+	return strings.Split(str, multiFlagSeparator)
+}
+
+func exists(s *Session, bucket, key string) (bool, error) {
+	isFile, isDir, _, err := stat(s, bucket, key)
 	if err != nil {
 		return false, err
 	}
 	return (isFile || isDir), nil
 }
 
-func isFile(key string) (bool, error) {
-	isFile, _, _, err := stat(key)
+func isFile(s *Session, bucket, key string) (bool, error) {
+	isFile, _, _, err := stat(s, bucket, key)
 	if err != nil {
 		return false, err
 	}
 	return isFile, nil
 }
 
-func isDir(key string) (bool, error) {
-	_, isDir, _, err := stat(key)
+func isDir(s *Session, bucket, key string) (bool, error) {
+	_, isDir, _, err := stat(s, bucket, key)
 	if err != nil {
 		return false, err
 	}
 	return isDir, nil
 }
 
-func stat(key string) (isFile bool, isDir bool, fileSize int64, err error) {
+func stat(s *Session, bucket, key string) (isFile bool, isDir bool, fileSize int64, err error) {
 	doneCh := make(chan struct{})
 	defer close(doneCh)
 
 	if strings.HasSuffix(key, "/") {
 		key = key[:len(key)-1]
 	}
+	if len(key) == 0 {
+		// the bucket root is always a directory
+		return false, true, 0, nil
+	}
 	dirKey := key + "/"
 	fileKey := key
 
-	objectCh := minioClient.ListObjectsV2(currentBucket, key, false, doneCh)
+	objectCh := s.Store.ListObjects(bucket, key, false, doneCh)
 	for obj := range objectCh {
 		if obj.Err != nil {
 			return false, false, 0, fmt.Errorf("failed to access object: %v", obj.Err)
@@ -851,21 +1613,33 @@ func stat(key string) (isFile bool, isDir bool, fileSize int64, err error) {
 	return false, false, 0, nil
 }
 
-func printObjects(prefix string, filter func(minio.ObjectInfo) bool, nameFormatter func(string) string) error {
+// listRecursive returns all objects with the given prefix.
+func listRecursive(s *Session, bucket, prefix string) ([]minio.ObjectInfo, error) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	list := make([]minio.ObjectInfo, 0)
+	objectCh := s.Store.ListObjects(bucket, prefix, true, doneCh)
+	for obj := range objectCh {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("failed to access object: %v", obj.Err)
+		}
+
+		list = append(list, obj)
+	}
+	return list, nil
+}
+
+func printObjects(s *Session, bucket, prefix string, filter func(minio.ObjectInfo) bool, nameFormatter func(string) string, details func(minio.ObjectInfo) string) error {
 	if filter == nil {
 		filter = func(minio.ObjectInfo) bool { return true }
 	}
-	if nameFormatter == nil {
-		nameFormatter = func(name string) string { return name }
-	}
 
 	doneCh := make(chan struct{})
 	defer close(doneCh)
 
-	hasFiles := false
-
 	list := make([]minio.ObjectInfo, 0)
-	objectCh := minioClient.ListObjectsV2(currentBucket, prefix, false, doneCh)
+	objectCh := s.Store.ListObjects(bucket, prefix, false, doneCh)
 	for obj := range objectCh {
 		if obj.Err != nil {
 			return fmt.Errorf("failed to access object: %v", obj.Err)
@@ -873,9 +1647,26 @@ func printObjects(prefix string, filter func(minio.ObjectInfo) bool, nameFormatt
 
 		if filter(obj) {
 			list = append(list, obj)
-			if !strings.HasSuffix(obj.Key, "/") {
-				hasFiles = true
-			}
+		}
+	}
+
+	printObjectList(list, prefix, nameFormatter, details)
+	return nil
+}
+
+// printObjectList prints the given objects with names relative to prefix. The optional details are appended to the names of files.
+func printObjectList(list []minio.ObjectInfo, prefix string, nameFormatter func(string) string, details func(minio.ObjectInfo) string) {
+	if nameFormatter == nil {
+		nameFormatter = func(name string) string { return name }
+	}
+	if details == nil {
+		details = func(minio.ObjectInfo) string { return "" }
+	}
+
+	hasFiles := false
+	for _, obj := range list {
+		if !strings.HasSuffix(obj.Key, "/") {
+			hasFiles = true
 		}
 	}
 
@@ -908,12 +1699,10 @@ func printObjects(prefix string, filter func(minio.ObjectInfo) bool, nameFormatt
 					sizeStr = sizeStr + "  "
 				}
 				padding := strings.Repeat(" ", 11-len(sizeStr))
-				printlnf("  F  %s%s  %s  %s", padding, sizeStr, formatDate(obj.LastModified.Local()), nameFormatter(obj.Key[len(prefix):]))
+				printlnf("  F  %s%s  %s  %s%s", padding, sizeStr, formatDate(obj.LastModified.Local()), nameFormatter(obj.Key[len(prefix):]), details(obj))
 			}
 		}
 	}
-
-	return nil
 }
 
 func formatDate(d time.Time) string {
@@ -924,8 +1713,8 @@ func formatDate(d time.Time) string {
 	return d.Format("Jan 02  2006")
 }
 
-func getBuckets() ([]string, error) {
-	buckets, err := minioClient.ListBuckets()
+func getBuckets(s *Session) ([]string, error) {
+	buckets, err := s.Store.ListBuckets()
 	if err != nil {
 		return nil, err
 	}
@@ -936,12 +1725,12 @@ func getBuckets() ([]string, error) {
 	return names, nil
 }
 
-func getRemoteFiles(prefix string) ([]string, error) {
+func getRemoteFiles(s *Session, prefix string) ([]string, error) {
 	doneCh := make(chan struct{})
 	defer close(doneCh)
 
 	list := make([]string, 0)
-	objectCh := minioClient.ListObjectsV2(currentBucket, prefix, false, doneCh)
+	objectCh := s.Store.ListObjects(s.Bucket, prefix, false, doneCh)
 	for obj := range objectCh {
 		if obj.Err != nil {
 			return nil, fmt.Errorf("failed to access object: %v", obj.Err)
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go"
+	"github.com/sbreitf1/go-console"
+)
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestSession returns an in-memory session inside bucket "b" containing objects with their key as content.
+func newTestSession(t *testing.T, keys ...string) *Session {
+	t.Helper()
+	disableProgress()
+	disableColors()
+	s, err := NewSession(S3Target{Key: "test", InMemory: true, DefaultBucket: "b"})
+	must(t, err)
+	must(t, enter(s, []string{"b"}))
+	for _, key := range keys {
+		if _, err := s.Store.PutObject("b", key, strings.NewReader(key), int64(len(key)), minio.PutObjectOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+// objectKeys returns the sorted keys of all objects in bucket "b".
+func objectKeys(s *Session) []string {
+	keys := make([]string, 0)
+	for obj := range s.Store.ListObjects("b", "", true, nil) {
+		keys = append(keys, obj.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// bufferOutput collects the console output of commands.
+type bufferOutput struct {
+	bytes.Buffer
+}
+
+func (o *bufferOutput) Print(str string) (int, error) { return o.WriteString(str) }
+func (o *bufferOutput) GetSize() (int, int, error)    { return 120, 40, nil }
+func (o *bufferOutput) SupportsColors() bool          { return false }
+
+// captureOutput returns everything printed by f.
+func captureOutput(f func() error) (string, error) {
+	out := &bufferOutput{}
+	defaultOutput := console.DefaultOutput
+	console.DefaultOutput = out
+	defer func() { console.DefaultOutput = defaultOutput }()
+	err := f()
+	return out.String(), err
+}
+
+// writeFiles creates the given files with their name as content below dir.
+func writeFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		must(t, os.MkdirAll(filepath.Dir(filePath), 0755))
+		must(t, ioutil.WriteFile(filePath, []byte(name), 0644))
+	}
+}
+
+// listedNames returns the names in the last column of all listed files and directories.
+func listedNames(out string) map[string]bool {
+	names := make(map[string]bool)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 1 && (fields[0] == "D" || fields[0] == "F") {
+			names[fields[len(fields)-1]] = true
+		}
+	}
+	return names
+}
+
+func TestLs(t *testing.T) {
+	tests := []struct {
+		args []string
+		// shown and hidden are names expected in or absent from the output
+		shown  []string
+		hidden []string
+		err    bool
+	}{
+		{[]string{}, []string{"a", "top"}, []string{"x.txt", "y.log"}, false},
+		{[]string{"a"}, []string{"x.txt", "y.log", "sub"}, []string{"top", "deep"}, false},
+		{[]string{"a/*.txt"}, []string{"x.txt"}, []string{"y.log"}, false},
+		{[]string{"/a/sub"}, []string{"deep"}, []string{"x.txt"}, false},
+		{[]string{"b:/a/./sub/../sub"}, []string{"deep"}, []string{"x.txt"}, false},
+		{[]string{"missing:/"}, nil, nil, true},
+	}
+	for _, test := range tests {
+		s := newTestSession(t, "a/x.txt", "a/y.log", "a/sub/deep", "top")
+		out, err := captureOutput(func() error { return ls(s, test.args) })
+		if (err != nil) != test.err {
+			t.Errorf("ls %v: unexpected error %v", test.args, err)
+			continue
+		}
+		names := listedNames(out)
+		for _, name := range test.shown {
+			if !names[name] {
+				t.Errorf("ls %v does not show %q:\n%s", test.args, name, out)
+			}
+		}
+		for _, name := range test.hidden {
+			if names[name] {
+				t.Errorf("ls %v shows %q:\n%s", test.args, name, out)
+			}
+		}
+	}
+}
+
+func TestRm(t *testing.T) {
+	objects := []string{"a/x.txt", "a/y.log", "a/sub/deep", "top"}
+	tests := []struct {
+		args      []string
+		remaining []string
+		err       bool
+	}{
+		{[]string{"top"}, []string{"a/sub/deep", "a/x.txt", "a/y.log"}, false},
+		{[]string{"a"}, objects, true},
+		{[]string{"a", "-r"}, []string{"top"}, false},
+		{[]string{"-r", "a/*.txt"}, []string{"a/sub/deep", "a/y.log", "top"}, false},
+		{[]string{"-n", "top"}, objects, false},
+		{[]string{"-n", "-r", "a"}, objects, false},
+		{[]string{"missing"}, objects, true},
+		{[]string{"/"}, objects, true},
+	}
+	for _, test := range tests {
+		s := newTestSession(t, objects...)
+		_, err := captureOutput(func() error { return rm(s, test.args) })
+		if (err != nil) != test.err {
+			t.Errorf("rm %v: unexpected error %v", test.args, err)
+		}
+		expected := append([]string{}, test.remaining...)
+		sort.Strings(expected)
+		if keys := objectKeys(s); fmt.Sprint(keys) != fmt.Sprint(expected) {
+			t.Errorf("rm %v left %v, expected %v", test.args, keys, expected)
+		}
+	}
+}
+
+func TestUl(t *testing.T) {
+	tests := []struct {
+		files []string
+		args  []string
+		keys  []string
+		err   bool
+	}{
+		{[]string{"f.txt"}, []string{"f.txt", "up.txt"}, []string{"up.txt"}, false},
+		{[]string{"d/1", "d/2/3"}, []string{"d", "out"}, []string{"out/1", "out/2/3"}, false},
+		{[]string{"f.txt"}, []string{"-n", "f.txt", "up.txt"}, []string{}, false},
+		{nil, []string{"missing", "up.txt"}, []string{}, true},
+	}
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "s3client-test")
+		must(t, err)
+		defer os.RemoveAll(dir)
+		writeFiles(t, dir, test.files...)
+
+		s := newTestSession(t)
+		args := append([]string{}, test.args...)
+		for i, arg := range args {
+			if !strings.HasPrefix(arg, "-") && i < len(args)-1 {
+				args[i] = filepath.Join(dir, arg)
+			}
+		}
+		_, err = captureOutput(func() error { return ul(s, args) })
+		if (err != nil) != test.err {
+			t.Errorf("ul %v: unexpected error %v", test.args, err)
+		}
+		if keys := objectKeys(s); fmt.Sprint(keys) != fmt.Sprint(test.keys) {
+			t.Errorf("ul %v created %v, expected %v", test.args, keys, test.keys)
+		}
+	}
+}
+
+func TestUlOverwrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3client-test")
+	must(t, err)
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, "f.txt")
+
+	tests := []struct {
+		flag    string
+		content string
+	}{
+		{"--force", "f.txt"},
+		{"--no-clobber", "up.txt"},
+	}
+	for _, test := range tests {
+		s := newTestSession(t, "up.txt")
+		_, err := captureOutput(func() error { return ul(s, []string{test.flag, filepath.Join(dir, "f.txt"), "up.txt"}) })
+		must(t, err)
+		obj, err := s.Store.GetObject("b", "up.txt", minio.GetObjectOptions{})
+		must(t, err)
+		data, _ := ioutil.ReadAll(obj)
+		if string(data) != test.content {
+			t.Errorf("ul %s stored %q, expected %q", test.flag, data, test.content)
+		}
+	}
+}
+
+func TestDl(t *testing.T) {
+	tests := []struct {
+		args  []string
+		files []string
+		err   bool
+	}{
+		{[]string{"top", "out.txt"}, []string{"out.txt"}, false},
+		{[]string{"a", "out"}, []string{"out/sub/deep", "out/x.txt", "out/y.log"}, false},
+		{[]string{"a/*.txt", "out"}, []string{"out/x.txt"}, false},
+		{[]string{"missing", "out.txt"}, []string{}, true},
+	}
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "s3client-test")
+		must(t, err)
+		defer os.RemoveAll(dir)
+
+		s := newTestSession(t, "a/x.txt", "a/y.log", "a/sub/deep", "top")
+		_, err = captureOutput(func() error { return dl(s, []string{test.args[0], filepath.Join(dir, test.args[1])}) })
+		if (err != nil) != test.err {
+			t.Errorf("dl %v: unexpected error %v", test.args, err)
+		}
+
+		files := make([]string, 0)
+		filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				rel, _ := filepath.Rel(dir, filePath)
+				files = append(files, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		if fmt.Sprint(files) != fmt.Sprint(test.files) {
+			t.Errorf("dl %v created %v, expected %v", test.args, files, test.files)
+		}
+		if len(files) > 0 && !test.err {
+			// downloads of single objects keep the content of the source key
+			data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(files[0])))
+			must(t, err)
+			if len(data) == 0 {
+				t.Errorf("dl %v wrote an empty file", test.args)
+			}
+		}
+	}
+}
+
+func TestCp(t *testing.T) {
+	objects := []string{"a/x.txt", "a/y.log", "top"}
+	tests := []struct {
+		args []string
+		keys []string
+		err  bool
+	}{
+		{[]string{"top", "copy"}, []string{"a/x.txt", "a/y.log", "copy", "top"}, false},
+		{[]string{"a", "c"}, []string{"a/x.txt", "a/y.log", "c/x.txt", "c/y.log", "top"}, false},
+		{[]string{"top", "s3://b/copy"}, []string{"a/x.txt", "a/y.log", "copy", "top"}, false},
+		{[]string{"a/*.log", "logs/"}, []string{"a/x.txt", "a/y.log", "logs/y.log", "top"}, false},
+		{[]string{"top", "top"}, objects, true},
+		{[]string{"-n", "top", "copy"}, objects, false},
+		{[]string{"missing", "copy"}, objects, true},
+	}
+	for _, test := range tests {
+		s := newTestSession(t, objects...)
+		_, err := captureOutput(func() error { return cp(s, test.args) })
+		if (err != nil) != test.err {
+			t.Errorf("cp %v: unexpected error %v", test.args, err)
+		}
+		if keys := objectKeys(s); fmt.Sprint(keys) != fmt.Sprint(test.keys) {
+			t.Errorf("cp %v left %v, expected %v", test.args, keys, test.keys)
+		}
+	}
+
+	// copies keep the content of their source
+	s := newTestSession(t, objects...)
+	_, err := captureOutput(func() error { return cp(s, []string{"top", "copy"}) })
+	must(t, err)
+	obj, err := s.Store.GetObject("b", "copy", minio.GetObjectOptions{})
+	must(t, err)
+	if data, _ := ioutil.ReadAll(obj); string(data) != "top" {
+		t.Errorf("copy contains %q", data)
+	}
+}
+
+// newTestEnvironments returns the session of newTestSession and an open second environment "staging" with an empty bucket "b".
+func newTestEnvironments(t *testing.T, keys ...string) (*Session, *Session) {
+	t.Helper()
+	s := newTestSession(t, keys...)
+	staging, err := NewSession(S3Target{Key: "staging", InMemory: true, DefaultBucket: "b"})
+	must(t, err)
+	sessions := NewSessions(s)
+	must(t, sessions.Add(staging))
+	must(t, sessions.Switch(s.Target.Key))
+	return s, staging
+}
+
+func TestCopyBetweenEnvironments(t *testing.T) {
+	objects := []string{"a/x.txt", "a/y.log", "top"}
+	tests := []struct {
+		args []string
+		move bool
+		// keys and stagingKeys are the objects expected in both environments afterwards
+		keys        []string
+		stagingKeys []string
+		err         bool
+	}{
+		{[]string{"top", "staging:b:/copy"}, false, objects, []string{"copy"}, false},
+		{[]string{"a", "staging:b:/a"}, false, objects, []string{"a/x.txt", "a/y.log"}, false},
+		{[]string{"a/*.log", "staging:b:/logs"}, false, objects, []string{"logs/y.log"}, false},
+		{[]string{"test:b:/top", "staging:b:/top"}, false, objects, []string{"top"}, false},
+		{[]string{"top", "staging:b:/top"}, true, []string{"a/x.txt", "a/y.log"}, []string{"top"}, false},
+		{[]string{"a", "staging:b:/a"}, true, []string{"top"}, []string{"a/x.txt", "a/y.log"}, false},
+		{[]string{"-n", "top", "staging:b:/top"}, false, objects, []string{}, false},
+		{[]string{"top", "prod:b:/top"}, false, objects, []string{}, true},
+		{[]string{"missing", "staging:b:/copy"}, false, objects, []string{}, true},
+	}
+	for _, test := range tests {
+		s, staging := newTestEnvironments(t, objects...)
+		_, err := captureOutput(func() error { return copyObjects(s, test.args, test.move) })
+		if (err != nil) != test.err {
+			t.Errorf("copy %v: unexpected error %v", test.args, err)
+		}
+		if keys := objectKeys(s); fmt.Sprint(keys) != fmt.Sprint(test.keys) {
+			t.Errorf("copy %v left %v, expected %v", test.args, keys, test.keys)
+		}
+		if keys := objectKeys(staging); fmt.Sprint(keys) != fmt.Sprint(test.stagingKeys) {
+			t.Errorf("copy %v left %v in staging, expected %v", test.args, keys, test.stagingKeys)
+		}
+	}
+
+	// paths of the same other environment are copied on its server
+	s, staging := newTestEnvironments(t, "top")
+	_, err := staging.Store.PutObject("b", "other", strings.NewReader("other"), 5, minio.PutObjectOptions{})
+	must(t, err)
+	_, err = captureOutput(func() error { return cp(s, []string{"staging:b:/other", "staging:b:/copy"}) })
+	must(t, err)
+	if keys := objectKeys(staging); fmt.Sprint(keys) != "[copy other]" {
+		t.Errorf("copy within staging left %v", keys)
+	}
+
+	// the copy is written with the settings of the destination environment
+	s, staging = newTestEnvironments(t, "top")
+	staging.Target.ReadOnly = true
+	if _, err := captureOutput(func() error { return cp(s, []string{"top", "staging:b:/top"}) }); err == nil {
+		t.Errorf("cp into a read-only environment succeeded")
+	}
+
+	dir, err := ioutil.TempDir("", "s3client-test")
+	must(t, err)
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "key")
+	must(t, ioutil.WriteFile(keyFile, bytes.Repeat([]byte{1}, 32), 0600))
+	staging.Target.ReadOnly = false
+	staging.Target.ClientEncryption = &clientEncryption{KeyFile: keyFile}
+	_, err = captureOutput(func() error { return cp(s, []string{"top", "staging:b:/top"}) })
+	must(t, err)
+	info, err := staging.Store.StatObject("b", "top", minio.StatObjectOptions{})
+	must(t, err)
+	if len(info.Metadata.Get(metaClientCipher)) == 0 {
+		t.Errorf("copy into an encrypted environment is not encrypted")
+	}
+	out, err := captureOutput(func() error { return cat(staging, []string{"b:/top"}) })
+	must(t, err)
+	if strings.TrimSpace(out) != "top" {
+		t.Errorf("encrypted copy contains %q", out)
+	}
+
+	writeFiles(t, dir, "sync/f.txt")
+	_, err = captureOutput(func() error { return syncDirs(s, []string{filepath.Join(dir, "sync"), "staging:b:/synced"}) })
+	must(t, err)
+	if keys := objectKeys(staging); fmt.Sprint(keys) != "[synced/f.txt top]" {
+		t.Errorf("sync into staging left %v", keys)
+	}
+}
+
+func TestSyncDirection(t *testing.T) {
+	tests := []struct {
+		// args use "{dir}" for the local directory
+		args []string
+		keys []string
+		err  bool
+	}{
+		{[]string{"{dir}", "b:/up"}, []string{"remote/f.txt", "up/f.txt"}, false},
+		{[]string{"{dir}", "s3://b/up"}, []string{"remote/f.txt", "up/f.txt"}, false},
+		{[]string{"--up", "{dir}", "up"}, []string{"remote/f.txt", "up/f.txt"}, false},
+		{[]string{"b:/remote", "{dir}"}, []string{"remote/f.txt"}, false},
+		{[]string{"--down", "remote", "{dir}"}, []string{"remote/f.txt"}, false},
+		{[]string{"{dir}", "up"}, []string{"remote/f.txt"}, true},
+		{[]string{"b:/remote", "b:/up"}, []string{"remote/f.txt"}, true},
+		{[]string{"--up", "--down", "{dir}", "b:/up"}, []string{"remote/f.txt"}, true},
+		{[]string{"staging:b:/", "{dir}"}, []string{"remote/f.txt"}, false},
+		{[]string{"{dir}", "staging:b:/up"}, []string{"remote/f.txt"}, false},
+	}
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "s3client-test")
+		must(t, err)
+		defer os.RemoveAll(dir)
+		writeFiles(t, dir, "f.txt")
+
+		s, _ := newTestEnvironments(t, "remote/f.txt")
+		args := make([]string, len(test.args))
+		for i, arg := range test.args {
+			args[i] = strings.Replace(arg, "{dir}", dir, 1)
+		}
+		_, err = captureOutput(func() error { return syncDirs(s, args) })
+		if (err != nil) != test.err {
+			t.Errorf("sync %v: unexpected error %v", test.args, err)
+		}
+		if keys := objectKeys(s); fmt.Sprint(keys) != fmt.Sprint(test.keys) {
+			t.Errorf("sync %v left %v, expected %v", test.args, keys, test.keys)
+		}
+	}
+}
+
+func TestDlWithoutCheckpoint(t *testing.T) {
+	configDir, err := getConfigDir()
+	must(t, err)
+	countTransfers := func() int {
+		files, _ := ioutil.ReadDir(filepath.Join(configDir, "transfers"))
+		return len(files)
+	}
+	before := countTransfers()
+
+	dir, err := ioutil.TempDir("", "s3client-test")
+	must(t, err)
+	defer os.RemoveAll(dir)
+	s := newTestSession(t, "top")
+	for _, args := range [][]string{{"top", filepath.Join(dir, "a")}, {"--resume", "top", filepath.Join(dir, "b")}} {
+		_, err := captureOutput(func() error { return dl(s, args) })
+		must(t, err)
+	}
+	if after := countTransfers(); after != before {
+		t.Errorf("downloads of an in-memory session left %d checkpoints", after-before)
+	}
+	if cpPath, err := checkpointPath(s, "download", "b", "top", filepath.Join(dir, "a")); err != nil || len(cpPath) > 0 {
+		t.Errorf("in-memory session has checkpoint path %q", cpPath)
+	}
+}
@@ -23,41 +23,64 @@ func disableColors() {
 	colorEnd = ""
 }
 
-func prepareCLE() *console.CommandLineEnvironment {
+func prepareCLE(sessions *Sessions) *console.CommandLineEnvironment {
 	cle := console.NewCommandLineEnvironment()
 	cle.Prompt = func() string {
-		if len(currentBucket) > 0 {
-			if len(currentPrefix) > 0 {
-				return fmt.Sprintf("%s{%s@%s}%s%s%s", colorTarget, currentBucket, currentTarget.Key, colorPrefix, currentPrefix, colorEnd)
+		s := sessions.Current()
+		readOnly := ""
+		if s.Target.ReadOnly {
+			readOnly = fmt.Sprintf("%s[read-only]%s", colorWarning, colorEnd)
+		}
+		if s.DryRun {
+			readOnly += fmt.Sprintf("%s[dry-run]%s", colorWarning, colorEnd)
+		}
+		if len(s.Bucket) > 0 {
+			if len(s.Prefix) > 0 {
+				return fmt.Sprintf("%s%s{%s@%s}%s%s%s", readOnly, colorTarget, s.Bucket, s.Target.Key, colorPrefix, s.Prefix, colorEnd)
 			}
-			return fmt.Sprintf("%s{%s@%s}%s", colorTarget, currentBucket, currentTarget.Key, colorEnd)
+			return fmt.Sprintf("%s%s{%s@%s}%s", readOnly, colorTarget, s.Bucket, s.Target.Key, colorEnd)
 		}
-		return fmt.Sprintf("%s{%s}%s", colorTarget, currentTarget.Key, colorEnd)
+		return fmt.Sprintf("%s%s{%s}%s", readOnly, colorTarget, s.Target.Key, colorEnd)
 	}
 
 	cle.RegisterCommand(console.NewExitCommand("exit"))
 	cle.RegisterCommand(console.NewParameterlessCommand("help", help))
-	cle.RegisterCommand(console.NewCustomCommand("enter", console.NewFixedArgCompletion(newArgBucket()), enter))
-	cle.RegisterCommand(console.NewParameterlessCommand("leave", leave))
-	cle.RegisterCommand(console.NewCustomCommand("cd", console.NewFixedArgCompletion(newArgRemoteFile(false)), cd))
-	cle.RegisterCommand(console.NewCustomCommand("ls", console.NewFixedArgCompletion(newArgRemoteFile(false)), ls))
-	cle.RegisterCommand(console.NewCustomCommand("rm", console.NewFixedArgCompletion(newArgRemoteFile(true)), rm))
-	cle.RegisterCommand(console.NewCustomCommand("dl", console.NewFixedArgCompletion(newArgRemoteFile(true), console.NewLocalFileSystemArgCompletion(true)), dl))
-	cle.RegisterCommand(console.NewCustomCommand("ul", console.NewFixedArgCompletion(console.NewLocalFileSystemArgCompletion(true), newArgRemoteFile(true)), ul))
-	cle.RegisterCommand(console.NewCustomCommand("mv", console.NewFixedArgCompletion(newArgRemoteFile(true), newArgRemoteFile(true)), mv))
-	cle.RegisterCommand(console.NewCustomCommand("cp", console.NewFixedArgCompletion(newArgRemoteFile(true), newArgRemoteFile(true)), cp))
-	cle.RegisterCommand(console.NewCustomCommand("touch", console.NewFixedArgCompletion(newArgRemoteFile(true)), touch))
-	cle.RegisterCommand(console.NewCustomCommand("cat", console.NewFixedArgCompletion(newArgRemoteFile(true)), cat))
-	cle.RegisterCommand(console.NewCustomCommand("find", console.NewFixedArgCompletion(nil, newArgRemoteFile(false)), find))
-	cle.RegisterCommand(console.NewCustomCommand("list", console.NewFixedArgCompletion(console.NewOneOfArgCompletion("bucket", "env")), list))
-	cle.RegisterCommand(console.NewCustomCommand("mkbucket", nil, mkbucket))
-	cle.RegisterCommand(console.NewCustomCommand("rmbucket", console.NewFixedArgCompletion(newArgBucket()), rmbucket))
+	cle.RegisterCommand(console.NewCustomCommand("enter", console.NewFixedArgCompletion(newArgBucket(sessions)), sessions.bind(enter)))
+	cle.RegisterCommand(console.NewParameterlessCommand("leave", sessions.bind(leave)))
+	cle.RegisterCommand(console.NewCustomCommand("cd", console.NewFixedArgCompletion(newArgRemoteFile(sessions, false)), sessions.bind(cd)))
+	cle.RegisterCommand(console.NewCustomCommand("ls", console.NewFixedArgCompletion(newArgRemoteFile(sessions, false)), sessions.bind(ls)))
+	cle.RegisterCommand(console.NewCustomCommand("rm", console.NewFixedArgCompletion(newArgRemoteFile(sessions, true)), sessions.bind(rm)))
+	cle.RegisterCommand(console.NewCustomCommand("dl", console.NewFixedArgCompletion(newArgRemoteFile(sessions, true), console.NewLocalFileSystemArgCompletion(true)), sessions.bind(dl)))
+	cle.RegisterCommand(console.NewCustomCommand("ul", console.NewFixedArgCompletion(console.NewLocalFileSystemArgCompletion(true), newArgRemoteFile(sessions, true)), sessions.bind(ul)))
+	cle.RegisterCommand(console.NewCustomCommand("mv", console.NewFixedArgCompletion(newArgRemoteFile(sessions, true), newArgRemoteFile(sessions, true)), sessions.bind(mv)))
+	cle.RegisterCommand(console.NewCustomCommand("cp", console.NewFixedArgCompletion(newArgRemoteFile(sessions, true), newArgRemoteFile(sessions, true)), sessions.bind(cp)))
+	cle.RegisterCommand(console.NewCustomCommand("sync", console.NewFixedArgCompletion(console.NewLocalFileSystemArgCompletion(false), newArgRemoteFile(sessions, false)), sessions.bind(syncDirs)))
+	cle.RegisterCommand(console.NewCustomCommand("verify", console.NewFixedArgCompletion(console.NewLocalFileSystemArgCompletion(true), newArgRemoteFile(sessions, true)), sessions.bind(verify)))
+	cle.RegisterCommand(console.NewCustomCommand("touch", console.NewFixedArgCompletion(newArgRemoteFile(sessions, true)), sessions.bind(touch)))
+	cle.RegisterCommand(console.NewCustomCommand("cat", console.NewFixedArgCompletion(newArgRemoteFile(sessions, true)), sessions.bind(cat)))
+	cle.RegisterCommand(console.NewCustomCommand("stat", console.NewFixedArgCompletion(newArgRemoteFile(sessions, true)), sessions.bind(statPath)))
+	cle.RegisterCommand(console.NewCustomCommand("setmeta", console.NewFixedArgCompletion(newArgRemoteFile(sessions, true)), sessions.bind(setmeta)))
+	cle.RegisterCommand(console.NewCustomCommand("tag", console.NewFixedArgCompletion(console.NewOneOfArgCompletion("get", "set", "rm"), newArgRemoteFile(sessions, true)), sessions.bind(tagObjects)))
+	cle.RegisterCommand(console.NewCustomCommand("versioning", console.NewFixedArgCompletion(console.NewOneOfArgCompletion("enable", "suspend", "status"), newArgBucket(sessions)), sessions.bind(versioning)))
+	cle.RegisterCommand(console.NewCustomCommand("undelete", console.NewFixedArgCompletion(newArgRemoteFile(sessions, true)), sessions.bind(undelete)))
+	cle.RegisterCommand(console.NewCustomCommand("share", console.NewFixedArgCompletion(newArgRemoteFile(sessions, true)), sessions.bind(share)))
+	cle.RegisterCommand(console.NewCustomCommand("policy", console.NewFixedArgCompletion(console.NewOneOfArgCompletion("get", "set"), newArgBucket(sessions), console.NewOneOfArgCompletion(policyPresets...)), sessions.bind(policy)))
+	cle.RegisterCommand(console.NewCustomCommand("lifecycle", console.NewFixedArgCompletion(console.NewOneOfArgCompletion("get", "set", "add", "rm"), newArgBucket(sessions), console.NewLocalFileSystemArgCompletion(true)), sessions.bind(lifecycle)))
+	cle.RegisterCommand(console.NewCustomCommand("uploads", console.NewFixedArgCompletion(console.NewOneOfArgCompletion("list", "abort"), newArgRemoteFile(sessions, true)), sessions.bind(uploads)))
+	cle.RegisterCommand(console.NewCustomCommand("find", console.NewFixedArgCompletion(nil, newArgRemoteFile(sessions, false)), sessions.bind(find)))
+	cle.RegisterCommand(console.NewCustomCommand("list", console.NewFixedArgCompletion(console.NewOneOfArgCompletion("bucket", "env")), sessions.bind(list)))
+	cle.RegisterCommand(console.NewCustomCommand("mkbucket", nil, sessions.bind(mkbucket)))
+	cle.RegisterCommand(console.NewCustomCommand("rmbucket", console.NewFixedArgCompletion(newArgBucket(sessions)), sessions.bind(rmbucket)))
+	cle.RegisterCommand(console.NewCustomCommand("env", console.NewFixedArgCompletion(console.NewOneOfArgCompletion("list", "show", "edit", "rename", "rm", "test", "encrypt", "decrypt", "import-aws"), newArgEnv()), func(args []string) error { return env(sessions, args) }))
+	cle.RegisterCommand(console.NewCustomCommand("open", console.NewFixedArgCompletion(newArgEnv()), func(args []string) error { return openEnv(sessions, args) }))
+	cle.RegisterCommand(console.NewCustomCommand("switch", console.NewFixedArgCompletion(newArgOpenEnv(sessions)), func(args []string) error { return switchEnv(sessions, args) }))
+	cle.RegisterCommand(console.NewCustomCommand("close", console.NewFixedArgCompletion(newArgOpenEnv(sessions)), func(args []string) error { return closeEnv(sessions, args) }))
 
 	return cle
 }
 
-func runCLE() error {
-	cle := prepareCLE()
+func runCLE(sessions *Sessions) error {
+	cle := prepareCLE(sessions)
 	return cle.Run()
 }
 
@@ -65,14 +88,16 @@ func runCLE() error {
 /* ###              arg completion              ### */
 /* ################################################ */
 
-type argBucket struct{}
+type argBucket struct {
+	sessions *Sessions
+}
 
-func newArgBucket() *argBucket {
-	return &argBucket{}
+func newArgBucket(sessions *Sessions) *argBucket {
+	return &argBucket{sessions}
 }
 
 func (a *argBucket) GetCompletionOptions(currentCommand []string, entryIndex int) []console.CompletionOption {
-	buckets, err := getBuckets()
+	buckets, err := getBuckets(a.sessions.Current())
 	if err == nil {
 		return console.PrepareCompletionOptions(buckets, true)
 	}
@@ -80,15 +105,17 @@ func (a *argBucket) GetCompletionOptions(currentCommand []string, entryIndex int
 }
 
 type argRemoteFile struct {
+	sessions  *Sessions
 	withFiles bool
 }
 
-func newArgRemoteFile(withFiles bool) *argRemoteFile {
-	return &argRemoteFile{withFiles}
+func newArgRemoteFile(sessions *Sessions, withFiles bool) *argRemoteFile {
+	return &argRemoteFile{sessions, withFiles}
 }
 
 func (a *argRemoteFile) GetCompletionOptions(currentCommand []string, entryIndex int) []console.CompletionOption {
-	files, err := getRemoteFiles(currentPrefix + currentCommand[entryIndex])
+	s := a.sessions.Current()
+	files, err := getRemoteFiles(s, s.Prefix+currentCommand[entryIndex])
 	if err == nil {
 		candidates := make([]console.CompletionOption, 0)
 		for i := range files {
@@ -99,7 +126,7 @@ func (a *argRemoteFile) GetCompletionOptions(currentCommand []string, entryIndex
 				if isDir {
 					label += parts[len(parts)-2] + "/"
 				}
-				candidates = append(candidates, console.NewLabelledCompletionOption(label, files[i][len(currentPrefix):], isDir))
+				candidates = append(candidates, console.NewLabelledCompletionOption(label, files[i][len(s.Prefix):], isDir))
 			}
 		}
 		return candidates
@@ -107,6 +134,36 @@ func (a *argRemoteFile) GetCompletionOptions(currentCommand []string, entryIndex
 	return nil
 }
 
+type argEnv struct{}
+
+func newArgEnv() *argEnv {
+	return &argEnv{}
+}
+
+func (a *argEnv) GetCompletionOptions(currentCommand []string, entryIndex int) []console.CompletionOption {
+	environments, err := getEnvironments()
+	if err == nil {
+		keys := make([]string, len(environments))
+		for i := range environments {
+			keys[i] = environments[i].Key
+		}
+		return console.PrepareCompletionOptions(keys, false)
+	}
+	return nil
+}
+
+type argOpenEnv struct {
+	sessions *Sessions
+}
+
+func newArgOpenEnv(sessions *Sessions) *argOpenEnv {
+	return &argOpenEnv{sessions}
+}
+
+func (a *argOpenEnv) GetCompletionOptions(currentCommand []string, entryIndex int) []console.CompletionOption {
+	return console.PrepareCompletionOptions(a.sessions.Keys(), false)
+}
+
 /* ################################################ */
 /* ###              read wrappers               ### */
 /* ################################################ */
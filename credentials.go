@@ -0,0 +1,331 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	secretsKDFArgon2 = "argon2id"
+	secretsKDFScrypt = "scrypt"
+	// maxPassphraseAttempts limits how often a wrong master passphrase can be entered
+	maxPassphraseAttempts = 3
+)
+
+// encryptedSecrets stores the secrets of an environment encrypted with AES-256-GCM and a key derived from the master passphrase.
+type encryptedSecrets struct {
+	KDF  string `json:"kdf"`
+	Salt string `json:"salt"`
+	// Data contains the nonce followed by the encrypted secrets.
+	Data string `json:"data"`
+}
+
+// envSecrets are the confidential settings of an environment.
+type envSecrets struct {
+	SecretKey    string `json:"secretKey"`
+	SessionToken string `json:"sessionToken,omitempty"`
+}
+
+// masterKeys caches the master passphrase, so it is only asked once per process.
+var masterKeys = struct {
+	sync.Mutex
+	passphrase []byte
+	derived    map[string][]byte
+}{derived: make(map[string][]byte)}
+
+// isLocked returns true if the secrets of an environment are encrypted and have not been unlocked yet.
+func (t S3Target) isLocked() bool {
+	return t.EncryptedSecrets != nil && len(t.SecretKey) == 0
+}
+
+// readMasterPassphrase returns the master passphrase from S3CLIENT_MASTER_PASSPHRASE for scripts or asks the user. A new passphrase has to be entered twice.
+func readMasterPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv("S3CLIENT_MASTER_PASSPHRASE"); len(passphrase) > 0 {
+		return passphrase, nil
+	}
+
+	fmt.Print("Master Passphrase> ")
+	passphrase, err := readpwNonEmpty()
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		fmt.Print("Repeat Master Passphrase> ")
+		repeated, err := readpwNonEmpty()
+		if err != nil {
+			return "", err
+		}
+		if repeated != passphrase {
+			return "", fmt.Errorf("the passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
+
+// secretsKey derives the key for the given salt from the cached master passphrase.
+func secretsKey(kdf string, salt []byte) ([]byte, error) {
+	if key, ok := masterKeys.derived[kdf+string(salt)]; ok {
+		return key, nil
+	}
+
+	var key []byte
+	switch kdf {
+	case secretsKDFArgon2:
+		key = argon2.IDKey(masterKeys.passphrase, salt, 1, 64*1024, 4, 32)
+	case secretsKDFScrypt:
+		var err error
+		if key, err = scrypt.Key(masterKeys.passphrase, salt, 1<<15, 8, 1, 32); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown key derivation %q", kdf)
+	}
+	masterKeys.derived[kdf+string(salt)] = key
+	return key, nil
+}
+
+// unlockSecrets decrypts the secrets of an environment with the master passphrase, which is asked again if it is wrong.
+func unlockSecrets(target *S3Target) error {
+	if !target.isLocked() {
+		return nil
+	}
+	masterKeys.Lock()
+	defer masterKeys.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		if masterKeys.passphrase == nil {
+			passphrase, err := readMasterPassphrase(false)
+			if err != nil {
+				return err
+			}
+			masterKeys.passphrase = []byte(passphrase)
+		}
+
+		secrets, err := openSecrets(target.EncryptedSecrets)
+		if err == nil {
+			target.SecretKey, target.SessionToken = secrets.SecretKey, secrets.SessionToken
+			return nil
+		}
+		if err != errWrongPassphrase {
+			return err
+		}
+
+		// a wrong passphrase must not be cached
+		masterKeys.passphrase = nil
+		masterKeys.derived = make(map[string][]byte)
+		if attempt == maxPassphraseAttempts || len(os.Getenv("S3CLIENT_MASTER_PASSPHRASE")) > 0 {
+			return fmt.Errorf("unable to unlock environment %q: %s", target.Key, err.Error())
+		}
+		printlnf("Wrong master passphrase, please try again")
+	}
+}
+
+var errWrongPassphrase = fmt.Errorf("wrong master passphrase")
+
+func openSecrets(encrypted *encryptedSecrets) (envSecrets, error) {
+	salt, err := base64.StdEncoding.DecodeString(encrypted.Salt)
+	if err != nil {
+		return envSecrets{}, fmt.Errorf("malformed salt: %s", err.Error())
+	}
+	data, err := base64.StdEncoding.DecodeString(encrypted.Data)
+	if err != nil {
+		return envSecrets{}, fmt.Errorf("malformed secrets: %s", err.Error())
+	}
+
+	key, err := secretsKey(encrypted.KDF, salt)
+	if err != nil {
+		return envSecrets{}, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return envSecrets{}, err
+	}
+	if len(data) < aead.NonceSize() {
+		return envSecrets{}, fmt.Errorf("malformed secrets")
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return envSecrets{}, errWrongPassphrase
+	}
+
+	var secrets envSecrets
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return envSecrets{}, fmt.Errorf("malformed secrets: %s", err.Error())
+	}
+	return secrets, nil
+}
+
+// sealSecrets encrypts the secrets of an environment with the master passphrase and removes them from the target. A new master passphrase is set if no environment is encrypted yet.
+func sealSecrets(target *S3Target) error {
+	masterKeys.Lock()
+	defer masterKeys.Unlock()
+
+	if masterKeys.passphrase == nil {
+		if err := initMasterPassphrase(); err != nil {
+			return err
+		}
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	key, err := secretsKey(secretsKDFArgon2, salt)
+	if err != nil {
+		return err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(envSecrets{SecretKey: target.SecretKey, SessionToken: target.SessionToken})
+	if err != nil {
+		return err
+	}
+
+	target.EncryptedSecrets = &encryptedSecrets{
+		KDF:  secretsKDFArgon2,
+		Salt: base64.StdEncoding.EncodeToString(salt),
+		Data: base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, nil)),
+	}
+	target.SecretKey, target.SessionToken = "", ""
+	return nil
+}
+
+// initMasterPassphrase asks for the master passphrase before secrets are encrypted. It must unlock all other encrypted environments, so a new one is only set if there are none.
+func initMasterPassphrase() error {
+	environments, err := getEnvironments()
+	if err != nil {
+		return err
+	}
+	for _, e := range environments {
+		if e.EncryptedSecrets == nil {
+			continue
+		}
+
+		passphrase, err := readMasterPassphrase(false)
+		if err != nil {
+			return err
+		}
+		masterKeys.passphrase = []byte(passphrase)
+		if _, err := openSecrets(e.EncryptedSecrets); err != nil {
+			masterKeys.passphrase = nil
+			masterKeys.derived = make(map[string][]byte)
+			return fmt.Errorf("the master passphrase must unlock all environments, but not environment %q: %s", e.Key, err.Error())
+		}
+		return nil
+	}
+
+	printlnf("Please choose the master passphrase that protects the secrets of all environments:")
+	passphrase, err := readMasterPassphrase(true)
+	if err != nil {
+		return err
+	}
+	masterKeys.passphrase = []byte(passphrase)
+	return nil
+}
+
+// isMasterMode returns true if the secrets of any environment are encrypted, so new environments are encrypted as well.
+func isMasterMode() bool {
+	environments, err := getEnvironments()
+	if err != nil {
+		return false
+	}
+	for _, e := range environments {
+		if e.EncryptedSecrets != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// encryptEnvs moves the plaintext secrets of the given or all environments into encrypted storage.
+func encryptEnvs(keys []string) error {
+	targets, err := selectEnvs(keys)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, target := range targets {
+		if len(target.SourceFile) == 0 {
+			// unreadable environment files have already been reported
+			continue
+		}
+		if target.EncryptedSecrets != nil {
+			if len(keys) > 0 {
+				printlnf("  environment %q is already encrypted", target.Key)
+			}
+			continue
+		}
+		if err := sealSecrets(&target); err != nil {
+			return err
+		}
+		if err := writeEnv(target); err != nil {
+			return err
+		}
+		printlnf("  encrypted environment %q", target.Key)
+		count++
+	}
+
+	if count == 1 {
+		printlnf("Encrypted 1 environment")
+	} else {
+		printlnf("Encrypted %d environments", count)
+	}
+	return nil
+}
+
+// decryptEnvs stores the secrets of the given environments as plaintext again.
+func decryptEnvs(keys []string) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("missing parameter env name")
+	}
+	targets, err := selectEnvs(keys)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		if target.EncryptedSecrets == nil {
+			printlnf("  environment %q is not encrypted", target.Key)
+			continue
+		}
+		if err := unlockSecrets(&target); err != nil {
+			return err
+		}
+		target.EncryptedSecrets = nil
+		if err := writeEnv(target); err != nil {
+			return err
+		}
+		printlnf("  decrypted environment %q", target.Key)
+	}
+	return nil
+}
+
+// selectEnvs loads the environments with the given keys, or all environments if no key is given.
+func selectEnvs(keys []string) ([]S3Target, error) {
+	if len(keys) == 0 {
+		return getEnvironments()
+	}
+	targets := make([]S3Target, 0, len(keys))
+	for _, key := range keys {
+		target, err := loadEnv(key)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// resetMasterKeys forgets the master passphrase of previous tests and sets the one read for the next unlock.
+func resetMasterKeys(passphrase string) func() {
+	masterKeys.passphrase = nil
+	masterKeys.derived = make(map[string][]byte)
+	previous, ok := os.LookupEnv("S3CLIENT_MASTER_PASSPHRASE")
+	os.Setenv("S3CLIENT_MASTER_PASSPHRASE", passphrase)
+	return func() {
+		masterKeys.passphrase = nil
+		masterKeys.derived = make(map[string][]byte)
+		if ok {
+			os.Setenv("S3CLIENT_MASTER_PASSPHRASE", previous)
+		} else {
+			os.Unsetenv("S3CLIENT_MASTER_PASSPHRASE")
+		}
+	}
+}
+
+// useConfigDir lets environments be stored in a new temporary directory and returns it with a function that restores the previous directory.
+func useConfigDir(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "s3client-test")
+	must(t, err)
+	previous, ok := os.LookupEnv("S3CLIENT_CONFIG_DIR")
+	os.Setenv("S3CLIENT_CONFIG_DIR", dir)
+	return dir, func() {
+		if ok {
+			os.Setenv("S3CLIENT_CONFIG_DIR", previous)
+		} else {
+			os.Unsetenv("S3CLIENT_CONFIG_DIR")
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSecretsKey(t *testing.T) {
+	defer resetMasterKeys("master")()
+	masterKeys.passphrase = []byte("master")
+	salt, otherSalt := []byte("0123456789abcdef"), []byte("fedcba9876543210")
+
+	for _, kdf := range []string{secretsKDFArgon2, secretsKDFScrypt} {
+		key, err := secretsKey(kdf, salt)
+		must(t, err)
+		if len(key) != 32 {
+			t.Errorf("%s: key has %d bytes", kdf, len(key))
+		}
+		// a cached key must be the one derived again
+		masterKeys.derived = make(map[string][]byte)
+		again, err := secretsKey(kdf, salt)
+		must(t, err)
+		if !bytes.Equal(key, again) {
+			t.Errorf("%s: derived different keys for the same salt", kdf)
+		}
+		other, err := secretsKey(kdf, otherSalt)
+		must(t, err)
+		if bytes.Equal(key, other) {
+			t.Errorf("%s: derived the same key for different salts", kdf)
+		}
+	}
+
+	argon2Key, _ := secretsKey(secretsKDFArgon2, salt)
+	scryptKey, _ := secretsKey(secretsKDFScrypt, salt)
+	if bytes.Equal(argon2Key, scryptKey) {
+		t.Errorf("argon2id and scrypt share cached keys")
+	}
+	if _, err := secretsKey("md5", salt); err == nil {
+		t.Errorf("unknown key derivation accepted")
+	}
+}
+
+func TestOpenSecrets(t *testing.T) {
+	defer resetMasterKeys("master")()
+	tests := []struct {
+		name string
+		// modify changes the sealed secrets before opening them
+		modify     func(*encryptedSecrets)
+		passphrase string
+		err        bool
+	}{
+		{"round trip", nil, "master", false},
+		{"wrong passphrase", nil, "wrong", true},
+		{"malformed salt", func(e *encryptedSecrets) { e.Salt = "!" }, "master", true},
+		{"other salt", func(e *encryptedSecrets) { e.Salt = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef")) }, "master", true},
+		{"malformed data", func(e *encryptedSecrets) { e.Data = "!" }, "master", true},
+		{"truncated nonce", func(e *encryptedSecrets) { e.Data = e.Data[:8] }, "master", true},
+		{"truncated data", func(e *encryptedSecrets) {
+			data, _ := base64.StdEncoding.DecodeString(e.Data)
+			e.Data = base64.StdEncoding.EncodeToString(data[:len(data)-1])
+		}, "master", true},
+		{"unknown key derivation", func(e *encryptedSecrets) { e.KDF = "md5" }, "master", true},
+	}
+	for _, test := range tests {
+		resetMasterKeys("master")
+		masterKeys.passphrase = []byte("master")
+		target := S3Target{Key: "test", SecretKey: "secret", SessionToken: "token"}
+		must(t, sealSecrets(&target))
+		if len(target.SecretKey) > 0 || len(target.SessionToken) > 0 {
+			t.Errorf("%s: sealed secrets are kept as plaintext", test.name)
+		}
+		if test.modify != nil {
+			test.modify(target.EncryptedSecrets)
+		}
+
+		resetMasterKeys(test.passphrase)
+		err := unlockSecrets(&target)
+		if (err != nil) != test.err {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		} else if err == nil && (target.SecretKey != "secret" || target.SessionToken != "token") {
+			t.Errorf("%s: unlocked secret key %q and session token %q", test.name, target.SecretKey, target.SessionToken)
+		} else if err != nil && (len(target.SecretKey) > 0 || len(target.SessionToken) > 0) {
+			t.Errorf("%s: failed unlock set secret key %q and session token %q", test.name, target.SecretKey, target.SessionToken)
+		}
+		if test.passphrase != "master" && masterKeys.passphrase != nil {
+			t.Errorf("%s: wrong passphrase has been cached", test.name)
+		}
+	}
+}
+
+func TestEncryptEnvs(t *testing.T) {
+	dir, restore := useConfigDir(t)
+	defer restore()
+	defer resetMasterKeys("master")()
+	for _, key := range []string{"a", "b"} {
+		data := `{"key":"` + key + `","endpoint":"localhost:9000","accessKey":"AK","secretKey":"secret-` + key + `","sessionToken":"token-` + key + `"}`
+		must(t, ioutil.WriteFile(filepath.Join(dir, key+".json"), []byte(data), 0644))
+	}
+	readFile := func(key string) (string, os.FileMode) {
+		filePath := filepath.Join(dir, key+".json")
+		data, err := ioutil.ReadFile(filePath)
+		must(t, err)
+		fi, err := os.Stat(filePath)
+		must(t, err)
+		return string(data), fi.Mode().Perm()
+	}
+
+	_, err := captureOutput(func() error { return encryptEnvs([]string{"a"}) })
+	must(t, err)
+	data, mode := readFile("a")
+	if strings.Contains(data, "secret-a") || strings.Contains(data, "token-a") || !strings.Contains(data, "encryptedSecrets") {
+		t.Errorf("encrypted environment file contains\n%s", data)
+	}
+	if mode != 0600 {
+		t.Errorf("encrypted environment file has mode %o", mode)
+	}
+	if data, _ := readFile("b"); !strings.Contains(data, "secret-b") {
+		t.Errorf("environment not selected for encryption has been changed:\n%s", data)
+	}
+
+	resetMasterKeys("wrong")
+	target, err := loadEnv("a")
+	must(t, err)
+	if err := unlockSecrets(&target); err == nil {
+		t.Errorf("environment unlocked with a wrong passphrase")
+	}
+	_, err = captureOutput(func() error { return decryptEnvs([]string{"a"}) })
+	if err == nil {
+		t.Errorf("environment decrypted with a wrong passphrase")
+	}
+
+	resetMasterKeys("master")
+	target, err = loadEnv("a")
+	must(t, err)
+	must(t, unlockSecrets(&target))
+	if target.SecretKey != "secret-a" || target.SessionToken != "token-a" {
+		t.Errorf("unlocked secret key %q and session token %q", target.SecretKey, target.SessionToken)
+	}
+
+	// the remaining environment must be encrypted with the same passphrase
+	_, err = captureOutput(func() error { return encryptEnvs(nil) })
+	must(t, err)
+	if data, _ := readFile("b"); strings.Contains(data, "secret-b") {
+		t.Errorf("environment has not been encrypted:\n%s", data)
+	}
+
+	_, err = captureOutput(func() error { return decryptEnvs([]string{"a"}) })
+	must(t, err)
+	data, mode = readFile("a")
+	if !strings.Contains(data, "secret-a") || !strings.Contains(data, "token-a") || strings.Contains(data, "encryptedSecrets") {
+		t.Errorf("decrypted environment file contains\n%s", data)
+	}
+	if mode != 0600 {
+		t.Errorf("decrypted environment file has mode %o", mode)
+	}
+}
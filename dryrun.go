@@ -0,0 +1,34 @@
+package main
+
+// isDryRun returns true when write operations must only be printed, either by the global "--dry-run" flag or by the "-n" command flag.
+func isDryRun(s *Session, flags map[string]string) bool {
+	_, ok := flags["-n"]
+	return ok || s.DryRun
+}
+
+// printDryRun reports an operation that would be executed without dry-run.
+func printDryRun(log func(string, ...interface{}), action, name string) {
+	log("  %s[dry-run]%s would %s %s", colorHighlight, colorEnd, action, name)
+}
+
+// writeAction returns the action to print in dry-run mode for writing the given key.
+func writeAction(existing map[string]bool, key string) string {
+	if existing[key] {
+		return "overwrite"
+	}
+	return "create"
+}
+
+// remoteKeySet returns all keys with the given prefix in the given bucket.
+func remoteKeySet(s *Session, bucket, prefix string) (map[string]bool, error) {
+	list, err := listRecursive(s, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool)
+	for _, obj := range list {
+		keys[obj.Key] = true
+	}
+	return keys, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/pkg/encrypt"
+)
+
+var (
+	// encryptionFlags are accepted by all commands that read or write object content.
+	encryptionFlags = []string{"--sse", "--kms-key", "--sse-c-key"}
+)
+
+// getEncryption returns the server-side encryption for a command from its flags and the environment defaults, or nil for unencrypted requests.
+func getEncryption(s *Session, flags map[string]string) (encrypt.ServerSide, error) {
+	mode := s.Target.Encryption
+	keyFile := s.Target.SSECKeyFile
+	kmsKey := s.Target.KMSKeyID
+	if str, ok := flags["--sse-c-key"]; ok {
+		// a key file alone is enough to select SSE-C
+		keyFile, mode = str, "SSE-C"
+	}
+	if str, ok := flags["--kms-key"]; ok {
+		kmsKey, mode = str, "SSE-KMS"
+	}
+	if str, ok := flags["--sse"]; ok {
+		mode = str
+	}
+
+	switch strings.ToUpper(mode) {
+	case "", "NONE":
+		return nil, nil
+	case "SSE-S3", "S3", "AES256":
+		return encrypt.NewSSE(), nil
+	case "SSE-KMS", "KMS", "AWS:KMS":
+		return encrypt.NewSSEKMS(kmsKey, nil)
+	case "SSE-C", "C":
+		if len(keyFile) == 0 {
+			return nil, fmt.Errorf("SSE-C requires a key file. Please use \"--sse-c-key {file}\" or set \"ssecKeyFile\" in the environment")
+		}
+		key, err := readKeyFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return encrypt.NewSSEC(key)
+	default:
+		return nil, fmt.Errorf("unknown encryption %q. Possible values are \"none\", \"SSE-S3\", \"SSE-KMS\" and \"SSE-C\"", mode)
+	}
+}
+
+// getSourceEncryption returns the encryption required to read the source of a server-side copy. SSE-C sources use "--source-sse-c-key" or the same key as the destination.
+func getSourceEncryption(flags map[string]string, sse encrypt.ServerSide) (encrypt.ServerSide, error) {
+	if keyFile, ok := flags["--source-sse-c-key"]; ok {
+		key, err := readKeyFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return encrypt.NewSSEC(key)
+	}
+	if sse != nil && sse.Type() == encrypt.SSEC {
+		return sse, nil
+	}
+	return nil, nil
+}
+
+// readKeyFile reads a 256 bit key for SSE-C. The file may contain the raw key or its base64 or hex encoding.
+func readKeyFile(filePath string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 32 {
+		return data, nil
+	}
+
+	str := strings.TrimSpace(string(data))
+	if key, err := base64.StdEncoding.DecodeString(str); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := hex.DecodeString(str); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, fmt.Errorf("key file %q must contain exactly 32 bytes, either raw or encoded as base64 or hex", filePath)
+}
+
+// keepEncryption returns the encryption to use when an object is copied onto itself. Without explicit encryption the current SSE-S3 or SSE-KMS encryption is kept.
+func keepEncryption(header http.Header, sse encrypt.ServerSide) (encrypt.ServerSide, error) {
+	if sse != nil {
+		return sse, nil
+	}
+	switch encryptionName(header) {
+	case "SSE-S3":
+		return encrypt.NewSSE(), nil
+	case "SSE-KMS":
+		return encrypt.NewSSEKMS(header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"), nil)
+	case "SSE-C":
+		return nil, fmt.Errorf("object is encrypted with SSE-C. Please provide the key with \"--sse-c-key {file}\"")
+	}
+	return nil, nil
+}
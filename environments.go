@@ -4,17 +4,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/user"
 	"path"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/manifoldco/promptui"
-	"github.com/sbreitf1/fs"
 )
 
+// getConfigDir returns the directory of environments and transfer checkpoints, which is "~/.s3client" unless S3CLIENT_CONFIG_DIR is set.
 func getConfigDir() (string, error) {
+	if dir := os.Getenv("S3CLIENT_CONFIG_DIR"); len(dir) > 0 {
+		return dir, nil
+	}
 	usr, err := user.Current()
 	if err != nil {
 		return "", err
@@ -77,19 +82,55 @@ func prepareEnv(key string) (S3Target, error) {
 	return target, nil
 }
 
+// envMenuOptions are offered in the environment selection next to the environments themselves.
+var envMenuOptions = []string{"show", "edit", "rename", "rm", "test", "encrypt"}
+
 func selectEnv() (S3Target, error) {
-	environments, err := getEnvironments()
-	if err != nil {
-		return S3Target{}, err
-	}
+	for {
+		environments, err := getEnvironments()
+		if err != nil {
+			return S3Target{}, err
+		}
 
-	if len(environments) == 0 {
-		return S3Target{}, fmt.Errorf("no environments saved yet. Please use \"-e {name}\" to create a new environment and use it")
-	}
-	if len(environments) == 1 {
-		return environments[0], nil
+		if len(environments) == 0 {
+			return S3Target{}, fmt.Errorf("no environments saved yet. Please use \"-e {name}\" to create a new environment and use it")
+		}
+
+		promptList := append(envPromptList(environments), "[show environment]", "[edit environment]", "[rename environment]", "[delete environment]", "[test environment]", "[encrypt environment]")
+		ui := promptui.Select{Label: "Select environment or option", Items: promptList, Size: len(promptList)}
+		index, _, err := ui.Run()
+		if err != nil {
+			return S3Target{}, err
+		}
+		if index < len(environments) {
+			return environments[index], nil
+		}
+
+		// options are applied to an environment selected in a second step before the menu is shown again
+		envIndex := 0
+		if len(environments) > 1 {
+			ui = promptui.Select{Label: "Select environment to " + envMenuOptions[index-len(environments)], Items: envPromptList(environments)}
+			if envIndex, _, err = ui.Run(); err != nil {
+				return S3Target{}, err
+			}
+		}
+		args := []string{envMenuOptions[index-len(environments)], environments[envIndex].Key}
+		if args[0] == "rename" {
+			fmt.Print("New Name> ")
+			newKey, err := readlnNonEmpty()
+			if err != nil {
+				return S3Target{}, err
+			}
+			args = append(args, newKey)
+		}
+		if err := env(nil, args); err != nil {
+			printlnf("ERR: %s", err.Error())
+		}
 	}
+}
 
+// envPromptList returns the environments as aligned list entries with their endpoint.
+func envPromptList(environments []S3Target) []string {
 	// find max key len to better align the options:
 	maxKeyLen := 0
 	for _, e := range environments {
@@ -107,13 +148,7 @@ func selectEnv() (S3Target, error) {
 		}
 		promptList[i] = fmt.Sprintf("%s%s  ->  %s", environments[i].Key, padding, endpoint)
 	}
-	ui := promptui.Select{Label: "Select environment or option", Items: promptList}
-	index, _, err := ui.Run()
-	if err != nil {
-		return S3Target{}, err
-	}
-
-	return environments[index], nil
+	return promptList
 }
 
 func loadOrCreateEnv(key string) (S3Target, error) {
@@ -161,27 +196,61 @@ func newEnv(key string, filePath string) (S3Target, error) {
 		return S3Target{}, err
 	}
 
-	data, err := json.Marshal(&target)
-	if err != nil {
+	// the credentials must only be readable by the user
+	if err := os.MkdirAll(path.Dir(filePath), 0700); err != nil {
 		return S3Target{}, err
 	}
 
-	isDir, err := fs.IsDir(path.Dir(filePath))
-	if err != nil {
+	target.SourceFile = filePath
+	if isMasterMode() {
+		// new environments are protected like the existing ones
+		target.EncryptedSecrets = &encryptedSecrets{}
+	}
+	if err := writeEnv(target); err != nil {
 		return S3Target{}, err
 	}
+	return target, nil
+}
 
-	if !isDir {
-		if err := fs.CreateDirectory(path.Dir(filePath)); err != nil {
-			return S3Target{}, err
+// writeEnv stores an environment in its source file, which is only readable by the user. Secrets of environments protected by the master passphrase are encrypted again if they have been unlocked or changed.
+func writeEnv(target S3Target) error {
+	if target.EncryptedSecrets != nil && len(target.SecretKey) > 0 {
+		if err := sealSecrets(&target); err != nil {
+			return err
 		}
+	} else if target.EncryptedSecrets != nil && len(target.EncryptedSecrets.Data) == 0 {
+		// environments with web identity have no secrets to protect
+		target.EncryptedSecrets = nil
 	}
 
-	if err := ioutil.WriteFile(filePath, data, os.ModePerm); err != nil {
+	data, err := json.MarshalIndent(&target, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(target.SourceFile, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the permissions of existing files
+	return os.Chmod(target.SourceFile, 0600)
+}
+
+// loadEnv reads the file of an existing environment.
+func loadEnv(key string) (S3Target, error) {
+	if err := checkEnvKey(key); err != nil {
+		return S3Target{}, err
+	}
+	configDir, err := getConfigDir()
+	if err != nil {
 		return S3Target{}, err
 	}
 
-	target.SourceFile = filePath
+	target, err := readEnv(path.Join(configDir, key+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return S3Target{}, fmt.Errorf("environment %q does not exist", key)
+		}
+		return S3Target{}, err
+	}
 	return target, nil
 }
 
@@ -192,14 +261,8 @@ func enterTarget(key string) (S3Target, error) {
 		return S3Target{}, err
 	}
 
-	var secure bool
-	if strings.HasPrefix(strings.ToLower(url), "http://") {
-		url = url[7:]
-		secure = false
-	} else if strings.HasPrefix(strings.ToLower(url), "https://") {
-		url = url[8:]
-		secure = true
-	} else {
+	url, secure, ok := splitScheme(url)
+	if !ok {
 		fmt.Print("Secure (yes/no)?> ")
 		str, err := readlnNonEmpty()
 		if err != nil {
@@ -223,3 +286,433 @@ func enterTarget(key string) (S3Target, error) {
 
 	return S3Target{Key: key, Endpoint: url, Secure: secure, AccessKey: accessKey, SecretKey: secretKey}, nil
 }
+
+// splitScheme removes "http://" or "https://" from an URL. The last return value is false if the URL has no scheme.
+func splitScheme(url string) (string, bool, bool) {
+	if strings.HasPrefix(strings.ToLower(url), "http://") {
+		return url[7:], false, true
+	} else if strings.HasPrefix(strings.ToLower(url), "https://") {
+		return url[8:], true, true
+	}
+	return url, false, false
+}
+
+// endpointURL returns the endpoint of an environment including its scheme.
+func endpointURL(target S3Target) string {
+	if target.Secure {
+		return "https://" + target.Endpoint
+	}
+	return "http://" + target.Endpoint
+}
+
+// maskSecret hides all but the last characters of a secret for output.
+func maskSecret(secret string) string {
+	if len(secret) == 0 {
+		return "none"
+	}
+	if len(secret) < 16 {
+		return "********"
+	}
+	return "********" + secret[len(secret)-4:]
+}
+
+// maskEnvSecret returns the masked secret key of an environment or a note that it is encrypted.
+func maskEnvSecret(target S3Target) string {
+	if target.isLocked() {
+		return "encrypted with master passphrase"
+	}
+	return maskSecret(target.SecretKey)
+}
+
+// credentialExpiration returns the expiry of temporary credentials of an environment, which is only known for assumed roles once it is open.
+func credentialExpiration(target S3Target, s *Session) (time.Time, bool) {
+	if s != nil {
+		return s.credentialExpiration()
+	}
+	if target.SessionExpiration != nil {
+		return *target.SessionExpiration, true
+	}
+	return time.Time{}, false
+}
+
+// env manages the environment files in the config directory. Changes of open environments apply when they are opened again.
+func env(sessions *Sessions, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"--force"}})
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("missing parameter action. Possible actions are \"list\", \"show\", \"edit\", \"rename\", \"rm\", \"test\", \"encrypt\", \"decrypt\" and \"import-aws\"")
+	}
+
+	// show, edit and test default to the active environment
+	action, args := args[0], args[1:]
+	key := ""
+	if sessions != nil {
+		key = sessions.Current().Target.Key
+	}
+	if len(args) > 0 {
+		key = args[0]
+	}
+
+	switch action {
+	case "list":
+		return printEnvironments(key)
+
+	case "show":
+		var s *Session
+		if sessions != nil {
+			s, _ = sessions.Get(key)
+		}
+		target, err := loadEnv(key)
+		if err != nil {
+			if s == nil || len(s.Target.SourceFile) > 0 || s.Target.InMemory {
+				return err
+			}
+			// sessions of command line flags or AWS credentials have no environment file
+			target = s.Target
+		}
+		printEnv(target, s)
+		return nil
+
+	case "edit":
+		return editEnv(sessions, key)
+
+	case "rename":
+		if len(args) < 2 {
+			return fmt.Errorf("missing parameter %s", []string{"env name", "new env name"}[len(args)])
+		}
+		return renameEnv(sessions, args[0], args[1])
+
+	case "rm":
+		if len(args) < 1 {
+			return fmt.Errorf("missing parameter env name")
+		}
+		_, force := flags["--force"]
+		return removeEnv(sessions, args[0], force)
+
+	case "test":
+		if len(args) == 0 && sessions != nil {
+			// the active session might come from command line flags or AWS credentials without environment file
+			return testSession(sessions.Current().Target, sessions.Current())
+		}
+		return testEnv(key)
+
+	case "encrypt":
+		return encryptEnvs(args)
+
+	case "decrypt":
+		return decryptEnvs(args)
+
+	case "import-aws":
+		_, force := flags["--force"]
+		return importAWSProfiles(args, force)
+
+	default:
+		return fmt.Errorf("unknown env action %q. Possible actions are \"list\", \"show\", \"edit\", \"rename\", \"rm\", \"test\", \"encrypt\", \"decrypt\" and \"import-aws\"", action)
+	}
+}
+
+// printEnvironments lists all saved environments and marks the active one.
+func printEnvironments(current string) error {
+	environments, err := getEnvironments()
+	if err != nil {
+		return err
+	}
+
+	if len(environments) == 0 {
+		printlnf("No environments found.")
+		return nil
+	}
+	if len(environments) == 1 {
+		printlnf("Found 1 environment:")
+	} else {
+		printlnf("Found %d environments:", len(environments))
+	}
+
+	for i, line := range envPromptList(environments) {
+		marker := ""
+		if environments[i].ReadOnly {
+			marker += "  read-only"
+		}
+		if environments[i].Key == current {
+			marker += fmt.Sprintf("  %scurrent%s", colorHighlight, colorEnd)
+		}
+		printlnf("  E  %s%s", line, marker)
+	}
+	return nil
+}
+
+// printEnv shows all settings of an environment with masked secrets. The lifetime of temporary credentials is taken from the open session if given.
+func printEnv(target S3Target, s *Session) {
+	printlnf("  Name:           %s", target.Key)
+	if len(target.SourceFile) > 0 {
+		printlnf("  File:           %s", target.SourceFile)
+	}
+	printlnf("  Endpoint:       %s", endpointURL(target))
+	if len(target.Region) > 0 {
+		printlnf("  Region:         %s", target.Region)
+	}
+	if target.AssumeRole == nil || len(target.AccessKey) > 0 {
+		// web identities require no access key
+		printlnf("  Access key:     %s", target.AccessKey)
+		printlnf("  Secret key:     %s", maskEnvSecret(target))
+	}
+	if len(target.SessionToken) > 0 {
+		printlnf("  Session token:  %s", maskSecret(target.SessionToken))
+	}
+	if role := target.AssumeRole; role != nil {
+		printlnf("  Assume role:    %s", role.RoleARN)
+		if len(role.WebIdentityTokenFile) > 0 {
+			printlnf("  Web identity:   %s", role.WebIdentityTokenFile)
+		}
+		printlnf("  STS endpoint:   %s", stsEndpointURL(target))
+	}
+	if expiration, ok := credentialExpiration(target, s); ok {
+		if target.AssumeRole != nil {
+			printlnf("  Credentials:    %s, refreshed automatically", formatLifetime(expiration))
+		} else {
+			printlnf("  Credentials:    %s", formatLifetime(expiration))
+		}
+	} else if target.AssumeRole != nil {
+		printlnf("  Credentials:    requested when the environment is opened")
+	}
+	if len(target.DefaultBucket) > 0 {
+		printlnf("  Default bucket: %s", target.DefaultBucket)
+	}
+	printlnf("  Read-only:      %t", target.ReadOnly)
+	if target.Workers > 0 {
+		printlnf("  Workers:        %d", target.Workers)
+	}
+	if len(target.Encryption) > 0 {
+		printlnf("  Encryption:     %s", target.Encryption)
+	}
+	if len(target.KMSKeyID) > 0 {
+		printlnf("  KMS key ID:     %s", target.KMSKeyID)
+	}
+	if len(target.SSECKeyFile) > 0 {
+		printlnf("  SSE-C key file: %s", target.SSECKeyFile)
+	}
+	if cfg := target.ClientEncryption; cfg != nil {
+		prefixes := "all objects"
+		if len(cfg.Prefixes) > 0 {
+			prefixes = strings.Join(cfg.Prefixes, ", ")
+		}
+		if len(cfg.KeyFile) > 0 {
+			printlnf("  Client-side:    %s with key file %s", prefixes, cfg.KeyFile)
+		} else {
+			printlnf("  Client-side:    %s with passphrase", prefixes)
+		}
+	}
+	if len(target.ChecksumAlgorithm) > 0 {
+		printlnf("  Checksums:      %s", target.ChecksumAlgorithm)
+	}
+}
+
+// editEnv asks for new connection settings of an environment. Empty input keeps the current value.
+func editEnv(sessions *Sessions, key string) error {
+	target, err := loadEnv(key)
+	if err != nil {
+		return err
+	}
+	printlnf("Edit environment %q. Press enter to keep the current value:", key)
+
+	url, err := readDefault("URL", endpointURL(target))
+	if err != nil {
+		return err
+	}
+	endpoint, secure, ok := splitScheme(url)
+	if !ok {
+		secure = target.Secure
+	}
+	target.Endpoint, target.Secure = endpoint, secure
+
+	oldAccessKey := target.AccessKey
+	if target.AccessKey, err = readDefault("Access Key", target.AccessKey); err != nil {
+		return err
+	}
+	// the current secret key belongs to the old access key and can not be kept
+	accessKeyChanged := target.AccessKey != oldAccessKey
+	if accessKeyChanged {
+		fmt.Print("Secret Key> ")
+	} else {
+		fmt.Printf("Secret Key [%s]> ", maskEnvSecret(target))
+	}
+	secretKey, err := readpw()
+	if err != nil {
+		return err
+	}
+	if len(secretKey) == 0 && accessKeyChanged {
+		return fmt.Errorf("a new access key requires its secret key. Environment %q has not been changed", key)
+	}
+	if len(secretKey) > 0 {
+		// a session token belongs to the replaced credentials
+		target.SecretKey, target.SessionToken, target.SessionExpiration = secretKey, "", nil
+	}
+
+	bucket, err := readDefault("Default Bucket (\"-\" for none)", target.DefaultBucket)
+	if err != nil {
+		return err
+	}
+	if bucket == "-" {
+		bucket = ""
+	}
+	target.DefaultBucket = bucket
+
+	readOnly := "no"
+	if target.ReadOnly {
+		readOnly = "yes"
+	}
+	if readOnly, err = readDefault("Read-only (yes/no)", readOnly); err != nil {
+		return err
+	}
+	target.ReadOnly = readOnly[0] == 'y' || readOnly[0] == 'Y'
+
+	if err := writeEnv(target); err != nil {
+		return err
+	}
+	printlnf("Environment %q has been saved", key)
+	if sessions != nil {
+		if _, ok := sessions.Get(key); ok {
+			printlnf("The changes apply when the environment is opened again")
+		}
+	}
+	return nil
+}
+
+// readDefault asks for a value and returns the current one on empty input.
+func readDefault(label, current string) (string, error) {
+	fmt.Printf("%s [%s]> ", label, current)
+	str, err := readln()
+	if err != nil {
+		return "", err
+	}
+	if str = strings.TrimSpace(str); len(str) == 0 {
+		return current, nil
+	}
+	return str, nil
+}
+
+// renameEnv moves an environment to a new file. Open environments can not be renamed.
+func renameEnv(sessions *Sessions, key, newKey string) error {
+	if err := checkEnvOpen(sessions, key); err != nil {
+		return err
+	}
+	target, err := loadEnv(key)
+	if err != nil {
+		return err
+	}
+	if err := checkEnvKey(newKey); err != nil {
+		return err
+	}
+	if _, err := loadEnv(newKey); err == nil {
+		return fmt.Errorf("environment %q already exists", newKey)
+	}
+
+	oldFile := target.SourceFile
+	target.Key = newKey
+	target.SourceFile = path.Join(path.Dir(oldFile), newKey+".json")
+	if err := writeEnv(target); err != nil {
+		return err
+	}
+	if err := os.Remove(oldFile); err != nil {
+		return err
+	}
+	printlnf("Environment %q has been renamed to %q", key, newKey)
+	return nil
+}
+
+// removeEnv deletes the file of an environment after asking the user. Open environments can not be removed.
+func removeEnv(sessions *Sessions, key string, force bool) error {
+	if err := checkEnvOpen(sessions, key); err != nil {
+		return err
+	}
+	target, err := loadEnv(key)
+	if err != nil {
+		return err
+	}
+
+	if !force {
+		fmt.Printf("Delete environment %q (%s)? (yes/no)> ", key, endpointURL(target))
+		str, err := readln()
+		if err != nil {
+			return err
+		}
+		if str = strings.ToLower(strings.TrimSpace(str)); str != "y" && str != "yes" {
+			return errUserAbort{}
+		}
+	}
+
+	if err := os.Remove(target.SourceFile); err != nil {
+		return err
+	}
+	printlnf("Environment %q has been deleted", key)
+	return nil
+}
+
+func checkEnvOpen(sessions *Sessions, key string) error {
+	if sessions == nil {
+		return nil
+	}
+	if _, ok := sessions.Get(key); ok {
+		return fmt.Errorf("environment %q is open. Please close it first", key)
+	}
+	return nil
+}
+
+// testEnv connects to the endpoint of a saved environment and checks the credentials and the default bucket.
+func testEnv(key string) error {
+	target, err := loadEnv(key)
+	if err != nil {
+		return err
+	}
+	return testSession(target, nil)
+}
+
+// testSession checks the endpoint, credentials and default bucket of target. The given session of target is used if not nil, otherwise a new one is connected.
+func testSession(target S3Target, s *Session) error {
+	start := time.Now()
+	if !target.InMemory {
+		// minio-go retries unreachable endpoints for minutes
+		address := target.Endpoint
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			if target.Secure {
+				address = net.JoinHostPort(address, "443")
+			} else {
+				address = net.JoinHostPort(address, "80")
+			}
+		}
+		conn, err := net.DialTimeout("tcp", address, 10*time.Second)
+		if err != nil {
+			return fmt.Errorf("endpoint %s is not reachable: %s", endpointURL(target), err.Error())
+		}
+		conn.Close()
+	}
+
+	if s == nil {
+		var err error
+		if s, err = NewSession(target); err != nil {
+			return err
+		}
+	}
+	buckets, err := s.Store.ListBuckets()
+	if err != nil && len(target.DefaultBucket) == 0 {
+		return fmt.Errorf("connection to %s failed: %s", endpointURL(target), err.Error())
+	}
+	if err == nil {
+		printlnf("Connection to %s successful: %d buckets visible (%s)", endpointURL(target), len(buckets), time.Since(start).Round(time.Millisecond))
+	}
+
+	if len(target.DefaultBucket) > 0 {
+		// credentials restricted to a single bucket might not be allowed to list all buckets
+		exists, err := s.Store.BucketExists(target.DefaultBucket)
+		if err != nil {
+			return fmt.Errorf("connection to %s failed: %s", endpointURL(target), err.Error())
+		}
+		if !exists {
+			return fmt.Errorf("default bucket %q does not exist", target.DefaultBucket)
+		}
+		printlnf("Default bucket %q is accessible (%s)", target.DefaultBucket, time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEnvTestSession(t *testing.T) {
+	var mutex sync.Mutex
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests++
+		if _, ok := r.URL.Query()["location"]; ok {
+			w.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">eu-west-3</LocationConstraint>`))
+		} else if r.URL.Path == "/" {
+			w.Write([]byte(`<ListAllMyBucketsResult><Buckets><Bucket><Name>bucket</Name><CreationDate>2020-01-01T00:00:00.000Z</CreationDate></Bucket></Buckets></ListAllMyBucketsResult>`))
+		}
+	}))
+	defer srv.Close()
+
+	// sessions of command line flags have no environment file
+	_, restore := useConfigDir(t)
+	defer restore()
+	s, err := NewSession(S3Target{Key: "flags", Endpoint: strings.TrimPrefix(srv.URL, "http://"), AccessKey: "AK", SecretKey: "SK", DefaultBucket: "bucket"})
+	must(t, err)
+	out, err := captureOutput(func() error { return env(NewSessions(s), []string{"test"}) })
+	must(t, err)
+	if !strings.Contains(out, "1 buckets visible") || !strings.Contains(out, `Default bucket "bucket" is accessible`) {
+		t.Errorf("env test printed:\n%s", out)
+	}
+	if requests == 0 {
+		t.Errorf("env test did not connect to the endpoint of the session")
+	}
+
+	// a name still selects the environment file
+	if _, err := captureOutput(func() error { return env(NewSessions(s), []string{"test", "flags"}) }); err == nil {
+		t.Errorf("env test of a missing environment file succeeded")
+	}
+}
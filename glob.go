@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/minio/minio-go"
+)
+
+// hasGlob returns true if the key contains wildcards that need to be expanded against the remote listing.
+func hasGlob(key string) bool {
+	return strings.ContainsAny(key, "*?")
+}
+
+// globBase returns the directory prefix of key up to the segment containing the first wildcard.
+func globBase(key string) string {
+	pos := strings.IndexAny(key, "*?")
+	if pos < 0 {
+		return key
+	}
+	return key[:strings.LastIndex(key[:pos], "/")+1]
+}
+
+// globPattern converts a glob to a regular expression matching whole keys. "*" and "?" do not match "/", while "**" matches across directories.
+func globPattern(key string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(key); i++ {
+		switch key[i] {
+		case '*':
+			if i+1 < len(key) && key[i+1] == '*' {
+				i++
+				if i+1 < len(key) && key[i+1] == '/' {
+					// "**/" also matches objects directly inside the parent directory
+					i++
+					sb.WriteString("(.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(key[i : i+1]))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
+
+// globObjects returns all objects matching the glob in p together with the directory prefix where the glob starts.
+func globObjects(s *Session, p remotePath) (string, []minio.ObjectInfo, error) {
+	base := globBase(p.Key)
+	pattern := globPattern(p.Key)
+
+	list, err := listRecursive(s, p.Bucket, base)
+	if err != nil {
+		return "", nil, err
+	}
+
+	matches := make([]minio.ObjectInfo, 0)
+	for _, obj := range list {
+		if !strings.HasSuffix(obj.Key, "/") && pattern.MatchString(obj.Key) {
+			matches = append(matches, obj)
+		}
+	}
+	if len(matches) == 0 {
+		return "", nil, fmt.Errorf("No objects match %q", p.Key)
+	}
+	return base, matches, nil
+}
+
+// listSelected returns all objects inside the directory or matching the glob in p and the prefix to strip for relative names.
+func listSelected(s *Session, p remotePath) (string, []minio.ObjectInfo, error) {
+	if hasGlob(p.Key) {
+		return globObjects(s, p)
+	}
+
+	prefix := p.Dir()
+	list, err := listRecursive(s, p.Bucket, prefix)
+	return prefix, list, err
+}
@@ -11,4 +11,5 @@ require (
 	github.com/sbreitf1/errors v1.1.0
 	github.com/sbreitf1/fs v0.2.2
 	github.com/sbreitf1/go-console v0.9.5
+	golang.org/x/crypto v0.0.0-20191122220453-ac88ee75c92c
 )
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// lifecycleConfiguration is the XML document of all lifecycle rules of a bucket.
+type lifecycleConfiguration struct {
+	XMLName xml.Name        `xml:"LifecycleConfiguration"`
+	Rules   []lifecycleRule `xml:"Rule"`
+}
+
+type lifecycleRule struct {
+	ID     string           `xml:"ID,omitempty"`
+	Status string           `xml:"Status"`
+	Filter *lifecycleFilter `xml:"Filter"`
+	// Prefix is the filter of rules created before filters have been introduced.
+	Prefix                         *string                       `xml:"Prefix,omitempty"`
+	Expiration                     *lifecycleExpiration          `xml:"Expiration,omitempty"`
+	Transitions                    []lifecycleTransition         `xml:"Transition,omitempty"`
+	NoncurrentVersionExpiration    *noncurrentVersionExpiration  `xml:"NoncurrentVersionExpiration,omitempty"`
+	NoncurrentVersionTransitions   []noncurrentVersionTransition `xml:"NoncurrentVersionTransition,omitempty"`
+	AbortIncompleteMultipartUpload *abortIncompleteUpload        `xml:"AbortIncompleteMultipartUpload,omitempty"`
+
+	// raw is the XML content of a rule read from a bucket. It is written back unchanged, so elements that are not modeled here are never lost.
+	raw string
+}
+
+// plainLifecycleRule has the fields of lifecycleRule without its XML methods.
+type plainLifecycleRule lifecycleRule
+
+// UnmarshalXML decodes the known elements of a rule and keeps its complete content.
+func (r *lifecycleRule) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var content struct {
+		Inner string `xml:",innerxml"`
+	}
+	if err := d.DecodeElement(&content, &start); err != nil {
+		return err
+	}
+	var rule plainLifecycleRule
+	if err := xml.Unmarshal([]byte("<Rule>"+content.Inner+"</Rule>"), &rule); err != nil {
+		return err
+	}
+	*r = lifecycleRule(rule)
+	r.raw = content.Inner
+	return nil
+}
+
+// MarshalXML writes rules read from a bucket unchanged and encodes new rules from their fields.
+func (r lifecycleRule) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if len(r.raw) > 0 {
+		return e.EncodeElement(struct {
+			Inner string `xml:",innerxml"`
+		}{r.raw}, start)
+	}
+	return e.EncodeElement(plainLifecycleRule(r), start)
+}
+
+type lifecycleFilter struct {
+	Prefix                string        `xml:"Prefix,omitempty"`
+	Tag                   *tag          `xml:"Tag,omitempty"`
+	ObjectSizeGreaterThan *int64        `xml:"ObjectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    *int64        `xml:"ObjectSizeLessThan,omitempty"`
+	And                   *lifecycleAnd `xml:"And,omitempty"`
+}
+
+type lifecycleAnd struct {
+	Prefix                string `xml:"Prefix,omitempty"`
+	Tags                  []tag  `xml:"Tag"`
+	ObjectSizeGreaterThan *int64 `xml:"ObjectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    *int64 `xml:"ObjectSizeLessThan,omitempty"`
+}
+
+type lifecycleExpiration struct {
+	Days                      int    `xml:"Days,omitempty"`
+	Date                      string `xml:"Date,omitempty"`
+	ExpiredObjectDeleteMarker bool   `xml:"ExpiredObjectDeleteMarker,omitempty"`
+}
+
+type lifecycleTransition struct {
+	// Days is a pointer because transitions after 0 days are valid
+	Days         *int   `xml:"Days,omitempty"`
+	Date         string `xml:"Date,omitempty"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type noncurrentVersionExpiration struct {
+	NoncurrentDays          int `xml:"NoncurrentDays"`
+	NewerNoncurrentVersions int `xml:"NewerNoncurrentVersions,omitempty"`
+}
+
+type noncurrentVersionTransition struct {
+	NoncurrentDays          int    `xml:"NoncurrentDays"`
+	NewerNoncurrentVersions int    `xml:"NewerNoncurrentVersions,omitempty"`
+	StorageClass            string `xml:"StorageClass"`
+}
+
+type abortIncompleteUpload struct {
+	DaysAfterInitiation int `xml:"DaysAfterInitiation"`
+}
+
+func lifecycle(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{
+		Bool:  []string{"-n", "--xml", "--disabled"},
+		Value: []string{"--id", "--prefix", "--expire-days", "--noncurrent-days", "--abort-days"},
+		Multi: []string{"--tag", "--transition"},
+	})
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("missing parameter action. Possible actions are \"get\", \"set\", \"add\" and \"rm\"")
+	}
+
+	action := args[0]
+	args = args[1:]
+	dryRun := isDryRun(s, flags)
+	switch action {
+	case "get":
+		if err := checkArgs(s, args, argOptions{ArgLabels: []string{"bucket name"}, MinArgs: 0, RequireBucket: len(args) == 0}); err != nil {
+			return err
+		}
+		bucket := s.Bucket
+		if len(args) > 0 {
+			bucket = args[0]
+		}
+		_, asXML := flags["--xml"]
+		return printLifecycle(s, bucket, asXML)
+
+	case "set":
+		if err := checkArgs(s, args, argOptions{ArgLabels: []string{"bucket name", "file"}, MinArgs: 2, Mutating: !dryRun}); err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		var config lifecycleConfiguration
+		if err := xml.Unmarshal(data, &config); err != nil {
+			return fmt.Errorf("invalid lifecycle configuration: %v", err)
+		}
+		if err := validateLifecycle(config); err != nil {
+			return err
+		}
+		return writeLifecycle(s, args[0], string(data), fmt.Sprintf("set %d lifecycle rules of bucket", len(config.Rules)), dryRun)
+
+	case "add":
+		if err := checkArgs(s, args, argOptions{ArgLabels: []string{"bucket name"}, MinArgs: 1, Mutating: !dryRun}); err != nil {
+			return err
+		}
+		rule, err := parseLifecycleRule(flags)
+		if err != nil {
+			return err
+		}
+		return addLifecycleRule(s, args[0], rule, dryRun)
+
+	case "rm":
+		if err := checkArgs(s, args, argOptions{ArgLabels: []string{"bucket name", "rule id"}, MinArgs: 1, Mutating: !dryRun}); err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			return writeLifecycle(s, args[0], "", "remove all lifecycle rules of bucket", dryRun)
+		}
+		return removeLifecycleRule(s, args[0], args[1], dryRun)
+
+	default:
+		return fmt.Errorf("unknown lifecycle action %q. Possible actions are \"get\", \"set\", \"add\" and \"rm\"", action)
+	}
+}
+
+// getLifecycle returns the parsed lifecycle configuration of a bucket, which is empty if no rules are set.
+func getLifecycle(s *Session, bucket string) (lifecycleConfiguration, string, error) {
+	str, err := s.Store.GetBucketLifecycle(bucket)
+	if err != nil {
+		return lifecycleConfiguration{}, "", err
+	}
+
+	var config lifecycleConfiguration
+	if len(str) > 0 {
+		if err := xml.Unmarshal([]byte(str), &config); err != nil {
+			return lifecycleConfiguration{}, "", err
+		}
+	}
+	return config, str, nil
+}
+
+func printLifecycle(s *Session, bucket string, asXML bool) error {
+	config, str, err := getLifecycle(s, bucket)
+	if err != nil {
+		return err
+	}
+	if len(config.Rules) == 0 {
+		printlnf("Bucket %q has no lifecycle rules", bucket)
+		return nil
+	}
+
+	if asXML {
+		// the stored configuration is printed unchanged, so it can be edited and passed to "lifecycle set" again without losing anything
+		printlnf("%s", str)
+		return nil
+	}
+
+	rows := [][]string{{"ID", "Status", "Filter", "Expiration", "Noncurrent", "Transitions", "Abort uploads"}}
+	for _, rule := range config.Rules {
+		rows = append(rows, []string{rule.ID, rule.Status, describeFilter(rule), describeExpiration(rule), describeNoncurrent(rule), describeTransitions(rule), describeAbort(rule)})
+	}
+	printTable(rows)
+	return nil
+}
+
+// printTable prints all rows with aligned columns. The first row is the highlighted header.
+func printTable(rows [][]string) {
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	for r, row := range rows {
+		var sb strings.Builder
+		for i, cell := range row {
+			sb.WriteString("  ")
+			sb.WriteString(cell)
+			if i < len(row)-1 {
+				sb.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)))
+			}
+		}
+		if r == 0 {
+			printlnf("%s%s%s", colorHighlight, sb.String(), colorEnd)
+		} else {
+			printlnf("%s", sb.String())
+		}
+	}
+}
+
+func describeFilter(rule lifecycleRule) string {
+	var prefix string
+	var tags []tag
+	var greaterThan, lessThan *int64
+	if rule.Prefix != nil {
+		prefix = *rule.Prefix
+	}
+	if rule.Filter != nil {
+		if rule.Filter.And != nil {
+			prefix, tags = rule.Filter.And.Prefix, rule.Filter.And.Tags
+			greaterThan, lessThan = rule.Filter.And.ObjectSizeGreaterThan, rule.Filter.And.ObjectSizeLessThan
+		} else {
+			prefix = rule.Filter.Prefix
+			if rule.Filter.Tag != nil {
+				tags = []tag{*rule.Filter.Tag}
+			}
+			greaterThan, lessThan = rule.Filter.ObjectSizeGreaterThan, rule.Filter.ObjectSizeLessThan
+		}
+	}
+
+	parts := make([]string, 0, len(tags)+3)
+	if len(prefix) > 0 {
+		parts = append(parts, "prefix "+prefix)
+	}
+	for _, t := range tags {
+		parts = append(parts, t.Key+"="+t.Value)
+	}
+	if greaterThan != nil {
+		parts = append(parts, fmt.Sprintf("size > %d", *greaterThan))
+	}
+	if lessThan != nil {
+		parts = append(parts, fmt.Sprintf("size < %d", *lessThan))
+	}
+	if len(parts) == 0 {
+		return "all objects"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func describeExpiration(rule lifecycleRule) string {
+	if rule.Expiration == nil {
+		return "-"
+	}
+	if rule.Expiration.Days > 0 {
+		return formatDays(rule.Expiration.Days)
+	}
+	if len(rule.Expiration.Date) > 0 {
+		return "on " + strings.SplitN(rule.Expiration.Date, "T", 2)[0]
+	}
+	if rule.Expiration.ExpiredObjectDeleteMarker {
+		return "delete markers"
+	}
+	return "-"
+}
+
+func describeNoncurrent(rule lifecycleRule) string {
+	parts := make([]string, 0)
+	if rule.NoncurrentVersionExpiration != nil {
+		parts = append(parts, "expire "+formatDays(rule.NoncurrentVersionExpiration.NoncurrentDays)+describeNewer(rule.NoncurrentVersionExpiration.NewerNoncurrentVersions))
+	}
+	for _, t := range rule.NoncurrentVersionTransitions {
+		parts = append(parts, fmt.Sprintf("%dd %s%s", t.NoncurrentDays, t.StorageClass, describeNewer(t.NewerNoncurrentVersions)))
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// describeNewer describes the number of noncurrent versions that are retained by a noncurrent action.
+func describeNewer(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (keep %d)", n)
+}
+
+func describeTransitions(rule lifecycleRule) string {
+	if len(rule.Transitions) == 0 {
+		return "-"
+	}
+	parts := make([]string, len(rule.Transitions))
+	for i, t := range rule.Transitions {
+		if t.Days == nil {
+			parts[i] = fmt.Sprintf("%s %s", strings.SplitN(t.Date, "T", 2)[0], t.StorageClass)
+		} else {
+			parts[i] = fmt.Sprintf("%dd %s", *t.Days, t.StorageClass)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func describeAbort(rule lifecycleRule) string {
+	if rule.AbortIncompleteMultipartUpload == nil {
+		return "-"
+	}
+	return formatDays(rule.AbortIncompleteMultipartUpload.DaysAfterInitiation)
+}
+
+func formatDays(n int) string {
+	if n == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", n)
+}
+
+// parseLifecycleRule creates a single rule from the flags of "lifecycle add".
+func parseLifecycleRule(flags map[string]string) (lifecycleRule, error) {
+	rule := lifecycleRule{ID: flags["--id"], Status: "Enabled"}
+	if _, ok := flags["--disabled"]; ok {
+		rule.Status = "Disabled"
+	}
+
+	prefix := strings.TrimPrefix(flags["--prefix"], "/")
+	tags, err := parseTagArgs(flagValues(flags, "--tag"))
+	if err != nil {
+		return lifecycleRule{}, err
+	}
+	rule.Filter = &lifecycleFilter{Prefix: prefix}
+	if len(tags) > 0 {
+		list := make([]tag, 0, len(tags))
+		for k, v := range tags {
+			list = append(list, tag{k, v})
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+		if len(tags) == 1 && len(prefix) == 0 {
+			rule.Filter = &lifecycleFilter{Tag: &list[0]}
+		} else {
+			// multiple conditions must be combined explicitly
+			rule.Filter = &lifecycleFilter{And: &lifecycleAnd{Prefix: prefix, Tags: list}}
+		}
+	}
+
+	days := func(name string) (int, error) {
+		str, ok := flags[name]
+		if !ok {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(str)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid number of days %q for flag %s", str, name)
+		}
+		return n, nil
+	}
+
+	if n, err := days("--expire-days"); err != nil {
+		return lifecycleRule{}, err
+	} else if n > 0 {
+		rule.Expiration = &lifecycleExpiration{Days: n}
+	}
+	if n, err := days("--noncurrent-days"); err != nil {
+		return lifecycleRule{}, err
+	} else if n > 0 {
+		rule.NoncurrentVersionExpiration = &noncurrentVersionExpiration{NoncurrentDays: n}
+	}
+	if n, err := days("--abort-days"); err != nil {
+		return lifecycleRule{}, err
+	} else if n > 0 {
+		rule.AbortIncompleteMultipartUpload = &abortIncompleteUpload{DaysAfterInitiation: n}
+	}
+	for _, str := range flagValues(flags, "--transition") {
+		parts := strings.SplitN(str, ":", 2)
+		n, err := strconv.Atoi(parts[0])
+		if len(parts) != 2 || err != nil || n < 0 || len(parts[1]) == 0 {
+			return lifecycleRule{}, fmt.Errorf("invalid transition %q. Please use \"{days}:{storage class}\", e.g. \"30:GLACIER\"", str)
+		}
+		rule.Transitions = append(rule.Transitions, lifecycleTransition{Days: &n, StorageClass: strings.ToUpper(parts[1])})
+	}
+
+	if rule.Expiration == nil && rule.NoncurrentVersionExpiration == nil && rule.AbortIncompleteMultipartUpload == nil && len(rule.Transitions) == 0 {
+		return lifecycleRule{}, fmt.Errorf("rule has no action. Please use at least one of \"--expire-days\", \"--noncurrent-days\", \"--transition\" and \"--abort-days\"")
+	}
+	return rule, nil
+}
+
+// validateLifecycle checks the rules for mistakes that S3 only reports as malformed XML.
+func validateLifecycle(config lifecycleConfiguration) error {
+	if len(config.Rules) == 0 {
+		return fmt.Errorf("invalid lifecycle configuration: no rules found")
+	}
+
+	ids := make(map[string]bool)
+	for i, rule := range config.Rules {
+		if rule.Status != "Enabled" && rule.Status != "Disabled" {
+			return fmt.Errorf("invalid lifecycle configuration: Status of rule %d must be \"Enabled\" or \"Disabled\"", i+1)
+		}
+		if len(rule.ID) > 0 {
+			if ids[rule.ID] {
+				return fmt.Errorf("invalid lifecycle configuration: rule id %q is used more than once", rule.ID)
+			}
+			ids[rule.ID] = true
+		}
+		if rule.Filter == nil && rule.Prefix == nil {
+			return fmt.Errorf("invalid lifecycle configuration: rule %d has no Filter", i+1)
+		}
+		if rule.Expiration == nil && rule.NoncurrentVersionExpiration == nil && rule.AbortIncompleteMultipartUpload == nil && len(rule.Transitions) == 0 && len(rule.NoncurrentVersionTransitions) == 0 {
+			return fmt.Errorf("invalid lifecycle configuration: rule %d has no action", i+1)
+		}
+	}
+	return nil
+}
+
+func addLifecycleRule(s *Session, bucket string, rule lifecycleRule, dryRun bool) error {
+	config, _, err := getLifecycle(s, bucket)
+	if err != nil {
+		return err
+	}
+
+	if len(rule.ID) == 0 {
+		// ids are required to remove single rules later on
+		for i := len(config.Rules) + 1; len(rule.ID) == 0; i++ {
+			rule.ID = fmt.Sprintf("rule-%d", i)
+			for _, r := range config.Rules {
+				if r.ID == rule.ID {
+					rule.ID = ""
+				}
+			}
+		}
+	}
+
+	replaced := false
+	for i := range config.Rules {
+		if config.Rules[i].ID == rule.ID {
+			config.Rules[i] = rule
+			replaced = true
+		}
+	}
+	if !replaced {
+		config.Rules = append(config.Rules, rule)
+	}
+
+	data, err := xml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if replaced {
+		return writeLifecycle(s, bucket, string(data), fmt.Sprintf("replace lifecycle rule %q of bucket", rule.ID), dryRun)
+	}
+	return writeLifecycle(s, bucket, string(data), fmt.Sprintf("add lifecycle rule %q to bucket", rule.ID), dryRun)
+}
+
+func removeLifecycleRule(s *Session, bucket, id string, dryRun bool) error {
+	config, _, err := getLifecycle(s, bucket)
+	if err != nil {
+		return err
+	}
+
+	rules := make([]lifecycleRule, 0, len(config.Rules))
+	for _, rule := range config.Rules {
+		if rule.ID != id {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == len(config.Rules) {
+		return fmt.Errorf("bucket %q has no lifecycle rule %q", bucket, id)
+	}
+
+	str := ""
+	if len(rules) > 0 {
+		// S3 does not accept empty configurations, so the last rule removes the whole configuration
+		config.Rules = rules
+		data, err := xml.Marshal(config)
+		if err != nil {
+			return err
+		}
+		str = string(data)
+	}
+	return writeLifecycle(s, bucket, str, fmt.Sprintf("remove lifecycle rule %q of bucket", id), dryRun)
+}
+
+// writeLifecycle replaces the lifecycle configuration of a bucket and reports the action.
+func writeLifecycle(s *Session, bucket, str, action string, dryRun bool) error {
+	if dryRun {
+		printDryRun(printlnf, action, bucket)
+		return nil
+	}
+	if err := s.Store.SetBucketLifecycle(bucket, str); err != nil {
+		return err
+	}
+
+	if len(str) == 0 {
+		printlnf("All lifecycle rules of bucket %q have been removed", bucket)
+	} else {
+		printlnf("Lifecycle rules of bucket %q have been updated", bucket)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const (
+	// sizeRule only expires large objects. Writing it back without its size filter would expire all objects.
+	sizeRule = `<Rule><ID>big</ID><Filter><ObjectSizeGreaterThan>1000000</ObjectSizeGreaterThan></Filter><Status>Enabled</Status><Expiration><Days>1</Days></Expiration><FutureElement>kept</FutureElement></Rule>`
+	// noncurrentRule contains elements of an And filter and a noncurrent expiration.
+	noncurrentRule  = `<Rule><ID>old</ID><Filter><And><Prefix>logs/</Prefix><ObjectSizeLessThan>10</ObjectSizeLessThan></And></Filter><Status>Enabled</Status><NoncurrentVersionExpiration><NoncurrentDays>7</NoncurrentDays><NewerNoncurrentVersions>3</NewerNoncurrentVersions></NoncurrentVersionExpiration></Rule>`
+	storedLifecycle = `<LifecycleConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">` + sizeRule + noncurrentRule + `</LifecycleConfiguration>`
+)
+
+func TestLifecycleRoundTrip(t *testing.T) {
+	tests := []struct {
+		args []string
+		// kept and removed are rules expected verbatim in or absent from the written configuration
+		kept    []string
+		removed []string
+	}{
+		{[]string{"add", "b", "--id", "new", "--expire-days", "5"}, []string{sizeRule, noncurrentRule, "<ID>new</ID>"}, nil},
+		{[]string{"add", "b", "--id", "old", "--expire-days", "5"}, []string{sizeRule, "<ID>old</ID>"}, []string{noncurrentRule}},
+		{[]string{"rm", "b", "old"}, []string{sizeRule}, []string{noncurrentRule}},
+		{[]string{"rm", "b", "big"}, []string{noncurrentRule}, []string{sizeRule}},
+	}
+	for _, test := range tests {
+		s := newTestSession(t)
+		must(t, s.Store.SetBucketLifecycle("b", storedLifecycle))
+		_, err := captureOutput(func() error { return lifecycle(s, test.args) })
+		must(t, err)
+
+		str, err := s.Store.GetBucketLifecycle("b")
+		must(t, err)
+		for _, rule := range test.kept {
+			if !strings.Contains(str, rule) {
+				t.Errorf("lifecycle %v does not keep %s:\n%s", test.args, rule, str)
+			}
+		}
+		for _, rule := range test.removed {
+			if strings.Contains(str, rule) {
+				t.Errorf("lifecycle %v keeps %s", test.args, rule)
+			}
+		}
+		var config lifecycleConfiguration
+		must(t, xml.Unmarshal([]byte(str), &config))
+		must(t, validateLifecycle(config))
+	}
+}
+
+func TestLifecycleGet(t *testing.T) {
+	s := newTestSession(t)
+	must(t, s.Store.SetBucketLifecycle("b", storedLifecycle))
+
+	// the XML output is passed to "lifecycle set" again and must not lose anything
+	out, err := captureOutput(func() error { return lifecycle(s, []string{"get", "--xml"}) })
+	must(t, err)
+	if strings.TrimSpace(out) != storedLifecycle {
+		t.Errorf("lifecycle get --xml printed\n%s\nexpected\n%s", out, storedLifecycle)
+	}
+
+	out, err = captureOutput(func() error { return lifecycle(s, []string{"get"}) })
+	must(t, err)
+	for _, expected := range []string{"size > 1000000", "prefix logs/, size < 10", "expire 7 days (keep 3)"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("lifecycle get does not show %q:\n%s", expected, out)
+		}
+	}
+}
+
+func TestParseLifecycleRule(t *testing.T) {
+	tests := []struct {
+		args []string
+		// rule is the XML of the parsed rule
+		rule string
+		err  bool
+	}{
+		{[]string{"--expire-days", "30"}, `<Rule><Status>Enabled</Status><Filter></Filter><Expiration><Days>30</Days></Expiration></Rule>`, false},
+		{[]string{"--id", "logs", "--prefix", "/logs/", "--expire-days", "7", "--disabled"}, `<Rule><ID>logs</ID><Status>Disabled</Status><Filter><Prefix>logs/</Prefix></Filter><Expiration><Days>7</Days></Expiration></Rule>`, false},
+		// a single tag is a filter on its own, every combination needs an And element
+		{[]string{"--tag", "tmp=1", "--expire-days", "1"}, `<Rule><Status>Enabled</Status><Filter><Tag><Key>tmp</Key><Value>1</Value></Tag></Filter><Expiration><Days>1</Days></Expiration></Rule>`, false},
+		{[]string{"--tag", "tmp=1", "--prefix", "logs/", "--expire-days", "1"}, `<Rule><Status>Enabled</Status><Filter><And><Prefix>logs/</Prefix><Tag><Key>tmp</Key><Value>1</Value></Tag></And></Filter><Expiration><Days>1</Days></Expiration></Rule>`, false},
+		{[]string{"--tag", "b=2", "--tag", "a=1", "--expire-days", "1"}, `<Rule><Status>Enabled</Status><Filter><And><Tag><Key>a</Key><Value>1</Value></Tag><Tag><Key>b</Key><Value>2</Value></Tag></And></Filter><Expiration><Days>1</Days></Expiration></Rule>`, false},
+		{[]string{"--transition", "30:standard_ia", "--transition", "0:GLACIER"}, `<Rule><Status>Enabled</Status><Filter></Filter><Transition><Days>30</Days><StorageClass>STANDARD_IA</StorageClass></Transition><Transition><Days>0</Days><StorageClass>GLACIER</StorageClass></Transition></Rule>`, false},
+		{[]string{"--noncurrent-days", "5", "--abort-days", "2"}, `<Rule><Status>Enabled</Status><Filter></Filter><NoncurrentVersionExpiration><NoncurrentDays>5</NoncurrentDays></NoncurrentVersionExpiration><AbortIncompleteMultipartUpload><DaysAfterInitiation>2</DaysAfterInitiation></AbortIncompleteMultipartUpload></Rule>`, false},
+		{[]string{"--transition", "GLACIER"}, "", true},
+		{[]string{"--transition", "30:"}, "", true},
+		{[]string{"--transition", "-1:GLACIER"}, "", true},
+		{[]string{"--transition", "x:GLACIER"}, "", true},
+		{[]string{"--expire-days", "0"}, "", true},
+		{[]string{"--expire-days", "ten"}, "", true},
+		{[]string{"--tag", "tmp", "--expire-days", "1"}, "", true},
+		{[]string{"--prefix", "logs/"}, "", true},
+	}
+	for _, test := range tests {
+		_, flags, err := parseFlags(test.args, flagSet{Bool: []string{"--disabled"}, Value: []string{"--id", "--prefix", "--expire-days", "--noncurrent-days", "--abort-days"}, Multi: []string{"--tag", "--transition"}})
+		must(t, err)
+		rule, err := parseLifecycleRule(flags)
+		if (err != nil) != test.err {
+			t.Errorf("%v: unexpected error %v", test.args, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		data, err := xml.Marshal(lifecycleConfiguration{Rules: []lifecycleRule{rule}})
+		must(t, err)
+		if string(data) != "<LifecycleConfiguration>"+test.rule+"</LifecycleConfiguration>" {
+			t.Errorf("%v:\n%s\nexpected\n%s", test.args, data, test.rule)
+		}
+	}
+}
+
+func TestLifecycleRuleIDs(t *testing.T) {
+	tests := []struct {
+		ids []string
+		// added is the id of a new rule without "--id"
+		added string
+	}{
+		{nil, "rule-1"},
+		{[]string{"rule-1"}, "rule-2"},
+		{[]string{"rule-2"}, "rule-3"},
+		{[]string{"rule-2", "rule-3"}, "rule-4"},
+		{[]string{"old", "rule-3"}, "rule-4"},
+		{[]string{"rule-3", "old"}, "rule-4"},
+	}
+	for _, test := range tests {
+		s := newTestSession(t)
+		if len(test.ids) > 0 {
+			var rules string
+			for _, id := range test.ids {
+				rules += `<Rule><ID>` + id + `</ID><Filter></Filter><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule>`
+			}
+			must(t, s.Store.SetBucketLifecycle("b", `<LifecycleConfiguration>`+rules+`</LifecycleConfiguration>`))
+		}
+
+		_, err := captureOutput(func() error { return lifecycle(s, []string{"add", "b", "--expire-days", "5"}) })
+		must(t, err)
+		config, _, err := getLifecycle(s, "b")
+		must(t, err)
+		must(t, validateLifecycle(config))
+		if ids := lifecycleIDs(config); ids[len(ids)-1] != test.added || len(ids) != len(test.ids)+1 {
+			t.Errorf("rules %v: added rule got id %v, expected %q", test.ids, ids, test.added)
+		}
+	}
+
+	// rules added in a row never replace each other
+	s := newTestSession(t)
+	for i := 0; i < 3; i++ {
+		_, err := captureOutput(func() error { return lifecycle(s, []string{"add", "b", "--expire-days", "5"}) })
+		must(t, err)
+	}
+	config, _, err := getLifecycle(s, "b")
+	must(t, err)
+	if ids := lifecycleIDs(config); fmt.Sprint(ids) != "[rule-1 rule-2 rule-3]" {
+		t.Errorf("added rules got ids %v", ids)
+	}
+}
+
+// lifecycleIDs returns the ids of all rules in their order.
+func lifecycleIDs(config lifecycleConfiguration) []string {
+	ids := make([]string, len(config.Rules))
+	for i, rule := range config.Rules {
+		ids[i] = rule.ID
+	}
+	return ids
+}
+
+func TestValidateLifecycle(t *testing.T) {
+	expire := `<Expiration><Days>1</Days></Expiration>`
+	tests := []struct {
+		name  string
+		rules string
+		err   bool
+	}{
+		{"filter", `<Rule><ID>a</ID><Filter><Prefix>logs/</Prefix></Filter><Status>Enabled</Status>` + expire + `</Rule>`, false},
+		{"legacy prefix", `<Rule><Prefix>logs/</Prefix><Status>Disabled</Status>` + expire + `</Rule>`, false},
+		{"noncurrent transition", `<Rule><Filter></Filter><Status>Enabled</Status><NoncurrentVersionTransition><NoncurrentDays>1</NoncurrentDays><StorageClass>GLACIER</StorageClass></NoncurrentVersionTransition></Rule>`, false},
+		{"no rules", ``, true},
+		{"misspelled status", `<Rule><Filter></Filter><Status>enabled</Status>` + expire + `</Rule>`, true},
+		{"duplicate id", `<Rule><ID>a</ID><Filter></Filter><Status>Enabled</Status>` + expire + `</Rule><Rule><ID>a</ID><Filter></Filter><Status>Enabled</Status>` + expire + `</Rule>`, true},
+		{"no filter", `<Rule><Status>Enabled</Status>` + expire + `</Rule>`, true},
+		{"no action", `<Rule><Filter></Filter><Status>Enabled</Status></Rule>`, true},
+	}
+	for _, test := range tests {
+		var config lifecycleConfiguration
+		must(t, xml.Unmarshal([]byte(`<LifecycleConfiguration>`+test.rules+`</LifecycleConfiguration>`), &config))
+		if err := validateLifecycle(config); (err != nil) != test.err {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+	}
+}
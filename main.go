@@ -4,52 +4,86 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
-	"github.com/minio/minio-go"
 	"github.com/sbreitf1/go-console"
 )
 
 // S3Target contains address and credentials of a S3 endpoint.
 type S3Target struct {
-	SourceFile    string
+	SourceFile    string `json:"-"`
 	Key           string `json:"key"`
 	Endpoint      string `json:"endpoint"`
 	Secure        bool   `json:"secure"`
 	AccessKey     string `json:"accessKey"`
-	SecretKey     string `json:"secretKey"`
+	SecretKey     string `json:"secretKey,omitempty"`
 	DefaultBucket string `json:"defaultBucket"`
-
-	//TODO read-only mode for production safety?
+	// EncryptedSecrets replaces the secret key in the file if the environment is protected by the master passphrase.
+	EncryptedSecrets *encryptedSecrets `json:"encryptedSecrets,omitempty"`
+	// SessionToken belongs to temporary credentials given as access and secret key. It is encrypted like the secret key.
+	SessionToken string `json:"sessionToken,omitempty"`
+	// SessionExpiration is the expiry of the session token if known.
+	SessionExpiration *time.Time `json:"sessionExpiration,omitempty"`
+	// AssumeRole requests temporary credentials from STS instead of using the access key directly.
+	AssumeRole *assumeRole `json:"assumeRole,omitempty"`
+	// Region is sent with all requests instead of detecting the bucket location. It is required by some S3 compatible stores.
+	Region string `json:"region,omitempty"`
+	// ReadOnly prevents all commands that would modify buckets or objects.
+	ReadOnly bool `json:"readOnly"`
+	// Workers is the default number of parallel workers for recursive operations.
+	Workers int `json:"workers,omitempty"`
+	// Encryption is the default server-side encryption of all requests: "SSE-S3", "SSE-KMS" or "SSE-C".
+	Encryption string `json:"encryption,omitempty"`
+	// KMSKeyID selects the key for SSE-KMS. The default key of the account is used if empty.
+	KMSKeyID string `json:"kmsKeyId,omitempty"`
+	// SSECKeyFile is a local file containing the customer-provided key for SSE-C.
+	SSECKeyFile string `json:"ssecKeyFile,omitempty"`
+	// ClientEncryption encrypts objects on the client before they are uploaded.
+	ClientEncryption *clientEncryption `json:"clientEncryption,omitempty"`
+	// ChecksumAlgorithm selects additional checksums stored with uploads: "sha256", "crc32c" or both separated by comma.
+	ChecksumAlgorithm string `json:"checksumAlgorithm,omitempty"`
+	// InMemory replaces the remote endpoint by a volatile in-memory store for demos and tests.
+	InMemory bool `json:"-"`
 }
 
-var (
-	// application and connection state
-	currentTarget S3Target
-	minioClient   *minio.Client
-	currentBucket string
-	currentPrefix string
-)
+// cliOptions contains global flags given on the command line.
+type cliOptions struct {
+	ReadOnly bool
+	DryRun   bool
+}
 
 func main() {
 	if !console.SupportsColors() {
 		disableColors()
 	}
+	if _, _, err := console.GetSize(); err != nil {
+		// stdout is no terminal -> do not clutter redirected output with progress bars
+		disableProgress()
+	}
 
-	target, args, err := readArgs()
+	target, args, options, err := readArgs()
 	if err != nil {
 		printlnf(err.Error())
 		os.Exit(1)
 	}
 
-	if err := connect(target); err != nil {
+	if options.ReadOnly {
+		target.ReadOnly = true
+	}
+
+	s, err := NewSession(target)
+	if err != nil {
 		printlnf(err.Error())
 		os.Exit(1)
 	}
+	s.DryRun = options.DryRun
+	sessions := NewSessions(s)
+	sessions.ReadOnly = options.ReadOnly
+	sessions.DryRun = options.DryRun
 
 	//TODO some connection check?
 	if len(target.DefaultBucket) > 0 {
-		if err := enter([]string{target.DefaultBucket}); err != nil {
-			currentBucket = ""
+		if err := enter(s, []string{target.DefaultBucket}); err != nil {
 			printlnf(err.Error())
 
 			if len(target.SourceFile) == 0 && len(args) > 0 {
@@ -61,29 +95,45 @@ func main() {
 
 	if len(args) > 0 {
 		// command specified as input? execute and then exit
-		if err := execLine(args); err != nil {
+		if err := execLine(sessions, args); err != nil {
 			printlnf("ERR: %s", err.Error())
 			os.Exit(1)
 		}
 
 	} else {
 		// interactive mode
-		if err := runCLE(); err != nil {
+		if err := runCLE(sessions); err != nil {
 			printlnf("FATAL: %s", err.Error())
 			os.Exit(1)
 		}
 	}
 }
 
-func readArgs() (S3Target, []string, error) {
+// valueOptions are the global options that are followed by a value.
+var valueOptions = []string{"--name", "--url", "--access-key", "--secret-key", "--bucket-name", "--session-token", "--role-arn", "--profile"}
+
+func isValueOption(arg string) bool {
+	for _, opt := range valueOptions {
+		if arg == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// readArgs parses the global options in front of the command. Everything from the first positional argument on is the command to execute.
+func readArgs() (S3Target, []string, cliOptions, error) {
 	// command to execute
 	args := make([]string, 0)
+	var options cliOptions
 
 	// temporary parser state
 	envKey := ""
 	argParseMode := ""
+	inMemory := false
 
-	var targetName, targetURL, targetAccessKey, targetSecretKey, targetBucketName string
+	var targetName, targetURL, targetAccessKey, targetSecretKey, targetBucketName, profileName string
+	var targetSessionToken, targetRoleARN string
 
 	for i := 1; i < len(os.Args); i++ {
 		nextArgParseMode := ""
@@ -103,91 +153,117 @@ func readArgs() (S3Target, []string, error) {
 			targetSecretKey = os.Args[i]
 		case "--bucket-name":
 			targetBucketName = os.Args[i]
+		case "--session-token":
+			targetSessionToken = os.Args[i]
+		case "--role-arn":
+			targetRoleARN = os.Args[i]
+		case "--profile":
+			profileName = os.Args[i]
 
 		case "":
-			// only read environment key once -> further "-e" args might be part of actual command
-			if len(envKey) == 0 && os.Args[i] == "-e" {
+			if os.Args[i] == "-e" {
 				// next parameter contains the environment key
 				nextArgParseMode = "-e"
-			} else if strings.HasPrefix(os.Args[i], "--") {
+			} else if os.Args[i] == "--in-memory" {
+				inMemory = true
+			} else if os.Args[i] == "--read-only" {
+				options.ReadOnly = true
+			} else if os.Args[i] == "--dry-run" {
+				options.DryRun = true
+			} else if strings.HasPrefix(os.Args[i], "-") {
+				if !isValueOption(os.Args[i]) {
+					return S3Target{}, nil, options, fmt.Errorf("unknown option %q", os.Args[i])
+				}
 				nextArgParseMode = os.Args[i]
 			} else {
-				// append to command
-				args = append(args, os.Args[i])
+				// the command starts here and gets all remaining arguments including its flags unchanged
+				args = append(args, os.Args[i:]...)
+				i = len(os.Args)
 			}
 
 		default:
-			panic(fmt.Sprintf("invalid arg parser state %q", argParseMode))
+			return S3Target{}, nil, options, fmt.Errorf("invalid arg parser state %q", argParseMode)
 		}
 
 		argParseMode = nextArgParseMode
 	}
+	if len(argParseMode) > 0 {
+		return S3Target{}, nil, options, fmt.Errorf("missing value for option %q", argParseMode)
+	}
 
-	if len(targetName) > 0 || len(targetURL) > 0 || len(targetAccessKey) > 0 || len(targetSecretKey) > 0 || len(targetBucketName) > 0 {
-		if len(targetURL) == 0 {
-			printlnf("Missing --url parameter")
-			os.Exit(1)
+	if inMemory {
+		if len(targetName) == 0 {
+			targetName = "in-memory"
 		}
-		if len(targetAccessKey) == 0 {
-			printlnf("Missing --access-key parameter")
+		return S3Target{Key: targetName, InMemory: true, DefaultBucket: targetBucketName}, args, options, nil
+	}
+
+	if len(targetName) > 0 || len(targetURL) > 0 || len(targetAccessKey) > 0 || len(targetSecretKey) > 0 || len(targetBucketName) > 0 || len(targetRoleARN) > 0 {
+		if len(targetAccessKey) > 0 && len(targetSecretKey) == 0 {
+			printlnf("Missing --secret-key parameter")
 			os.Exit(1)
 		}
-		if len(targetSecretKey) == 0 {
-			printlnf("Missing --secret-key parameter")
+
+		target := S3Target{Key: targetName, AccessKey: targetAccessKey, SecretKey: targetSecretKey, SessionToken: targetSessionToken, DefaultBucket: targetBucketName}
+		if len(targetRoleARN) > 0 {
+			target.AssumeRole = &assumeRole{RoleARN: targetRoleARN}
+		}
+		if len(targetURL) > 0 {
+			target.Endpoint, target.Secure = splitEndpointURL(targetURL)
+		}
+		// missing credentials and endpoint are taken from the AWS environment variables and profile
+		if err := applyCredentialChain(&target, profileName, true); err != nil {
+			return S3Target{}, nil, options, err
+		}
+		if !target.hasCredentials() {
+			printlnf("Missing --access-key parameter")
 			os.Exit(1)
 		}
+		return target, args, options, nil
+	}
 
-		endpoint := targetURL
-		secure := true
-		if strings.HasPrefix(strings.ToLower(endpoint), "http://") {
-			endpoint = endpoint[7:]
-			secure = false
-		} else if strings.HasPrefix(strings.ToLower(endpoint), "https://") {
-			endpoint = endpoint[8:]
-			secure = true
+	if len(envKey) == 0 {
+		// AWS credentials from the environment or a profile do not require a s3client environment
+		target, ok, err := ambientTarget(profileName)
+		if err != nil {
+			return S3Target{}, nil, options, err
+		}
+		if ok {
+			return target, args, options, nil
 		}
-		return S3Target{Key: targetName, Endpoint: endpoint, Secure: secure, AccessKey: targetAccessKey, SecretKey: targetSecretKey, DefaultBucket: targetBucketName}, args, nil
 	}
 
 	if len(envKey) == 0 && len(args) > 0 {
 		// the user seems helpless
 		printlnf("Usage:")
 		printlnf("  - Create new environment with \"-e {name}\" and use with same arguments")
+		printlnf("  - Use \"--profile {name}\" or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY to connect with AWS credentials")
 		printlnf("  - Type \"help\" to see a list of available commands")
 		os.Exit(1)
 	}
 
 	target, err := prepareEnv(envKey)
 	if err != nil {
-		return S3Target{}, nil, err
+		return S3Target{}, nil, options, err
 	}
-	return target, args, nil
-}
-
-func connect(target S3Target) error {
-	currentTarget = target
-	client, err := minio.New(target.Endpoint, target.AccessKey, target.SecretKey, target.Secure)
-	if err != nil {
-		return err
+	if err := applyCredentialChain(&target, profileName, false); err != nil {
+		return S3Target{}, nil, options, err
 	}
-	minioClient = client
-	currentBucket = target.DefaultBucket
-	currentPrefix = ""
-	return nil
+	return target, args, options, nil
 }
 
-func execLine(cmd []string) error {
+func execLine(sessions *Sessions, cmd []string) error {
 	if len(cmd) == 0 {
 		return fmt.Errorf("No command specified")
 	} else if len(cmd) == 1 {
-		return execCommand(cmd[0], []string{})
+		return execCommand(sessions, cmd[0], []string{})
 	} else {
-		return execCommand(cmd[0], cmd[1:])
+		return execCommand(sessions, cmd[0], cmd[1:])
 	}
 }
 
-func execCommand(cmd string, args []string) error {
-	cle := prepareCLE()
+func execCommand(sessions *Sessions, cmd string, args []string) error {
+	cle := prepareCLE(sessions)
 	cle.ExecUnknownCommand = nil
 	if err := cle.ExecCommand(cmd, args); err != nil {
 		if console.IsErrUnknownCommand(err) {
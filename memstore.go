@@ -0,0 +1,837 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/encrypt"
+	"github.com/minio/minio-go/pkg/s3utils"
+)
+
+// memoryStore is a volatile ObjectStore that keeps all buckets and objects in memory.
+type memoryStore struct {
+	mutex   sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+type memoryBucket struct {
+	created time.Time
+	// objects contains the latest version of all keys that are not deleted
+	objects map[string]*memoryObject
+	// versioning is "Enabled", "Suspended" or empty if never enabled
+	versioning string
+	// versions contains the history of all keys written since versioning has been enabled, oldest first
+	versions  map[string][]*memoryObject
+	policy    string
+	lifecycle string
+	// uploads contains all incomplete multipart uploads by upload ID
+	uploads map[string]*memoryUpload
+}
+
+type memoryObject struct {
+	data         []byte
+	info         minio.ObjectInfo
+	tags         map[string]string
+	versionID    string
+	deleteMarker bool
+}
+
+type memoryUpload struct {
+	key       string
+	initiated time.Time
+	opts      minio.PutObjectOptions
+	parts     map[int]memoryPart
+}
+
+type memoryPart struct {
+	data []byte
+	info minio.ObjectPart
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{buckets: make(map[string]*memoryBucket)}
+}
+
+func errNoSuchBucket(bucket string) error {
+	return minio.ErrorResponse{Code: "NoSuchBucket", Message: "The specified bucket does not exist.", BucketName: bucket, StatusCode: http.StatusNotFound}
+}
+
+func errNoSuchKey(bucket, key string) error {
+	return minio.ErrorResponse{Code: "NoSuchKey", Message: "The specified key does not exist.", BucketName: bucket, Key: key, StatusCode: http.StatusNotFound}
+}
+
+func (s *memoryStore) ListBuckets() ([]minio.BucketInfo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	buckets := make([]minio.BucketInfo, 0, len(s.buckets))
+	for name, b := range s.buckets {
+		buckets = append(buckets, minio.BucketInfo{Name: name, CreationDate: b.created})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Name < buckets[j].Name })
+	return buckets, nil
+}
+
+func (s *memoryStore) BucketExists(bucket string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, ok := s.buckets[bucket]
+	return ok, nil
+}
+
+func (s *memoryStore) MakeBucket(bucket string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.buckets[bucket]; ok {
+		return minio.ErrorResponse{Code: "BucketAlreadyOwnedByYou", Message: "Your previous request to create the named bucket succeeded and you already own it.", BucketName: bucket, StatusCode: http.StatusConflict}
+	}
+	s.buckets[bucket] = &memoryBucket{created: time.Now(), objects: make(map[string]*memoryObject), uploads: make(map[string]*memoryUpload)}
+	return nil
+}
+
+func (s *memoryStore) RemoveBucket(bucket string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return errNoSuchBucket(bucket)
+	}
+	if len(b.objects) > 0 || len(b.versions) > 0 {
+		return minio.ErrorResponse{Code: "BucketNotEmpty", Message: "The bucket you tried to delete is not empty.", BucketName: bucket, StatusCode: http.StatusConflict}
+	}
+	delete(s.buckets, bucket)
+	return nil
+}
+
+func (s *memoryStore) ListObjects(bucket, prefix string, recursive bool, doneCh <-chan struct{}) <-chan minio.ObjectInfo {
+	// collect the listing up front so the caller can not observe concurrent modifications
+	s.mutex.Lock()
+	list := make([]minio.ObjectInfo, 0)
+	if b, ok := s.buckets[bucket]; !ok {
+		list = append(list, minio.ObjectInfo{Err: errNoSuchBucket(bucket)})
+	} else {
+		keys := make([]string, 0, len(b.objects))
+		for key := range b.objects {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		lastDir := ""
+		for _, key := range keys {
+			if !recursive {
+				if pos := strings.Index(key[len(prefix):], "/"); pos >= 0 {
+					// emulate the "/" delimiter by returning common prefixes only once
+					dir := key[:len(prefix)+pos+1]
+					if dir != lastDir {
+						list = append(list, minio.ObjectInfo{Key: dir})
+						lastDir = dir
+					}
+					continue
+				}
+			}
+			list = append(list, b.objects[key].info)
+		}
+	}
+	s.mutex.Unlock()
+
+	objectCh := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objectCh)
+		for _, obj := range list {
+			select {
+			case objectCh <- obj:
+			case <-doneCh:
+				return
+			}
+		}
+	}()
+	return objectCh
+}
+
+func (s *memoryStore) getObject(bucket, key string) (*memoryObject, error) {
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return nil, errNoSuchBucket(bucket)
+	}
+	obj, ok := b.objects[key]
+	if !ok {
+		return nil, errNoSuchKey(bucket, key)
+	}
+	return obj, nil
+}
+
+func (s *memoryStore) StatObject(bucket, key string, opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	obj, err := s.getObject(bucket, key)
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	if err := checkCustomerKey(bucket, obj, opts.ServerSideEncryption); err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	return obj.info, nil
+}
+
+func (s *memoryStore) GetObjectTags(bucket, key string) (map[string]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	obj, err := s.getObject(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string)
+	for k, v := range obj.tags {
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+func (s *memoryStore) SetObjectTags(bucket, key string, tags map[string]string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	obj, err := s.getObject(bucket, key)
+	if err != nil {
+		return err
+	}
+	obj.tags = make(map[string]string)
+	for k, v := range tags {
+		obj.tags[k] = v
+	}
+	return nil
+}
+
+func (s *memoryStore) RemoveObjectTags(bucket, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	obj, err := s.getObject(bucket, key)
+	if err != nil {
+		return err
+	}
+	obj.tags = nil
+	return nil
+}
+
+func (s *memoryStore) GetObject(bucket, key string, opts minio.GetObjectOptions) (io.ReadCloser, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	obj, err := s.getObject(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCustomerKey(bucket, obj, opts.ServerSideEncryption); err != nil {
+		return nil, err
+	}
+	header := opts.Header()
+	if etag := header.Get("If-Match"); len(etag) > 0 && strings.Trim(etag, "\"") != obj.info.ETag {
+		return nil, minio.ErrorResponse{Code: "PreconditionFailed", Message: "At least one of the pre-conditions you specified did not hold", BucketName: bucket, Key: key, StatusCode: http.StatusPreconditionFailed}
+	}
+
+	// stored data is never modified in place, so no copy is required here
+	data := obj.data
+	if rng := header.Get("Range"); len(rng) > 0 {
+		var start, end int64
+		if n, _ := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); n == 0 {
+			return nil, fmt.Errorf("unsupported range %q", rng)
+		} else if n == 1 {
+			end = int64(len(data)) - 1
+		}
+		if start >= int64(len(data)) || start > end {
+			return nil, minio.ErrorResponse{Code: "InvalidRange", Message: "The requested range is not satisfiable", BucketName: bucket, Key: key, StatusCode: http.StatusRequestedRangeNotSatisfiable}
+		}
+		if end >= int64(len(data)) {
+			end = int64(len(data)) - 1
+		}
+		data = data[start : end+1]
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memoryStore) PutObject(bucket, key string, r io.Reader, size int64, opts minio.PutObjectOptions) (int64, error) {
+	if opts.Progress != nil {
+		r = &hookReader{r, opts.Progress}
+	}
+
+	var data []byte
+	var err error
+	if size >= 0 {
+		data = make([]byte, size)
+		_, err = io.ReadFull(r, data)
+	} else {
+		data, err = ioutil.ReadAll(r)
+	}
+	if err != nil {
+		return 0, err
+	}
+	obj := newMemoryObject(key, data, opts)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return 0, errNoSuchBucket(bucket)
+	}
+	b.addVersion(key, obj)
+	return obj.info.Size, nil
+}
+
+// newMemoryObject creates an object with the headers given in the upload options.
+func newMemoryObject(key string, data []byte, opts minio.PutObjectOptions) *memoryObject {
+	metadata := make(http.Header)
+	for k, v := range opts.UserMetadata {
+		metadata.Set(metadataKey(k), v)
+	}
+	contentType := opts.ContentType
+	if len(contentType) == 0 {
+		contentType = "application/octet-stream"
+	}
+	metadata.Set("Content-Type", contentType)
+	for k, v := range map[string]string{"Cache-Control": opts.CacheControl, "Content-Disposition": opts.ContentDisposition, "Content-Encoding": opts.ContentEncoding, "Content-Language": opts.ContentLanguage} {
+		if len(v) > 0 {
+			metadata.Set(k, v)
+		}
+	}
+	setEncryption(metadata, opts.ServerSideEncryption)
+
+	hash := md5.Sum(data)
+	return &memoryObject{data: data, info: minio.ObjectInfo{
+		Key:          key,
+		ETag:         hex.EncodeToString(hash[:]),
+		LastModified: time.Now().UTC(),
+		Size:         int64(len(data)),
+		ContentType:  contentType,
+		Metadata:     metadata,
+		StorageClass: "STANDARD",
+	}}
+}
+
+func (s *memoryStore) CopyObject(srcBucket, srcKey, dstBucket, dstKey string, opts copyOptions) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	obj, err := s.getObject(srcBucket, srcKey)
+	if err != nil {
+		return err
+	}
+	if err := checkCustomerKey(srcBucket, obj, opts.SourceEncryption); err != nil {
+		return err
+	}
+	b, ok := s.buckets[dstBucket]
+	if !ok {
+		return errNoSuchBucket(dstBucket)
+	}
+
+	info := obj.info
+	info.Key = dstKey
+	info.LastModified = time.Now().UTC()
+	if opts.Metadata != nil {
+		info.Metadata = make(http.Header)
+		for k, v := range opts.Metadata {
+			info.Metadata.Set(k, v)
+		}
+		info.ContentType = info.Metadata.Get("Content-Type")
+	} else {
+		// the version id is stored in the headers of each version
+		info.Metadata = info.Metadata.Clone()
+	}
+	info.Metadata.Del("X-Amz-Version-Id")
+	// like S3, the copy is only encrypted if requested
+	setEncryption(info.Metadata, opts.Encryption)
+	b.addVersion(dstKey, &memoryObject{data: obj.data, info: info, tags: obj.tags})
+	return nil
+}
+
+func (s *memoryStore) RemoveObject(bucket, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return errNoSuchBucket(bucket)
+	}
+	if len(b.versioning) > 0 {
+		// like S3, versioned objects are hidden by a delete marker instead
+		b.addVersion(key, &memoryObject{deleteMarker: true, info: minio.ObjectInfo{Key: key, LastModified: time.Now().UTC()}})
+		return nil
+	}
+	// like S3, deleting a missing key is not an error
+	delete(b.objects, key)
+	return nil
+}
+
+func (s *memoryStore) GetBucketVersioning(bucket string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return "", errNoSuchBucket(bucket)
+	}
+	return b.versioning, nil
+}
+
+func (s *memoryStore) SetBucketVersioning(bucket, status string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return errNoSuchBucket(bucket)
+	}
+	if status != "Enabled" && status != "Suspended" {
+		return minio.ErrorResponse{Code: "MalformedXML", Message: "The XML you provided was not well-formed or did not validate against our published schema.", BucketName: bucket, StatusCode: http.StatusBadRequest}
+	}
+	b.versioning = status
+	return nil
+}
+
+func (s *memoryStore) ListObjectVersions(bucket, prefix string, recursive bool) ([]objectVersion, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return nil, errNoSuchBucket(bucket)
+	}
+
+	keySet := make(map[string]bool)
+	for key := range b.objects {
+		keySet[key] = true
+	}
+	for key := range b.versions {
+		keySet[key] = true
+	}
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	list := make([]objectVersion, 0)
+	lastDir := ""
+	for _, key := range keys {
+		history := b.history(key)
+		if len(history) == 0 {
+			continue
+		}
+		if !recursive {
+			if pos := strings.Index(key[len(prefix):], "/"); pos >= 0 {
+				dir := key[:len(prefix)+pos+1]
+				if dir != lastDir {
+					list = append(list, objectVersion{Key: dir})
+					lastDir = dir
+				}
+				continue
+			}
+		}
+		for i := len(history) - 1; i >= 0; i-- {
+			obj := history[i]
+			list = append(list, objectVersion{
+				Key:            key,
+				VersionID:      obj.versionID,
+				IsLatest:       i == len(history)-1,
+				IsDeleteMarker: obj.deleteMarker,
+				LastModified:   obj.info.LastModified,
+				Size:           obj.info.Size,
+				ETag:           obj.info.ETag,
+			})
+		}
+	}
+	return list, nil
+}
+
+func (s *memoryStore) GetObjectVersion(bucket, key, versionID string, opts minio.GetObjectOptions) (io.ReadCloser, minio.ObjectInfo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return nil, minio.ObjectInfo{}, errNoSuchBucket(bucket)
+	}
+	for _, obj := range b.history(key) {
+		if obj.versionID == versionID {
+			if obj.deleteMarker {
+				return nil, minio.ObjectInfo{}, minio.ErrorResponse{Code: "MethodNotAllowed", Message: "The specified method is not allowed against this resource.", BucketName: bucket, Key: key, StatusCode: http.StatusMethodNotAllowed}
+			}
+			if err := checkCustomerKey(bucket, obj, opts.ServerSideEncryption); err != nil {
+				return nil, minio.ObjectInfo{}, err
+			}
+			return ioutil.NopCloser(bytes.NewReader(obj.data)), obj.info, nil
+		}
+	}
+	return nil, minio.ObjectInfo{}, errNoSuchVersion(bucket, key)
+}
+
+func (s *memoryStore) RemoveObjectVersion(bucket, key, versionID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return errNoSuchBucket(bucket)
+	}
+	history := b.history(key)
+	for i, obj := range history {
+		if obj.versionID == versionID {
+			b.setHistory(key, append(history[:i:i], history[i+1:]...))
+			return nil
+		}
+	}
+	return errNoSuchVersion(bucket, key)
+}
+
+func errNoSuchVersion(bucket, key string) error {
+	return minio.ErrorResponse{Code: "NoSuchVersion", Message: "The specified version does not exist.", BucketName: bucket, Key: key, StatusCode: http.StatusNotFound}
+}
+
+// history returns all versions of a key, oldest first. Objects written before versioning has been enabled are the "null" version.
+func (b *memoryBucket) history(key string) []*memoryObject {
+	if history, ok := b.versions[key]; ok {
+		return history
+	}
+	if obj, ok := b.objects[key]; ok {
+		return []*memoryObject{obj}
+	}
+	return nil
+}
+
+// addVersion stores obj as the latest version of key according to the versioning state of the bucket.
+func (b *memoryBucket) addVersion(key string, obj *memoryObject) {
+	if len(b.versioning) == 0 {
+		obj.versionID = "null"
+		b.objects[key] = obj
+		return
+	}
+
+	history := b.history(key)
+	if b.versioning == "Enabled" {
+		obj.versionID = newVersionID()
+	} else {
+		// suspended versioning overwrites the "null" version
+		obj.versionID = "null"
+		for i, old := range history {
+			if old.versionID == "null" {
+				history = append(history[:i:i], history[i+1:]...)
+				break
+			}
+		}
+	}
+	if !obj.deleteMarker {
+		obj.info.Metadata.Set("X-Amz-Version-Id", obj.versionID)
+	}
+	b.setHistory(key, append(history, obj))
+}
+
+// setHistory replaces all versions of a key and makes the newest one visible unless it is a delete marker.
+func (b *memoryBucket) setHistory(key string, history []*memoryObject) {
+	if b.versions == nil {
+		b.versions = make(map[string][]*memoryObject)
+	}
+	if len(history) == 0 {
+		delete(b.versions, key)
+		delete(b.objects, key)
+		return
+	}
+
+	b.versions[key] = history
+	if latest := history[len(history)-1]; latest.deleteMarker {
+		delete(b.objects, key)
+	} else {
+		b.objects[key] = latest
+	}
+}
+
+func newVersionID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+func (s *memoryStore) NewMultipartUpload(bucket, key string, opts minio.PutObjectOptions) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return "", errNoSuchBucket(bucket)
+	}
+	uploadID := newVersionID()
+	opts.Progress = nil
+	b.uploads[uploadID] = &memoryUpload{key: key, initiated: time.Now().UTC(), opts: opts, parts: make(map[int]memoryPart)}
+	return uploadID, nil
+}
+
+func (s *memoryStore) getUpload(bucket, key, uploadID string) (*memoryUpload, error) {
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return nil, errNoSuchBucket(bucket)
+	}
+	upload, ok := b.uploads[uploadID]
+	if !ok || upload.key != key {
+		return nil, minio.ErrorResponse{Code: "NoSuchUpload", Message: "The specified multipart upload does not exist.", BucketName: bucket, Key: key, StatusCode: http.StatusNotFound}
+	}
+	return upload, nil
+}
+
+func (s *memoryStore) PutObjectPart(bucket, key, uploadID string, partNumber int, r io.Reader, size int64, sse encrypt.ServerSide) (minio.ObjectPart, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return minio.ObjectPart{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	upload, err := s.getUpload(bucket, key, uploadID)
+	if err != nil {
+		return minio.ObjectPart{}, err
+	}
+	hash := md5.Sum(data)
+	part := minio.ObjectPart{PartNumber: partNumber, LastModified: time.Now().UTC(), ETag: hex.EncodeToString(hash[:]), Size: size}
+	upload.parts[partNumber] = memoryPart{data: data, info: part}
+	return part, nil
+}
+
+func (s *memoryStore) ListObjectParts(bucket, key, uploadID string) ([]minio.ObjectPart, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	upload, err := s.getUpload(bucket, key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]minio.ObjectPart, 0, len(upload.parts))
+	for _, part := range upload.parts {
+		parts = append(parts, part.info)
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+func (s *memoryStore) CompleteMultipartUpload(bucket, key, uploadID string, parts []minio.CompletePart) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	upload, err := s.getUpload(bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+
+	// the ETag of multipart objects is the MD5 of all part MD5s followed by the number of parts
+	var data, sums []byte
+	for i, p := range parts {
+		part, ok := upload.parts[p.PartNumber]
+		if !ok || part.info.ETag != strings.Trim(p.ETag, "\"") {
+			return minio.ErrorResponse{Code: "InvalidPart", Message: "One or more of the specified parts could not be found.", BucketName: bucket, Key: key, StatusCode: http.StatusBadRequest}
+		}
+		if i > 0 && p.PartNumber <= parts[i-1].PartNumber {
+			return minio.ErrorResponse{Code: "InvalidPartOrder", Message: "The list of parts was not in ascending order.", BucketName: bucket, Key: key, StatusCode: http.StatusBadRequest}
+		}
+		if i < len(parts)-1 && part.info.Size < 5*1024*1024 {
+			return minio.ErrorResponse{Code: "EntityTooSmall", Message: "Your proposed upload is smaller than the minimum allowed object size.", BucketName: bucket, Key: key, StatusCode: http.StatusBadRequest}
+		}
+		hash := md5.Sum(part.data)
+		sums = append(sums, hash[:]...)
+		data = append(data, part.data...)
+	}
+
+	obj := newMemoryObject(key, data, upload.opts)
+	hash := md5.Sum(sums)
+	obj.info.ETag = fmt.Sprintf("%s-%d", hex.EncodeToString(hash[:]), len(parts))
+	b := s.buckets[bucket]
+	b.addVersion(key, obj)
+	delete(b.uploads, uploadID)
+	return nil
+}
+
+func (s *memoryStore) AbortMultipartUpload(bucket, key, uploadID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.getUpload(bucket, key, uploadID); err != nil {
+		return err
+	}
+	delete(s.buckets[bucket].uploads, uploadID)
+	return nil
+}
+
+func (s *memoryStore) ListMultipartUploads(bucket, prefix string) ([]minio.ObjectMultipartInfo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return nil, errNoSuchBucket(bucket)
+	}
+	list := make([]minio.ObjectMultipartInfo, 0)
+	for uploadID, upload := range b.uploads {
+		if strings.HasPrefix(upload.key, prefix) {
+			list = append(list, minio.ObjectMultipartInfo{Key: upload.key, UploadID: uploadID, Initiated: upload.initiated, StorageClass: "STANDARD"})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Key != list[j].Key {
+			return list[i].Key < list[j].Key
+		}
+		return list[i].Initiated.Before(list[j].Initiated)
+	})
+	return list, nil
+}
+
+func (s *memoryStore) GetBucketPolicy(bucket string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return "", errNoSuchBucket(bucket)
+	}
+	return b.policy, nil
+}
+
+func (s *memoryStore) SetBucketPolicy(bucket, policy string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return errNoSuchBucket(bucket)
+	}
+	b.policy = policy
+	return nil
+}
+
+func (s *memoryStore) GetBucketLifecycle(bucket string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return "", errNoSuchBucket(bucket)
+	}
+	// rules are only stored, objects never expire in memory
+	return b.lifecycle, nil
+}
+
+func (s *memoryStore) SetBucketLifecycle(bucket, lifecycle string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return errNoSuchBucket(bucket)
+	}
+	b.lifecycle = lifecycle
+	return nil
+}
+
+// memory stores have no endpoint, so presigned URLs only show what would be shared
+func (s *memoryStore) PresignGet(bucket, key string, expires time.Duration) (string, error) {
+	return memoryURL(bucket, key, expires), nil
+}
+
+func (s *memoryStore) PresignPut(bucket, key string, expires time.Duration) (string, error) {
+	return memoryURL(bucket, key, expires), nil
+}
+
+func (s *memoryStore) PresignPost(policy uploadPolicy) (string, map[string]string, error) {
+	formData := map[string]string{"key": policy.Key}
+	if policy.KeyPrefix {
+		formData["key"] += "${filename}"
+	}
+	if len(policy.ContentType) > 0 {
+		formData["Content-Type"] = policy.ContentType
+	}
+	return memoryURL(policy.Bucket, "", policy.Expires), formData, nil
+}
+
+func memoryURL(bucket, key string, expires time.Duration) string {
+	return fmt.Sprintf("memory://%s/%s?X-Amz-Expires=%d", bucket, s3utils.EncodePath(key), int64(expires.Seconds()))
+}
+
+var (
+	// encryptionHeaders describe the server-side encryption of an object. The customer-provided key itself is never stored.
+	encryptionHeaders = []string{"X-Amz-Server-Side-Encryption", "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", "X-Amz-Server-Side-Encryption-Customer-Algorithm", "X-Amz-Server-Side-Encryption-Customer-Key-Md5"}
+)
+
+// setEncryption replaces the encryption headers of an object by the ones of sse.
+func setEncryption(header http.Header, sse encrypt.ServerSide) {
+	for _, h := range encryptionHeaders {
+		header.Del(h)
+	}
+	if sse == nil {
+		return
+	}
+
+	sseHeader := make(http.Header)
+	encrypt.SSE(sse).Marshal(sseHeader)
+	for _, h := range encryptionHeaders {
+		if v := sseHeader.Get(h); len(v) > 0 {
+			header.Set(h, v)
+		}
+	}
+}
+
+// checkCustomerKey returns the S3 error for reading an object without the matching SSE-C key.
+func checkCustomerKey(bucket string, obj *memoryObject, sse encrypt.ServerSide) error {
+	keyMD5 := obj.info.Metadata.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5")
+	givenMD5 := ""
+	if sse != nil && sse.Type() == encrypt.SSEC {
+		sseHeader := make(http.Header)
+		encrypt.SSE(sse).Marshal(sseHeader)
+		givenMD5 = sseHeader.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5")
+	}
+
+	switch {
+	case keyMD5 == givenMD5:
+		return nil
+	case len(keyMD5) == 0:
+		return minio.ErrorResponse{Code: "InvalidRequest", Message: "The encryption parameters are not applicable to this object.", BucketName: bucket, Key: obj.info.Key, StatusCode: http.StatusBadRequest}
+	case len(givenMD5) == 0:
+		return minio.ErrorResponse{Code: "InvalidRequest", Message: "The object was stored using a form of Server Side Encryption. The correct parameters must be provided to retrieve the object.", BucketName: bucket, Key: obj.info.Key, StatusCode: http.StatusBadRequest}
+	default:
+		return minio.ErrorResponse{Code: "AccessDenied", Message: "Access Denied", BucketName: bucket, Key: obj.info.Key, StatusCode: http.StatusForbidden}
+	}
+}
+
+// hookReader reads the same amount of bytes from hook as read from source, like the progress hook in minio.
+type hookReader struct {
+	source io.Reader
+	hook   io.Reader
+}
+
+func (r *hookReader) Read(b []byte) (int, error) {
+	n, err := r.source.Read(b)
+	if n > 0 {
+		if _, hookErr := r.hook.Read(b[:n]); hookErr != nil && hookErr != io.EOF {
+			return n, hookErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/encrypt"
+)
+
+func newTestStore(t *testing.T, keys ...string) *memoryStore {
+	t.Helper()
+	store := newMemoryStore()
+	if err := store.MakeBucket("b"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		putString(t, store, key, key)
+	}
+	return store
+}
+
+func putString(t *testing.T, store *memoryStore, key, content string) {
+	t.Helper()
+	if _, err := store.PutObject("b", key, strings.NewReader(content), int64(len(content)), minio.PutObjectOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func listKeys(store *memoryStore, prefix string, recursive bool) ([]string, error) {
+	keys := make([]string, 0)
+	for obj := range store.ListObjects("b", prefix, recursive, nil) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		keys = append(keys, obj.Key)
+	}
+	return keys, nil
+}
+
+func TestMemoryStoreListObjects(t *testing.T) {
+	store := newTestStore(t, "a/x", "a/y", "a/z/1", "b/x", "top", "topic/1")
+
+	tests := []struct {
+		prefix    string
+		recursive bool
+		keys      []string
+	}{
+		{"", false, []string{"a/", "b/", "top", "topic/"}},
+		{"", true, []string{"a/x", "a/y", "a/z/1", "b/x", "top", "topic/1"}},
+		{"a/", false, []string{"a/x", "a/y", "a/z/"}},
+		{"a/", true, []string{"a/x", "a/y", "a/z/1"}},
+		{"top", false, []string{"top", "topic/"}},
+		{"a/z/", false, []string{"a/z/1"}},
+		{"missing/", false, []string{}},
+	}
+	for _, test := range tests {
+		keys, err := listKeys(store, test.prefix, test.recursive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(keys) != fmt.Sprint(test.keys) {
+			t.Errorf("ListObjects(%q, %t) = %v, expected %v", test.prefix, test.recursive, keys, test.keys)
+		}
+	}
+
+	for obj := range store.ListObjects("missing", "", false, nil) {
+		if minio.ToErrorResponse(obj.Err).Code != "NoSuchBucket" {
+			t.Errorf("expected NoSuchBucket for missing bucket, got %v", obj.Err)
+		}
+	}
+}
+
+func TestMemoryStoreObjects(t *testing.T) {
+	store := newTestStore(t, "k")
+	putString(t, store, "k", "overwritten")
+	must(t, store.CopyObject("b", "k", "b", "copy", copyOptions{}))
+	must(t, store.RemoveObject("b", "k"))
+
+	tests := []struct {
+		key     string
+		content string
+		code    string
+	}{
+		{"copy", "overwritten", ""},
+		{"k", "", "NoSuchKey"},
+	}
+	for _, test := range tests {
+		obj, err := store.GetObject("b", test.key, minio.GetObjectOptions{})
+		if len(test.code) > 0 {
+			if minio.ToErrorResponse(err).Code != test.code {
+				t.Errorf("GetObject(%q): expected %s, got %v", test.key, test.code, err)
+			}
+			continue
+		}
+		must(t, err)
+		if data, _ := ioutil.ReadAll(obj); string(data) != test.content {
+			t.Errorf("GetObject(%q) = %q, expected %q", test.key, data, test.content)
+		}
+	}
+
+	if err := store.RemoveBucket("b"); minio.ToErrorResponse(err).Code != "BucketNotEmpty" {
+		t.Errorf("expected BucketNotEmpty, got %v", err)
+	}
+	must(t, store.RemoveObject("b", "copy"))
+	must(t, store.RemoveBucket("b"))
+	if exists, _ := store.BucketExists("b"); exists {
+		t.Errorf("bucket still exists after RemoveBucket")
+	}
+}
+
+func TestMemoryStoreVersions(t *testing.T) {
+	tests := []struct {
+		name string
+		// steps are "put {key} {content}", "rm {key}" or "versioning {status}"
+		steps []string
+		// versions describes all versions of the listing, newest first, as "{key}:{content or DM}:{latest}"
+		versions []string
+		visible  string
+	}{
+		{"unversioned", []string{"put k 1", "put k 2"}, []string{"k:2:true"}, "2"},
+		{"unversioned delete", []string{"put k 1", "rm k"}, []string{}, ""},
+		{"enabled", []string{"versioning Enabled", "put k 1", "put k 2"}, []string{"k:2:true", "k:1:false"}, "2"},
+		{"delete marker", []string{"versioning Enabled", "put k 1", "rm k"}, []string{"k:DM:true", "k:1:false"}, ""},
+		{"null version kept", []string{"put k 1", "versioning Enabled", "put k 2"}, []string{"k:2:true", "k:1:false"}, "2"},
+		{"suspended overwrites null", []string{"put k 1", "versioning Enabled", "put k 2", "versioning Suspended", "put k 3", "put k 4"}, []string{"k:4:true", "k:2:false"}, "4"},
+	}
+	for _, test := range tests {
+		store := newTestStore(t)
+		for _, step := range test.steps {
+			parts := strings.Fields(step)
+			var err error
+			switch parts[0] {
+			case "put":
+				_, err = store.PutObject("b", parts[1], strings.NewReader(parts[2]), 1, minio.PutObjectOptions{})
+			case "rm":
+				err = store.RemoveObject("b", parts[1])
+			case "versioning":
+				err = store.SetBucketVersioning("b", parts[1])
+			}
+			if err != nil {
+				t.Fatalf("%s: %s failed: %s", test.name, step, err.Error())
+			}
+		}
+
+		list, err := store.ListObjectVersions("b", "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions := make([]string, 0)
+		for _, v := range list {
+			if len(v.VersionID) == 0 {
+				t.Errorf("%s: version of %q without version ID", test.name, v.Key)
+			}
+			content := "DM"
+			if !v.IsDeleteMarker {
+				obj, _, err := store.GetObjectVersion("b", v.Key, v.VersionID, minio.GetObjectOptions{})
+				if err != nil {
+					t.Fatalf("%s: GetObjectVersion(%q) failed: %s", test.name, v.VersionID, err.Error())
+				}
+				data, _ := ioutil.ReadAll(obj)
+				content = string(data)
+			}
+			versions = append(versions, fmt.Sprintf("%s:%s:%t", v.Key, content, v.IsLatest))
+		}
+		if fmt.Sprint(versions) != fmt.Sprint(test.versions) {
+			t.Errorf("%s: versions are %v, expected %v", test.name, versions, test.versions)
+		}
+
+		obj, err := store.GetObject("b", "k", minio.GetObjectOptions{})
+		visible := ""
+		if err == nil {
+			data, _ := ioutil.ReadAll(obj)
+			visible = string(data)
+		} else if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+			t.Fatal(err)
+		}
+		if visible != test.visible {
+			t.Errorf("%s: visible content is %q, expected %q", test.name, visible, test.visible)
+		}
+	}
+}
+
+func TestMemoryStoreRemoveVersion(t *testing.T) {
+	store := newTestStore(t)
+	must(t, store.SetBucketVersioning("b", "Enabled"))
+	putString(t, store, "k", "1")
+	must(t, store.RemoveObject("b", "k"))
+
+	list, err := store.ListObjectVersions("b", "k", true)
+	must(t, err)
+	if len(list) != 2 || !list[0].IsDeleteMarker {
+		t.Fatalf("expected delete marker and one version, got %+v", list)
+	}
+	// removing the delete marker restores the object
+	must(t, store.RemoveObjectVersion("b", "k", list[0].VersionID))
+	if _, err := store.StatObject("b", "k", minio.StatObjectOptions{}); err != nil {
+		t.Errorf("object not restored: %s", err.Error())
+	}
+	if err := store.RemoveObjectVersion("b", "k", "missing"); minio.ToErrorResponse(err).Code != "NoSuchVersion" {
+		t.Errorf("expected NoSuchVersion, got %v", err)
+	}
+}
+
+func TestMemoryStoreMultipartETag(t *testing.T) {
+	const partSize = 5 * 1024 * 1024
+	tests := []struct {
+		name  string
+		sizes []int
+		err   string
+	}{
+		{"single part", []int{10}, ""},
+		{"two parts", []int{partSize, 10}, ""},
+		{"three parts", []int{partSize, partSize, partSize + 1}, ""},
+		{"part too small", []int{10, 10}, "EntityTooSmall"},
+	}
+	for _, test := range tests {
+		store := newTestStore(t)
+		uploadID, err := store.NewMultipartUpload("b", "k", minio.PutObjectOptions{})
+		must(t, err)
+
+		var content, sums []byte
+		parts := make([]minio.CompletePart, 0)
+		for i, size := range test.sizes {
+			data := bytes.Repeat([]byte{byte('a' + i)}, size)
+			part, err := store.PutObjectPart("b", "k", uploadID, i+1, bytes.NewReader(data), int64(size), nil)
+			must(t, err)
+			sum := md5.Sum(data)
+			if part.ETag != hex.EncodeToString(sum[:]) {
+				t.Errorf("%s: part ETag %q is not the MD5 of the part", test.name, part.ETag)
+			}
+			sums = append(sums, sum[:]...)
+			content = append(content, data...)
+			parts = append(parts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+		}
+
+		err = store.CompleteMultipartUpload("b", "k", uploadID, parts)
+		if len(test.err) > 0 {
+			if minio.ToErrorResponse(err).Code != test.err {
+				t.Errorf("%s: expected %s, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		must(t, err)
+
+		sum := md5.Sum(sums)
+		expected := fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), len(test.sizes))
+		info, err := store.StatObject("b", "k", minio.StatObjectOptions{})
+		must(t, err)
+		if info.ETag != expected || info.Size != int64(len(content)) {
+			t.Errorf("%s: got ETag %q and size %d, expected %q and %d", test.name, info.ETag, info.Size, expected, len(content))
+		}
+		if uploads, _ := store.ListMultipartUploads("b", ""); len(uploads) != 0 {
+			t.Errorf("%s: completed upload is still listed", test.name)
+		}
+	}
+}
+
+func TestMemoryStoreCustomerKey(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	otherKey := bytes.Repeat([]byte{2}, 32)
+	sse, err := encrypt.NewSSEC(key)
+	must(t, err)
+	otherSSE, err := encrypt.NewSSEC(otherKey)
+	must(t, err)
+
+	store := newTestStore(t, "plain")
+	_, err = store.PutObject("b", "secret", strings.NewReader("data"), 4, minio.PutObjectOptions{ServerSideEncryption: sse})
+	must(t, err)
+
+	tests := []struct {
+		key  string
+		sse  encrypt.ServerSide
+		code string
+	}{
+		{"secret", sse, ""},
+		{"secret", nil, "InvalidRequest"},
+		{"secret", otherSSE, "AccessDenied"},
+		{"plain", nil, ""},
+		{"plain", sse, "InvalidRequest"},
+	}
+	for _, test := range tests {
+		_, statErr := store.StatObject("b", test.key, minio.StatObjectOptions{GetObjectOptions: minio.GetObjectOptions{ServerSideEncryption: test.sse}})
+		_, getErr := store.GetObject("b", test.key, minio.GetObjectOptions{ServerSideEncryption: test.sse})
+		for _, err := range []error{statErr, getErr} {
+			code := ""
+			if err != nil {
+				code = minio.ToErrorResponse(err).Code
+			}
+			if code != test.code {
+				t.Errorf("reading %q with key %v: got %q, expected %q", test.key, test.sse != nil, code, test.code)
+			}
+		}
+	}
+
+	// copies need the source key and are only encrypted on request
+	must(t, store.CopyObject("b", "secret", "b", "copy", copyOptions{SourceEncryption: sse}))
+	if _, err := store.GetObject("b", "copy", minio.GetObjectOptions{}); err != nil {
+		t.Errorf("unencrypted copy not readable: %s", err.Error())
+	}
+	if err := store.CopyObject("b", "secret", "b", "copy", copyOptions{}); err == nil {
+		t.Errorf("copy without source key succeeded")
+	}
+}
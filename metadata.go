@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/encrypt"
+)
+
+var (
+	// contentHeaders are the standard HTTP headers stored with an object. All other keys are user metadata.
+	contentHeaders = []string{"Content-Type", "Cache-Control", "Content-Disposition", "Content-Encoding", "Content-Language", "Expires"}
+)
+
+// metadataKey returns the header name for a metadata key given by the user. Standard headers are matched case-insensitive, everything else is user metadata with "X-Amz-Meta-" prefix.
+func metadataKey(key string) string {
+	for _, h := range contentHeaders {
+		if strings.EqualFold(h, key) {
+			return h
+		}
+	}
+	if strings.HasPrefix(strings.ToLower(key), "x-amz-meta-") {
+		key = key[len("x-amz-meta-"):]
+	}
+	return http.CanonicalHeaderKey("X-Amz-Meta-" + key)
+}
+
+// parseMetadataArgs parses "key=value" pairs into header names and values. An empty value marks a key for deletion.
+func parseMetadataArgs(args []string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, arg := range args {
+		pos := strings.Index(arg, "=")
+		if pos <= 0 {
+			return nil, fmt.Errorf("invalid metadata %q. Please use \"key=value\"", arg)
+		}
+		key := metadataKey(arg[:pos])
+		if isClientMetadata(key) {
+			return nil, fmt.Errorf("metadata %q is reserved for client-side encryption and checksums", arg[:pos])
+		}
+		metadata[key] = arg[pos+1:]
+	}
+	return metadata, nil
+}
+
+// putOptions returns the upload options for the given header names and values.
+func putOptions(metadata map[string]string) minio.PutObjectOptions {
+	opts := minio.PutObjectOptions{UserMetadata: make(map[string]string)}
+	for k, v := range metadata {
+		switch k {
+		case "Content-Type":
+			opts.ContentType = v
+		case "Cache-Control":
+			opts.CacheControl = v
+		case "Content-Disposition":
+			opts.ContentDisposition = v
+		case "Content-Encoding":
+			opts.ContentEncoding = v
+		case "Content-Language":
+			opts.ContentLanguage = v
+		default:
+			// minio-go adds the prefix again and sends standard headers like "Expires" as they are
+			opts.UserMetadata[strings.TrimPrefix(k, "X-Amz-Meta-")] = v
+		}
+	}
+	return opts
+}
+
+// objectMetadata returns the content headers and user metadata of an object as header names and values.
+func objectMetadata(info minio.ObjectInfo) map[string]string {
+	metadata := make(map[string]string)
+	for _, h := range contentHeaders {
+		if v := info.Metadata.Get(h); len(v) > 0 {
+			metadata[h] = v
+		}
+	}
+	if len(info.ContentType) > 0 {
+		metadata["Content-Type"] = info.ContentType
+	}
+	for k, v := range info.Metadata {
+		if strings.HasPrefix(k, "X-Amz-Meta-") && len(v) > 0 {
+			metadata[k] = v[0]
+		}
+	}
+	return metadata
+}
+
+// detectContentType guesses the MIME type of a local file by its extension or by sniffing the first bytes of content.
+func detectContentType(f *os.File) (string, error) {
+	if contentType := mime.TypeByExtension(filepath.Ext(f.Name())); len(contentType) > 0 {
+		return contentType, nil
+	}
+
+	buffer := make([]byte, 512)
+	n, err := f.Read(buffer)
+	if err != nil && n == 0 {
+		// empty files can not be sniffed
+		return "application/octet-stream", nil
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buffer[:n]), nil
+}
+
+func setmeta(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"-r", "-n"}, Value: append([]string{"-j"}, encryptionFlags...)})
+	if err != nil {
+		return err
+	}
+	dryRun := isDryRun(s, flags)
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"object name", "key=value"}, MinArgs: 2, VarArgs: true, Mutating: !dryRun}); err != nil {
+		return err
+	}
+
+	changes, err := parseMetadataArgs(args[1:])
+	if err != nil {
+		return err
+	}
+	sse, err := getEncryption(s, flags)
+	if err != nil {
+		return err
+	}
+
+	p, err := resolvePath(s, args[0])
+	if err != nil {
+		return err
+	}
+
+	_, recursive := flags["-r"]
+	prefix, keys, err := selectObjects(s, p, recursive, args[0])
+	if err != nil {
+		return err
+	}
+
+	workers, err := getWorkers(s, flags)
+	if err != nil {
+		return err
+	}
+
+	tasks := make([]task, len(keys))
+	for i := range keys {
+		key := keys[i]
+		tasks[i] = task{Label: key[len(prefix):], Run: func(log func(string, ...interface{})) error {
+			if dryRun {
+				printDryRun(log, "update metadata of", key)
+				return nil
+			}
+
+			if err := updateMetadata(s, p.Bucket, key, changes, sse); err != nil {
+				return err
+			}
+			log("  metadata of %q has been updated", key[len(prefix):])
+			return nil
+		}}
+	}
+	return runTasks(workers, tasks, nil)
+}
+
+// updateMetadata applies the changes to the current metadata of an object by copying it onto itself. S3 does not allow to modify metadata in place. The object keeps its encryption unless sse is set.
+func updateMetadata(s *Session, bucket, key string, changes map[string]string, sse encrypt.ServerSide) error {
+	sourceSSE, err := getSourceEncryption(nil, sse)
+	if err != nil {
+		return err
+	}
+	info, err := s.Store.StatObject(bucket, key, minio.StatObjectOptions{GetObjectOptions: minio.GetObjectOptions{ServerSideEncryption: sourceSSE}})
+	if err != nil {
+		return err
+	}
+	if sse, err = keepEncryption(info.Metadata, sse); err != nil {
+		return err
+	}
+
+	metadata := objectMetadata(info)
+	for k, v := range changes {
+		if len(v) == 0 {
+			delete(metadata, k)
+		} else {
+			metadata[k] = v
+		}
+	}
+	if len(metadata["Content-Type"]) == 0 {
+		// the content type is always sent to replace the metadata even if nothing else remains
+		metadata["Content-Type"] = "application/octet-stream"
+	}
+
+	return s.Store.CopyObject(bucket, key, bucket, key, copyOptions{SourceEncryption: sourceSSE, Encryption: sse, Metadata: metadata})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type overwriteMode int
+
+const (
+	overwriteAsk overwriteMode = iota
+	overwriteAll
+	overwriteNone
+)
+
+// overwritePolicy decides whether existing destination objects may be replaced. The user is asked for every object until a decision for all remaining objects has been made.
+type overwritePolicy struct {
+	mode overwriteMode
+}
+
+// newOverwritePolicy returns the policy selected by the "--force" and "--no-clobber" flags. In dry-run mode the user is never asked.
+func newOverwritePolicy(flags map[string]string, dryRun bool) (*overwritePolicy, error) {
+	_, force := flags["--force"]
+	_, noClobber := flags["--no-clobber"]
+	if force && noClobber {
+		return nil, fmt.Errorf("--force and --no-clobber can not be used together")
+	}
+
+	if force || (dryRun && !noClobber) {
+		return &overwritePolicy{overwriteAll}, nil
+	} else if noClobber {
+		return &overwritePolicy{overwriteNone}, nil
+	}
+	return &overwritePolicy{overwriteAsk}, nil
+}
+
+// NeedsExisting returns false when existing objects are always overwritten and do not need to be determined.
+func (p *overwritePolicy) NeedsExisting() bool {
+	return p.mode != overwriteAll
+}
+
+// Allow returns true if the existing object with given key may be overwritten. Returns errUserAbort if the user aborted the operation.
+func (p *overwritePolicy) Allow(key string) (bool, error) {
+	switch p.mode {
+	case overwriteAll:
+		return true, nil
+	case overwriteNone:
+		return false, nil
+	}
+
+	for {
+		fmt.Printf("Object %q already exists. Overwrite? [y]es / [n]o / [a]ll / [s]kip all / [q]uit> ", key)
+		str, err := readln()
+		if err != nil {
+			return false, err
+		}
+
+		switch strings.ToLower(strings.TrimSpace(str)) {
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		case "a", "all":
+			p.mode = overwriteAll
+			return true, nil
+		case "s", "skip all":
+			p.mode = overwriteNone
+			return false, nil
+		case "q", "quit":
+			return false, errUserAbort{}
+		}
+	}
+}
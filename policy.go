@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// bucketPolicy is an S3 bucket policy document.
+type bucketPolicy struct {
+	Version   string
+	Id        string `json:",omitempty"`
+	Statement []policyStatement
+}
+
+// policyStatement is a single statement of a bucket policy. Principal, Action and Resource may be a single value or a list.
+type policyStatement struct {
+	Sid          string `json:",omitempty"`
+	Effect       string
+	Principal    interface{}                       `json:",omitempty"`
+	NotPrincipal interface{}                       `json:",omitempty"`
+	Action       interface{}                       `json:",omitempty"`
+	NotAction    interface{}                       `json:",omitempty"`
+	Resource     interface{}                       `json:",omitempty"`
+	NotResource  interface{}                       `json:",omitempty"`
+	Condition    map[string]map[string]interface{} `json:",omitempty"`
+}
+
+var (
+	// policyPresets are the canned policies available for "policy set". Presets with prefix grant access to keys starting with the given prefix only.
+	policyPresets = []string{"private", "public-read", "public-read-prefix", "upload-only"}
+)
+
+func policy(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"-n"}})
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("missing parameter action. Possible actions are \"get\" and \"set\"")
+	}
+
+	action := args[0]
+	args = args[1:]
+	switch action {
+	case "get":
+		if err := checkArgs(s, args, argOptions{ArgLabels: []string{"bucket name"}, MinArgs: 0, RequireBucket: len(args) == 0}); err != nil {
+			return err
+		}
+		bucket := s.Bucket
+		if len(args) > 0 {
+			bucket = args[0]
+		}
+		return printPolicy(s, bucket)
+
+	case "set":
+		dryRun := isDryRun(s, flags)
+		if err := checkArgs(s, args, argOptions{ArgLabels: []string{"bucket name", "file or preset", "prefix"}, MinArgs: 2, Mutating: !dryRun}); err != nil {
+			return err
+		}
+		return setPolicy(s, args[0], args[1], args[2:], dryRun)
+
+	default:
+		return fmt.Errorf("unknown policy action %q. Possible actions are \"get\" and \"set\"", action)
+	}
+}
+
+func printPolicy(s *Session, bucket string) error {
+	str, err := s.Store.GetBucketPolicy(bucket)
+	if err != nil {
+		return err
+	}
+	if len(str) == 0 {
+		printlnf("Bucket %q has no policy. Only authenticated users can access it", bucket)
+		return nil
+	}
+
+	var buffer bytes.Buffer
+	if err := json.Indent(&buffer, []byte(str), "", "  "); err != nil {
+		// print invalid documents as they are instead of hiding them
+		printlnf("%s", str)
+		return nil
+	}
+	printlnf("%s", buffer.String())
+	return nil
+}
+
+func setPolicy(s *Session, bucket, source string, args []string, dryRun bool) error {
+	var str string
+	if isPolicyPreset(source) {
+		prefix := ""
+		if source == "public-read-prefix" {
+			if len(args) == 0 {
+				return fmt.Errorf("missing parameter prefix")
+			}
+			prefix = strings.TrimPrefix(args[0], "/")
+		} else if len(args) > 0 {
+			if source != "upload-only" {
+				return fmt.Errorf("too many arguments")
+			}
+			prefix = strings.TrimPrefix(args[0], "/")
+		}
+
+		var err error
+		if str, err = presetPolicy(source, bucket, prefix); err != nil {
+			return err
+		}
+
+	} else {
+		if len(args) > 0 {
+			return fmt.Errorf("too many arguments")
+		}
+		data, err := ioutil.ReadFile(source)
+		if err != nil {
+			return err
+		}
+		if err := validatePolicy(bucket, data); err != nil {
+			return err
+		}
+		str = string(data)
+	}
+
+	if dryRun {
+		printDryRun(printlnf, fmt.Sprintf("set %s policy of bucket", source), bucket)
+		return nil
+	}
+	if err := s.Store.SetBucketPolicy(bucket, str); err != nil {
+		return err
+	}
+
+	if len(str) == 0 {
+		printlnf("Policy of bucket %q has been removed", bucket)
+	} else {
+		printlnf("Policy of bucket %q has been updated", bucket)
+	}
+	return nil
+}
+
+func isPolicyPreset(name string) bool {
+	for _, preset := range policyPresets {
+		if preset == name {
+			return true
+		}
+	}
+	return false
+}
+
+// presetPolicy returns the JSON document of a canned policy. The private preset is an empty policy.
+func presetPolicy(preset, bucket, prefix string) (string, error) {
+	anyone := map[string][]string{"AWS": {"*"}}
+	objects := fmt.Sprintf("arn:aws:s3:::%s/%s*", bucket, prefix)
+
+	var statements []policyStatement
+	switch preset {
+	case "private":
+		return "", nil
+	case "public-read":
+		statements = []policyStatement{
+			{Effect: "Allow", Principal: anyone, Action: []string{"s3:GetBucketLocation", "s3:ListBucket"}, Resource: []string{"arn:aws:s3:::" + bucket}},
+			{Effect: "Allow", Principal: anyone, Action: []string{"s3:GetObject"}, Resource: []string{objects}},
+		}
+	case "public-read-prefix":
+		if len(prefix) == 0 {
+			return "", fmt.Errorf("prefix must not be empty. Use \"public-read\" to make the whole bucket public")
+		}
+		statements = []policyStatement{
+			// listing is only allowed below the prefix
+			{Effect: "Allow", Principal: anyone, Action: []string{"s3:ListBucket"}, Resource: []string{"arn:aws:s3:::" + bucket}, Condition: map[string]map[string]interface{}{"StringLike": {"s3:prefix": []string{prefix + "*"}}}},
+			{Effect: "Allow", Principal: anyone, Action: []string{"s3:GetObject"}, Resource: []string{objects}},
+		}
+	case "upload-only":
+		statements = []policyStatement{
+			{Effect: "Allow", Principal: anyone, Action: []string{"s3:PutObject"}, Resource: []string{objects}},
+		}
+	default:
+		return "", fmt.Errorf("unknown policy preset %q", preset)
+	}
+
+	data, err := json.Marshal(bucketPolicy{Version: "2012-10-17", Statement: statements})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// validatePolicy checks a policy document for common mistakes before it is sent to the server, which only returns generic errors.
+func validatePolicy(bucket string, data []byte) error {
+	var doc bucketPolicy
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// misspelled elements would otherwise be dropped silently
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		return fmt.Errorf("invalid policy document: %v", err)
+	}
+
+	if doc.Version != "2012-10-17" && doc.Version != "2008-10-17" {
+		return fmt.Errorf("invalid policy document: Version must be \"2012-10-17\"")
+	}
+	if len(doc.Statement) == 0 {
+		return fmt.Errorf("invalid policy document: no statements found")
+	}
+
+	for i, st := range doc.Statement {
+		if st.Effect != "Allow" && st.Effect != "Deny" {
+			return fmt.Errorf("invalid policy document: Effect of statement %d must be \"Allow\" or \"Deny\"", i+1)
+		}
+		if st.Principal == nil && st.NotPrincipal == nil {
+			return fmt.Errorf("invalid policy document: statement %d has no Principal", i+1)
+		}
+
+		actions := append(stringList(st.Action), stringList(st.NotAction)...)
+		if len(actions) == 0 {
+			return fmt.Errorf("invalid policy document: statement %d has no Action", i+1)
+		}
+		for _, action := range actions {
+			if action != "*" && !strings.HasPrefix(action, "s3:") {
+				return fmt.Errorf("invalid policy document: action %q of statement %d is no S3 action", action, i+1)
+			}
+		}
+
+		resources := append(stringList(st.Resource), stringList(st.NotResource)...)
+		if len(resources) == 0 {
+			return fmt.Errorf("invalid policy document: statement %d has no Resource", i+1)
+		}
+		for _, resource := range resources {
+			// bucket policies can only grant access to the bucket itself
+			if resource != "arn:aws:s3:::"+bucket && !strings.HasPrefix(resource, "arn:aws:s3:::"+bucket+"/") {
+				return fmt.Errorf("invalid policy document: resource %q of statement %d does not belong to bucket %q", resource, i+1, bucket)
+			}
+		}
+	}
+	return nil
+}
+
+// stringList returns the strings of a JSON value that is either a single string or a list of strings.
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				list = append(list, str)
+			}
+		}
+		return list
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPresetPolicy(t *testing.T) {
+	tests := []struct {
+		preset string
+		prefix string
+		policy string
+		err    bool
+	}{
+		{"private", "", "", false},
+		{"public-read", "", `{"Version":"2012-10-17","Statement":[` +
+			`{"Effect":"Allow","Principal":{"AWS":["*"]},"Action":["s3:GetBucketLocation","s3:ListBucket"],"Resource":["arn:aws:s3:::b"]},` +
+			`{"Effect":"Allow","Principal":{"AWS":["*"]},"Action":["s3:GetObject"],"Resource":["arn:aws:s3:::b/*"]}]}`, false},
+		{"public-read-prefix", "pub/", `{"Version":"2012-10-17","Statement":[` +
+			`{"Effect":"Allow","Principal":{"AWS":["*"]},"Action":["s3:ListBucket"],"Resource":["arn:aws:s3:::b"],"Condition":{"StringLike":{"s3:prefix":["pub/*"]}}},` +
+			`{"Effect":"Allow","Principal":{"AWS":["*"]},"Action":["s3:GetObject"],"Resource":["arn:aws:s3:::b/pub/*"]}]}`, false},
+		{"public-read-prefix", "", "", true},
+		{"upload-only", "", `{"Version":"2012-10-17","Statement":[` +
+			`{"Effect":"Allow","Principal":{"AWS":["*"]},"Action":["s3:PutObject"],"Resource":["arn:aws:s3:::b/*"]}]}`, false},
+		{"upload-only", "in/", `{"Version":"2012-10-17","Statement":[` +
+			`{"Effect":"Allow","Principal":{"AWS":["*"]},"Action":["s3:PutObject"],"Resource":["arn:aws:s3:::b/in/*"]}]}`, false},
+		{"public-write", "", "", true},
+	}
+	for _, test := range tests {
+		policy, err := presetPolicy(test.preset, "b", test.prefix)
+		if (err != nil) != test.err {
+			t.Errorf("preset %q with prefix %q: unexpected error %v", test.preset, test.prefix, err)
+			continue
+		}
+		if policy != test.policy {
+			t.Errorf("preset %q with prefix %q:\n%s\nexpected\n%s", test.preset, test.prefix, policy, test.policy)
+		}
+		// presets must pass the checks of custom policies
+		if len(policy) > 0 {
+			if err := validatePolicy("b", []byte(policy)); err != nil {
+				t.Errorf("preset %q with prefix %q is invalid: %v", test.preset, test.prefix, err)
+			}
+		}
+	}
+}
+
+func TestValidatePolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		err    bool
+	}{
+		{"single values", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`, false},
+		{"negations", `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","NotPrincipal":{"AWS":["arn:aws:iam::1:root"]},"NotAction":["s3:GetObject"],"NotResource":["arn:aws:s3:::b"]}]}`, false},
+		{"all actions", `{"Version":"2008-10-17","Statement":[{"Effect":"Allow","Principal":"*","Action":"*","Resource":"arn:aws:s3:::b"}]}`, false},
+		{"foreign bucket", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::other/*"}]}`, true},
+		{"bucket name prefix", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::bb/*"}]}`, true},
+		{"foreign resource in list", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":["arn:aws:s3:::b/*","arn:aws:s3:::other/*"]}]}`, true},
+		{"non-S3 action", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":"*","Action":["s3:GetObject","iam:PassRole"],"Resource":"arn:aws:s3:::b/*"}]}`, true},
+		{"missing Principal", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`, true},
+		{"missing Action", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":"*","Resource":"arn:aws:s3:::b/*"}]}`, true},
+		{"missing Resource", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:GetObject"}]}`, true},
+		{"misspelled field", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":"*","Actions":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`, true},
+		{"misspelled Effect", `{"Version":"2012-10-17","Statement":[{"Effect":"allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`, true},
+		{"wrong Version", `{"Version":"2020-01-01","Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`, true},
+		{"no statements", `{"Version":"2012-10-17","Statement":[]}`, true},
+		{"no JSON", `Version: 2012-10-17`, true},
+	}
+	for _, test := range tests {
+		if err := validatePolicy("b", []byte(test.policy)); (err != nil) != test.err {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+	}
+}
+
+func TestPolicySet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3client-test")
+	must(t, err)
+	defer os.RemoveAll(dir)
+	foreign := filepath.Join(dir, "foreign.json")
+	must(t, ioutil.WriteFile(foreign, []byte(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::other/*"}]}`), 0644))
+
+	mustPreset := func(preset, prefix string) string {
+		str, err := presetPolicy(preset, "b", prefix)
+		must(t, err)
+		return str
+	}
+	old := mustPreset("upload-only", "")
+
+	tests := []struct {
+		args []string
+		// policy is the stored policy afterwards
+		policy string
+		err    bool
+	}{
+		{[]string{"set", "b", "public-read-prefix", "/pub/"}, mustPreset("public-read-prefix", "pub/"), false},
+		{[]string{"set", "b", "public-read-prefix"}, old, true},
+		{[]string{"set", "b", "public-read", "pub/"}, old, true},
+		{[]string{"set", "b", "private"}, "", false},
+		{[]string{"set", "b", foreign}, old, true},
+		{[]string{"-n", "set", "b", "private"}, old, false},
+	}
+	for _, test := range tests {
+		s := newTestSession(t)
+		must(t, s.Store.SetBucketPolicy("b", old))
+
+		_, err := captureOutput(func() error { return policy(s, test.args) })
+		if (err != nil) != test.err {
+			t.Errorf("policy %v: unexpected error %v", test.args, err)
+		}
+		if str, err := s.Store.GetBucketPolicy("b"); err != nil || str != test.policy {
+			t.Errorf("policy %v stored %q, expected %q", test.args, str, test.policy)
+		}
+	}
+}
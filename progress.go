@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sbreitf1/go-console"
+)
+
+var (
+	progressEnabled = true
+)
+
+func disableProgress() {
+	progressEnabled = false
+}
+
+// progressBar renders the state of a transfer in a single terminal line. All methods can safely be called on a nil or disabled progress bar.
+type progressBar struct {
+	mutex      sync.Mutex
+	label      string
+	total      int64
+	done       int64
+	start      time.Time
+	lastRender time.Time
+	visible    bool
+}
+
+func newProgressBar(label string, total int64) *progressBar {
+	if !progressEnabled {
+		return nil
+	}
+	return &progressBar{label: label, total: total, start: time.Now()}
+}
+
+// Add marks n more bytes as transferred.
+func (p *progressBar) Add(n int64) {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.done += n
+	// limit redraws to keep the terminal responsive for fast transfers
+	if time.Since(p.lastRender) >= 100*time.Millisecond {
+		p.render()
+	}
+}
+
+// SetLabel changes the text displayed in front of the bar.
+func (p *progressBar) SetLabel(label string) {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.label = label
+	p.render()
+}
+
+// Read implements io.Reader to be used as progress hook for minio.PutObjectOptions.
+func (p *progressBar) Read(b []byte) (int, error) {
+	p.Add(int64(len(b)))
+	return len(b), nil
+}
+
+// Write implements io.Writer to be used with io.TeeReader.
+func (p *progressBar) Write(b []byte) (int, error) {
+	p.Add(int64(len(b)))
+	return len(b), nil
+}
+
+// Printlnf prints a line of text above the progress bar.
+func (p *progressBar) Printlnf(format string, args ...interface{}) {
+	if p == nil {
+		printlnf(format, args...)
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.clear()
+	printlnf(format, args...)
+	p.render()
+}
+
+// Finish renders the final state and moves the cursor to the next line.
+func (p *progressBar) Finish() {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.render()
+	fmt.Println()
+	p.visible = false
+}
+
+// Clear removes the progress bar from the terminal.
+func (p *progressBar) Clear() {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.clear()
+}
+
+func (p *progressBar) clear() {
+	if p.visible {
+		fmt.Print("\r\033[K")
+		p.visible = false
+	}
+}
+
+func (p *progressBar) render() {
+	elapsed := time.Since(p.start)
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(p.done) / elapsed.Seconds()
+	}
+
+	eta := "--"
+	if rate > 0 && p.total > p.done {
+		eta = time.Duration(float64(p.total-p.done) / rate * float64(time.Second)).Round(time.Second).String()
+	} else if p.total > 0 && p.done >= p.total {
+		eta = "0s"
+	}
+
+	stats := fmt.Sprintf(" %s / %s  %s/s  ETA %s", humanize.IBytes(uint64(p.done)), humanize.IBytes(uint64(p.total)), humanize.IBytes(uint64(rate)), eta)
+
+	width := 80
+	if w, _, err := console.GetSize(); err == nil && w > 0 {
+		width = w
+	}
+
+	label := p.label
+	// reserve space for brackets and percentage
+	barWidth := width - len(label) - len(stats) - 10
+	if barWidth < 10 {
+		// shorten the label first to keep the bar readable on small terminals
+		maxLabel := width - len(stats) - 20
+		if maxLabel < 0 {
+			maxLabel = 0
+		}
+		if len(label) > maxLabel {
+			label = label[:maxLabel]
+		}
+		barWidth = 10
+	}
+
+	percent := 100.0
+	if p.total > 0 {
+		percent = 100 * float64(p.done) / float64(p.total)
+		if percent > 100 {
+			percent = 100
+		}
+	}
+	filled := int(float64(barWidth) * percent / 100)
+
+	fmt.Printf("\r\033[K%s [%s%s] %3.0f%%%s", label, strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled), percent, stats)
+	p.lastRender = time.Now()
+	p.visible = true
+}
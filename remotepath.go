@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// bucketPathPattern matches the "bucket:/key" notation. The slash is required to not confuse keys containing colons with bucket names.
+	bucketPathPattern = regexp.MustCompile(`^([a-z0-9][a-z0-9.\-]*):(/.*)?$`)
+	// envPathPattern matches the "env:bucket:/key" notation for objects of another open environment.
+	envPathPattern = regexp.MustCompile(`^([a-zA-Z0-9_\- ]+):([a-z0-9][a-z0-9.\-]*:(/.*)?)$`)
+)
+
+// remotePath is a fully resolved location of an object or directory. Key never has leading or trailing slashes and is empty for the bucket root.
+type remotePath struct {
+	Bucket string
+	Key    string
+}
+
+// IsRoot returns true if the path references the bucket root.
+func (p remotePath) IsRoot() bool {
+	return len(p.Key) == 0
+}
+
+// Dir returns the key prefix of all objects inside this path when treated as directory.
+func (p remotePath) Dir() string {
+	if p.IsRoot() {
+		return ""
+	}
+	return p.Key + "/"
+}
+
+// isBucketPath returns true if the path explicitly names a bucket.
+func isBucketPath(arg string) bool {
+	return strings.HasPrefix(arg, "s3://") || bucketPathPattern.MatchString(arg) || envPathPattern.MatchString(arg)
+}
+
+// resolveSessionPath is like resolvePath, but also accepts "env:bucket:/key" paths and returns the open session of the named environment for them.
+func resolveSessionPath(s *Session, arg string) (*Session, remotePath, error) {
+	if m := envPathPattern.FindStringSubmatch(arg); m != nil {
+		var other *Session
+		ok := false
+		if s.sessions != nil {
+			other, ok = s.sessions.Get(m[1])
+		}
+		if !ok {
+			return nil, remotePath{}, fmt.Errorf("environment %q is not open. Use \"open %s\" first", m[1], m[1])
+		}
+		p, err := resolvePath(other, m[2])
+		return other, p, err
+	}
+
+	p, err := resolvePath(s, arg)
+	return s, p, err
+}
+
+// resolvePath converts a path argument to a location in a bucket. Paths are relative to the current directory unless they start with "/" for the current bucket root, "bucket:/" or "s3://bucket/". The segments "." and ".." are allowed anywhere.
+func resolvePath(s *Session, arg string) (remotePath, error) {
+	bucket, key := s.Bucket, arg
+	if strings.HasPrefix(arg, "s3://") {
+		parts := strings.SplitN(arg[len("s3://"):], "/", 2)
+		bucket, key = parts[0], ""
+		if len(parts) > 1 {
+			key = parts[1]
+		}
+		if len(bucket) == 0 {
+			return remotePath{}, fmt.Errorf("missing bucket name in %q", arg)
+		}
+
+	} else if m := bucketPathPattern.FindStringSubmatch(arg); m != nil {
+		bucket, key = m[1], m[2]
+
+	} else if !strings.HasPrefix(arg, "/") {
+		key = s.Prefix + arg
+	}
+
+	if len(bucket) == 0 {
+		return remotePath{}, errNoBucket()
+	}
+	return remotePath{bucket, cleanKey(key)}, nil
+}
+
+// cleanKey removes empty and "." segments and applies ".." segments. Going above the bucket root is ignored like in bash.
+func cleanKey(key string) string {
+	segments := make([]string, 0)
+	for _, seg := range strings.Split(key, "/") {
+		switch seg {
+		case "", ".":
+		case "..":
+			if len(segments) > 0 {
+				segments = segments[:len(segments)-1]
+			}
+		default:
+			segments = append(segments, seg)
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/s3signer"
+	"github.com/minio/minio-go/pkg/s3utils"
+)
+
+/* ################################################ */
+/* ###            raw S3 API requests           ### */
+/* ################################################ */
+
+// minio-go does not cover all sub-resources of the S3 API (e.g. "?tagging"), so these requests are signed and sent manually.
+
+// rawRequestTimeout limits connecting and waiting for the response headers of raw requests. Reading the body is not limited, because object versions are downloaded the same way.
+const rawRequestTimeout = 30 * time.Second
+
+func newRawHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: rawRequestTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = rawRequestTimeout
+	transport.ResponseHeaderTimeout = rawRequestTimeout
+	return &http.Client{Transport: transport}
+}
+
+// bucketRegion returns the region to sign requests for a bucket with. The region of the environment is preferred, otherwise the bucket location is requested once and cached.
+func (s *minioStore) bucketRegion(bucket string) string {
+	if len(s.target.Region) > 0 {
+		return s.target.Region
+	}
+	if len(bucket) == 0 {
+		return "us-east-1"
+	}
+
+	s.regionMutex.Lock()
+	defer s.regionMutex.Unlock()
+	if region, ok := s.regions[bucket]; ok {
+		return region
+	}
+	region, err := s.client.GetBucketLocation(bucket)
+	if err != nil {
+		// failures are not cached, the request itself reports the actual problem
+		return "us-east-1"
+	}
+	if len(region) == 0 {
+		region = "us-east-1"
+	}
+	s.regions[bucket] = region
+	return region
+}
+
+// do sends a signed request for the given bucket sub-resource or object and returns the response body. Error responses are returned as minio.ErrorResponse.
+func (s *minioStore) do(method, bucket, key string, query url.Values, header http.Header, body []byte) (http.Header, []byte, error) {
+	resp, err := s.request(method, bucket, key, query, header, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Header, data, nil
+}
+
+// request is like do, but returns the successful response with unread body, which must be closed by the caller.
+func (s *minioStore) request(method, bucket, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	scheme := "http"
+	if s.target.Secure {
+		scheme = "https"
+	}
+	u := &url.URL{Scheme: scheme, Host: s.target.Endpoint, Path: "/" + bucket + "/" + key, RawQuery: s3utils.QueryEncode(query)}
+	u.RawPath = s3utils.EncodePath(u.Path)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	hash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(hash[:]))
+	if len(body) > 0 {
+		// required by some sub-resources like "?tagging"
+		md5sum := md5.Sum(body)
+		req.Header.Set("Content-Md5", base64.StdEncoding.EncodeToString(md5sum[:]))
+	}
+	req.ContentLength = int64(len(body))
+
+	creds, err := s.creds.Get()
+	if err != nil {
+		return nil, err
+	}
+	req = s3signer.SignV4(*req, creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken, s.bucketRegion(bucket))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+
+		errResp := minio.ErrorResponse{StatusCode: resp.StatusCode, BucketName: bucket, Key: key}
+		if err := xml.Unmarshal(data, &errResp); err != nil || len(errResp.Code) == 0 {
+			errResp.Code = resp.Status
+			errResp.Message = fmt.Sprintf("%s %s failed with status %s", method, u.Path, resp.Status)
+		}
+		return nil, errResp
+	}
+	return resp, nil
+}
+
+type tagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	TagSet  []tag    `xml:"TagSet>Tag"`
+}
+
+type tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+func (s *minioStore) GetObjectTags(bucket, key string) (map[string]string, error) {
+	_, data, err := s.do(http.MethodGet, bucket, key, url.Values{"tagging": []string{""}}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var t tagging
+	if err := xml.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string)
+	for _, tag := range t.TagSet {
+		tags[tag.Key] = tag.Value
+	}
+	return tags, nil
+}
+
+func (s *minioStore) SetObjectTags(bucket, key string, tags map[string]string) error {
+	t := tagging{TagSet: make([]tag, 0, len(tags))}
+	for k, v := range tags {
+		t.TagSet = append(t.TagSet, tag{k, v})
+	}
+	body, err := xml.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = s.do(http.MethodPut, bucket, key, url.Values{"tagging": []string{""}}, nil, body)
+	return err
+}
+
+func (s *minioStore) RemoveObjectTags(bucket, key string) error {
+	_, _, err := s.do(http.MethodDelete, bucket, key, url.Values{"tagging": []string{""}}, nil, nil)
+	return err
+}
+
+type versioningConfiguration struct {
+	XMLName xml.Name `xml:"VersioningConfiguration"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	Status  string   `xml:"Status,omitempty"`
+}
+
+func (s *minioStore) GetBucketVersioning(bucket string) (string, error) {
+	_, data, err := s.do(http.MethodGet, bucket, "", url.Values{"versioning": []string{""}}, nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var config versioningConfiguration
+	if err := xml.Unmarshal(data, &config); err != nil {
+		return "", err
+	}
+	return config.Status, nil
+}
+
+func (s *minioStore) SetBucketVersioning(bucket, status string) error {
+	body, err := xml.Marshal(versioningConfiguration{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/", Status: status})
+	if err != nil {
+		return err
+	}
+
+	_, _, err = s.do(http.MethodPut, bucket, "", url.Values{"versioning": []string{""}}, nil, body)
+	return err
+}
+
+type listVersionsResult struct {
+	IsTruncated         bool
+	NextKeyMarker       string
+	NextVersionIdMarker string
+	Versions            []versionEntry `xml:"Version"`
+	DeleteMarkers       []versionEntry `xml:"DeleteMarker"`
+	CommonPrefixes      []struct {
+		Prefix string
+	}
+}
+
+type versionEntry struct {
+	Key          string
+	VersionId    string
+	IsLatest     bool
+	LastModified time.Time
+	ETag         string
+	Size         int64
+}
+
+func (s *minioStore) ListObjectVersions(bucket, prefix string, recursive bool) ([]objectVersion, error) {
+	query := url.Values{"versions": []string{""}, "prefix": []string{prefix}}
+	if !recursive {
+		query.Set("delimiter", "/")
+	}
+
+	versions := make([]objectVersion, 0)
+	for {
+		_, data, err := s.do(http.MethodGet, bucket, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listVersionsResult
+		if err := xml.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+
+		for _, v := range result.Versions {
+			versions = append(versions, objectVersion{Key: v.Key, VersionID: v.VersionId, IsLatest: v.IsLatest, LastModified: v.LastModified, Size: v.Size, ETag: strings.Trim(v.ETag, "\"")})
+		}
+		for _, v := range result.DeleteMarkers {
+			versions = append(versions, objectVersion{Key: v.Key, VersionID: v.VersionId, IsLatest: v.IsLatest, IsDeleteMarker: true, LastModified: v.LastModified})
+		}
+		for _, p := range result.CommonPrefixes {
+			versions = append(versions, objectVersion{Key: p.Prefix})
+		}
+
+		if !result.IsTruncated {
+			break
+		}
+		query.Set("key-marker", result.NextKeyMarker)
+		query.Set("version-id-marker", result.NextVersionIdMarker)
+	}
+
+	// versions and delete markers are returned in separate lists
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].Key != versions[j].Key {
+			return versions[i].Key < versions[j].Key
+		}
+		return versions[i].LastModified.After(versions[j].LastModified)
+	})
+	return versions, nil
+}
+
+func (s *minioStore) GetObjectVersion(bucket, key, versionID string, opts minio.GetObjectOptions) (io.ReadCloser, minio.ObjectInfo, error) {
+	header := opts.Header()
+	// the content is verified against ETag and size, so it must not be decompressed transparently
+	header.Set("Accept-Encoding", "identity")
+	resp, err := s.request(http.MethodGet, bucket, key, url.Values{"versionId": []string{versionID}}, header, nil)
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+	info := minio.ObjectInfo{Key: key, ETag: strings.Trim(resp.Header.Get("ETag"), "\""), Size: resp.ContentLength, ContentType: resp.Header.Get("Content-Type"), Metadata: resp.Header}
+	return resp.Body, info, nil
+}
+
+func (s *minioStore) RemoveObjectVersion(bucket, key, versionID string) error {
+	_, _, err := s.do(http.MethodDelete, bucket, key, url.Values{"versionId": []string{versionID}}, nil, nil)
+	return err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRawRequestRegion(t *testing.T) {
+	tests := []struct {
+		region string
+		// scope is the region expected in the signature of raw requests
+		scope     string
+		locations int
+	}{
+		{"", "eu-west-3", 1},
+		{"eu-central-1", "eu-central-1", 0},
+	}
+	for _, test := range tests {
+		var mutex sync.Mutex
+		locations := 0
+		scopes := make([]string, 0)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if _, ok := r.URL.Query()["location"]; ok {
+				locations++
+				w.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">eu-west-3</LocationConstraint>`))
+				return
+			}
+			scopes = append(scopes, strings.Split(r.Header.Get("Authorization"), "/")[2])
+			w.Write([]byte(`<Tagging><TagSet><Tag><Key>k</Key><Value>v</Value></Tag></TagSet></Tagging>`))
+		}))
+
+		store, err := newMinioStore(S3Target{Endpoint: strings.TrimPrefix(srv.URL, "http://"), AccessKey: "AK", SecretKey: "SK", Region: test.region})
+		must(t, err)
+		for i := 0; i < 3; i++ {
+			tags, err := store.GetObjectTags("bucket", "k")
+			must(t, err)
+			if tags["k"] != "v" {
+				t.Errorf("region %q: got tags %v", test.region, tags)
+			}
+		}
+		srv.Close()
+
+		if locations != test.locations {
+			t.Errorf("region %q: bucket location requested %d times, expected %d", test.region, locations, test.locations)
+		}
+		for _, scope := range scopes {
+			if scope != test.scope {
+				t.Errorf("region %q: request signed for %q, expected %q", test.region, scope, test.scope)
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Session contains the connection and navigation state of a single environment.
+type Session struct {
+	Target S3Target
+	Store  ObjectStore
+	Bucket string
+	Prefix string
+	// DryRun only prints the effect of all modifying commands.
+	DryRun bool
+
+	clientKeys *clientKeys
+	// sessions contains all sessions open together with this one, which can be addressed by "env:bucket:/key" paths.
+	sessions *Sessions
+}
+
+// NewSession connects to the given target and returns a new session without entering any bucket.
+func NewSession(target S3Target) (*Session, error) {
+	var store ObjectStore
+	if target.InMemory {
+		memStore := newMemoryStore()
+		if len(target.DefaultBucket) > 0 {
+			// an empty store would always fail to enter the default bucket
+			if err := memStore.MakeBucket(target.DefaultBucket); err != nil {
+				return nil, err
+			}
+		}
+		store = memStore
+	} else {
+		if err := unlockSecrets(&target); err != nil {
+			return nil, err
+		}
+		minioStore, err := newMinioStore(target)
+		if err != nil {
+			return nil, err
+		}
+		store = minioStore
+	}
+
+	return &Session{Target: target, Store: store, clientKeys: newClientKeys()}, nil
+}
+
+// credentialExpiration returns when the temporary credentials of the session expire.
+func (s *Session) credentialExpiration() (time.Time, bool) {
+	if store, ok := s.Store.(*minioStore); ok {
+		return store.credentialExpiration()
+	}
+	return time.Time{}, false
+}
+
+// Sessions keeps track of all open sessions and the currently active one.
+type Sessions struct {
+	open    map[string]*Session
+	current *Session
+	// ReadOnly forces all environments opened later to be read-only.
+	ReadOnly bool
+	// DryRun is applied to all environments opened later.
+	DryRun bool
+}
+
+// NewSessions returns a session list containing only the given session, which is also the active one.
+func NewSessions(s *Session) *Sessions {
+	l := &Sessions{open: map[string]*Session{s.Target.Key: s}, current: s}
+	s.sessions = l
+	return l
+}
+
+// Current returns the active session.
+func (l *Sessions) Current() *Session {
+	return l.current
+}
+
+// Get returns the open session for the given environment key.
+func (l *Sessions) Get(key string) (*Session, bool) {
+	s, ok := l.open[key]
+	return s, ok
+}
+
+// Keys returns the sorted environment keys of all open sessions.
+func (l *Sessions) Keys() []string {
+	keys := make([]string, 0, len(l.open))
+	for key := range l.open {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Add registers a new session and makes it the active one.
+func (l *Sessions) Add(s *Session) error {
+	if _, ok := l.open[s.Target.Key]; ok {
+		return fmt.Errorf("environment %q is already open", s.Target.Key)
+	}
+	l.open[s.Target.Key] = s
+	l.current = s
+	s.sessions = l
+	return nil
+}
+
+// Switch makes the open session of the given environment the active one.
+func (l *Sessions) Switch(key string) error {
+	s, ok := l.open[key]
+	if !ok {
+		return fmt.Errorf("environment %q is not open", key)
+	}
+	l.current = s
+	return nil
+}
+
+// Close removes the session of the given environment. The active session can not be closed.
+func (l *Sessions) Close(key string) error {
+	s, ok := l.open[key]
+	if !ok {
+		return fmt.Errorf("environment %q is not open", key)
+	}
+	if s == l.current {
+		return fmt.Errorf("cannot close the active environment %q", key)
+	}
+	delete(l.open, key)
+	return nil
+}
+
+// bind returns a command handler that executes the given handler with the session active at call time.
+func (l *Sessions) bind(handler func(*Session, []string) error) func([]string) error {
+	return func(args []string) error {
+		return handler(l.current, args)
+	}
+}
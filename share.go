@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	defaultShareExpiry = 24 * time.Hour
+	// maxShareExpiry is the longest validity of presigned URLs with signature version 4.
+	maxShareExpiry = 7 * 24 * time.Hour
+)
+
+func share(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"-r", "--upload", "--post"}, Value: []string{"--expires", "--content-type", "--max-size", "-o"}})
+	if err != nil {
+		return err
+	}
+	_, upload := flags["--upload"]
+	// upload links allow anyone to write to the bucket
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"object name"}, MinArgs: 1, RequireBucket: false, Mutating: upload}); err != nil {
+		return err
+	}
+
+	expires := defaultShareExpiry
+	if str, ok := flags["--expires"]; ok {
+		if expires, err = parseExpiry(str); err != nil {
+			return err
+		}
+	}
+	if expiration, ok := s.credentialExpiration(); ok && expiration.Before(time.Now().Add(expires)) {
+		// presigned URLs are only valid as long as the credentials used to sign them
+		printlnf("Note: the URLs stop working earlier, because the temporary credentials %s", formatLifetime(expiration))
+	}
+
+	p, err := resolvePath(s, args[0])
+	if err != nil {
+		return err
+	}
+
+	if upload {
+		return shareUpload(s, p, args[0], expires, flags)
+	}
+	for _, name := range []string{"--post", "--content-type", "--max-size"} {
+		if _, ok := flags[name]; ok {
+			return fmt.Errorf("flag %s is only allowed with \"--upload\"", name)
+		}
+	}
+
+	_, recursive := flags["-r"]
+	prefix, keys, err := selectObjects(s, p, recursive, args[0])
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		printlnf("No objects found.")
+		return nil
+	}
+
+	urls := make([]string, len(keys))
+	for i, key := range keys {
+		if urls[i], err = s.Store.PresignGet(p.Bucket, key, expires); err != nil {
+			return err
+		}
+	}
+
+	if outFile, ok := flags["-o"]; ok {
+		// plain list of URLs to hand over to others
+		if err := ioutil.WriteFile(outFile, []byte(strings.Join(urls, "\n")+"\n"), 0644); err != nil {
+			return err
+		}
+		printlnf("Wrote %d download URLs valid until %s to %q", len(urls), formatExpiry(expires), outFile)
+		return nil
+	}
+
+	if len(keys) == 1 && keys[0] == p.Key {
+		printlnf("Download URL for %q valid until %s:", p.Key, formatExpiry(expires))
+		printlnf("%s", urls[0])
+		return nil
+	}
+	printlnf("Download URLs for %d objects valid until %s:", len(keys), formatExpiry(expires))
+	for i, key := range keys {
+		printlnf("  %s%s%s", colorPrefix, key[len(prefix):], colorEnd)
+		printlnf("  %s", urls[i])
+	}
+	return nil
+}
+
+// shareUpload prints a presigned PUT URL, or a POST policy if the upload needs to be restricted.
+func shareUpload(s *Session, p remotePath, arg string, expires time.Duration, flags map[string]string) error {
+	if _, ok := flags["-r"]; ok {
+		return fmt.Errorf("upload links can not be recursive. Please use \"--upload\" with a directory to allow uploads of any file below it")
+	}
+	if _, ok := flags["-o"]; ok {
+		return fmt.Errorf("flag -o is not allowed with \"--upload\"")
+	}
+	policy := uploadPolicy{Bucket: p.Bucket, Key: p.Key, ContentType: flags["--content-type"], Expires: expires}
+	if str, ok := flags["--max-size"]; ok {
+		size, err := humanize.ParseBytes(str)
+		if err != nil {
+			return fmt.Errorf("invalid size %q", str)
+		}
+		policy.MaxSize = int64(size)
+	}
+
+	isDir, err := isDir(s, p.Bucket, p.Key)
+	if err != nil {
+		return err
+	}
+	if isDir || strings.HasSuffix(arg, "/") {
+		// uploads below a directory keep the name of the uploaded file
+		policy.Key = p.Dir()
+		policy.KeyPrefix = true
+	}
+	// uploads by others would bypass the client and store plaintext, also in encrypted prefixes below a shared directory
+	if isClientEncrypted(s, p.Bucket, p.Key) || (policy.KeyPrefix && containsClientEncrypted(s, p.Bucket, policy.Key)) {
+		return fmt.Errorf("%q is encrypted on client side and can not be shared for uploads", arg)
+	}
+
+	_, post := flags["--post"]
+	if !post && !policy.KeyPrefix && len(policy.ContentType) == 0 && policy.MaxSize == 0 {
+		u, err := s.Store.PresignPut(p.Bucket, p.Key, expires)
+		if err != nil {
+			return err
+		}
+		printlnf("Upload URL for %q valid until %s:", p.Key, formatExpiry(expires))
+		printlnf("%s", u)
+		printlnf("")
+		printlnf("Example: curl -T {file} '%s'", u)
+		return nil
+	}
+
+	// PUT URLs can not enforce size or content type, so a POST policy is required
+	u, formData, err := s.Store.PresignPost(policy)
+	if err != nil {
+		return err
+	}
+
+	fields := make([]string, 0, len(formData))
+	for k := range formData {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+
+	if policy.KeyPrefix {
+		printlnf("Upload form for all files below %q valid until %s:", policy.Key, formatExpiry(expires))
+	} else {
+		printlnf("Upload form for %q valid until %s:", policy.Key, formatExpiry(expires))
+	}
+	if len(policy.ContentType) > 0 {
+		printlnf("  Content type:  %s", policy.ContentType)
+	}
+	if policy.MaxSize > 0 {
+		printlnf("  Max size:      %s", humanize.IBytes(uint64(policy.MaxSize)))
+	}
+	printlnf("  URL:           %s", u)
+	printlnf("  Form fields:")
+	var example strings.Builder
+	for _, k := range fields {
+		printlnf("    %s = %s", k, formData[k])
+		example.WriteString(fmt.Sprintf("-F '%s=%s' ", k, formData[k]))
+	}
+	printlnf("")
+	// the file must be the last form field
+	printlnf("Example: curl %s-F 'file=@{file}' '%s'", example.String(), u)
+	return nil
+}
+
+// parseExpiry parses the validity of presigned URLs.
+func parseExpiry(str string) (time.Duration, error) {
+	d, err := parseDuration(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid expiry %q. Please use a duration like \"30m\", \"12h\" or \"7d\"", str)
+	}
+
+	if d < time.Second {
+		return 0, fmt.Errorf("expiry must be at least one second")
+	}
+	if d > maxShareExpiry {
+		return 0, fmt.Errorf("presigned URLs can not be valid for more than 7 days")
+	}
+	return d, nil
+}
+
+// parseDuration parses a duration like "90m" or "12h" with additional support for days like "7d".
+func parseDuration(str string) (time.Duration, error) {
+	if strings.HasSuffix(str, "d") {
+		days, err := strconv.Atoi(str[:len(str)-1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", str)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(str)
+}
+
+func formatExpiry(expires time.Duration) string {
+	return time.Now().Add(expires).Local().Format(time.RFC1123)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/encrypt"
+)
+
+// objectStat contains all details of a single object as printed by "stat".
+type objectStat struct {
+	Bucket       string    `json:"bucket"`
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+	ETag         string    `json:"etag"`
+	ContentType  string    `json:"contentType"`
+	StorageClass string    `json:"storageClass"`
+	VersionID    string    `json:"versionId,omitempty"`
+	Encryption   string    `json:"encryption,omitempty"`
+	KMSKeyID     string    `json:"kmsKeyId,omitempty"`
+	// CustomerKeyMD5 identifies the customer-provided key of SSE-C objects.
+	CustomerKeyMD5 string `json:"customerKeyMd5,omitempty"`
+	// ClientEncryption is the cipher of objects encrypted on client side.
+	ClientEncryption string            `json:"clientEncryption,omitempty"`
+	Headers          map[string]string `json:"headers,omitempty"`
+	Metadata         map[string]string `json:"metadata"`
+	Tags             map[string]string `json:"tags"`
+}
+
+// dirStat summarizes all objects of a directory or glob.
+type dirStat struct {
+	Bucket       string    `json:"bucket"`
+	Prefix       string    `json:"prefix"`
+	Objects      int       `json:"objects"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+var (
+	// statHeaders are the standard HTTP headers of an object that are shown besides the user metadata.
+	statHeaders = []string{"Cache-Control", "Content-Disposition", "Content-Encoding", "Content-Language", "Expires"}
+)
+
+func statPath(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"--json"}, Value: encryptionFlags})
+	if err != nil {
+		return err
+	}
+	sse, err := getEncryption(s, flags)
+	if err != nil {
+		return err
+	}
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"object name"}, MinArgs: 1, RequireBucket: false}); err != nil {
+		return err
+	}
+	_, asJSON := flags["--json"]
+
+	p, err := resolvePath(s, args[0])
+	if err != nil {
+		return err
+	}
+
+	isFile, isDir, _, err := stat(s, p.Bucket, p.Key)
+	if err != nil {
+		return err
+	}
+
+	if isFile {
+		info, err := statObject(s, p.Bucket, p.Key, sse)
+		if err != nil {
+			return err
+		}
+		if asJSON {
+			return printJSON(info)
+		}
+		printObjectStat(info)
+		return nil
+
+	} else if isDir || hasGlob(p.Key) {
+		prefix, list, err := listSelected(s, p)
+		if err != nil {
+			return err
+		}
+
+		info := dirStat{Bucket: p.Bucket, Prefix: prefix}
+		if hasGlob(p.Key) {
+			info.Prefix = p.Key
+		}
+		for _, obj := range list {
+			if strings.HasSuffix(obj.Key, "/") {
+				// directory markers do not contribute to the summary
+				continue
+			}
+			info.Objects++
+			info.Size += obj.Size
+			if obj.LastModified.After(info.LastModified) {
+				info.LastModified = obj.LastModified
+			}
+		}
+
+		if asJSON {
+			return printJSON(info)
+		}
+		printlnf("  Bucket:         %s", info.Bucket)
+		printlnf("  Prefix:         %s", info.Prefix)
+		printlnf("  Objects:        %d", info.Objects)
+		printlnf("  Total size:     %s (%d bytes)", humanize.IBytes(uint64(info.Size)), info.Size)
+		if info.Objects > 0 {
+			printlnf("  Last modified:  %s", info.LastModified.Local().Format(time.RFC1123))
+		}
+		return nil
+
+	} else {
+		return fmt.Errorf("Object %q does not exist", args[0])
+	}
+}
+
+// statObject collects all details of an object using a HEAD request. SSE-C encrypted objects require the customer key in sse.
+func statObject(s *Session, bucket, key string, sse encrypt.ServerSide) (objectStat, error) {
+	obj, err := s.Store.StatObject(bucket, key, minio.StatObjectOptions{GetObjectOptions: minio.GetObjectOptions{ServerSideEncryption: sse}})
+	if err != nil {
+		return objectStat{}, err
+	}
+
+	info := objectStat{
+		Bucket:         bucket,
+		Key:            key,
+		Size:           obj.Size,
+		LastModified:   obj.LastModified,
+		ETag:           obj.ETag,
+		ContentType:    obj.ContentType,
+		StorageClass:   obj.StorageClass,
+		VersionID:      obj.Metadata.Get("X-Amz-Version-Id"),
+		KMSKeyID:       obj.Metadata.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"),
+		CustomerKeyMD5: obj.Metadata.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5"),
+		Headers:        make(map[string]string),
+		Metadata:       userMetadata(obj.Metadata),
+	}
+	if len(info.StorageClass) == 0 {
+		// S3 omits the storage class header for the default class
+		if info.StorageClass = obj.Metadata.Get("X-Amz-Storage-Class"); len(info.StorageClass) == 0 {
+			info.StorageClass = "STANDARD"
+		}
+	}
+	info.Encryption = encryptionName(obj.Metadata)
+	if cipher := obj.Metadata.Get(metaClientCipher); len(cipher) > 0 {
+		info.ClientEncryption = fmt.Sprintf("%s (%s)", cipher, obj.Metadata.Get(metaClientKDF))
+	}
+	for _, h := range statHeaders {
+		if v := obj.Metadata.Get(h); len(v) > 0 {
+			info.Headers[h] = v
+		}
+	}
+
+	// tagging is not supported by all S3 implementations and must not prevent the other details from being shown
+	if tags, err := s.Store.GetObjectTags(bucket, key); err == nil {
+		info.Tags = tags
+	}
+	return info, nil
+}
+
+// userMetadata returns all "X-Amz-Meta-*" headers without prefix.
+func userMetadata(header http.Header) map[string]string {
+	metadata := make(map[string]string)
+	for k, v := range header {
+		if strings.HasPrefix(k, "X-Amz-Meta-") && len(v) > 0 {
+			metadata[strings.ToLower(k[len("X-Amz-Meta-"):])] = v[0]
+		}
+	}
+	return metadata
+}
+
+// encryptionName returns the server-side encryption type reported by the object headers.
+func encryptionName(header http.Header) string {
+	if len(header.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm")) > 0 {
+		return "SSE-C"
+	}
+	switch header.Get("X-Amz-Server-Side-Encryption") {
+	case "AES256":
+		return "SSE-S3"
+	case "aws:kms":
+		return "SSE-KMS"
+	}
+	return ""
+}
+
+func printObjectStat(info objectStat) {
+	printlnf("  Bucket:         %s", info.Bucket)
+	printlnf("  Key:            %s", info.Key)
+	printlnf("  Size:           %s (%d bytes)", humanize.IBytes(uint64(info.Size)), info.Size)
+	printlnf("  Last modified:  %s", info.LastModified.Local().Format(time.RFC1123))
+	printlnf("  ETag:           %s", info.ETag)
+	printlnf("  Content type:   %s", info.ContentType)
+	printlnf("  Storage class:  %s", info.StorageClass)
+	printlnf("  Version ID:     %s", orNone(info.VersionID))
+	if len(info.KMSKeyID) > 0 {
+		printlnf("  Encryption:     %s (key %s)", info.Encryption, info.KMSKeyID)
+	} else if len(info.CustomerKeyMD5) > 0 {
+		printlnf("  Encryption:     %s (key MD5 %s)", info.Encryption, info.CustomerKeyMD5)
+	} else {
+		printlnf("  Encryption:     %s", orNone(info.Encryption))
+	}
+	if len(info.ClientEncryption) > 0 {
+		printlnf("  Client-side:    %s", info.ClientEncryption)
+	}
+	for _, h := range statHeaders {
+		if v, ok := info.Headers[h]; ok {
+			printlnf("  %-15s %s", h+":", v)
+		}
+	}
+	printMap("Metadata", info.Metadata)
+	if info.Tags == nil {
+		printlnf("  Tags:           unavailable")
+	} else {
+		printMap("Tags", info.Tags)
+	}
+}
+
+// printMap prints all entries of m sorted by key below the given label.
+func printMap(label string, m map[string]string) {
+	if len(m) == 0 {
+		printlnf("  %-15s none", label+":")
+		return
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	printlnf("  %s:", label)
+	for _, k := range keys {
+		printlnf("    %s = %s", k, m[k])
+	}
+}
+
+func orNone(str string) string {
+	if len(str) == 0 {
+		return "none"
+	}
+	return str
+}
+
+// printJSON prints v as indented JSON for further processing by scripts.
+func printJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	printlnf("%s", string(data))
+	return nil
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"crypto/md5"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/credentials"
+	"github.com/minio/minio-go/pkg/encrypt"
+)
+
+// ObjectStore abstracts all bucket and object operations required by the client commands.
+type ObjectStore interface {
+	ListBuckets() ([]minio.BucketInfo, error)
+	BucketExists(bucket string) (bool, error)
+	MakeBucket(bucket string) error
+	RemoveBucket(bucket string) error
+
+	// ListObjects returns all objects with the given prefix. Non-recursive listings return common prefixes as objects with trailing "/".
+	ListObjects(bucket, prefix string, recursive bool, doneCh <-chan struct{}) <-chan minio.ObjectInfo
+	// StatObject returns all information of a single object including its metadata headers.
+	StatObject(bucket, key string, opts minio.StatObjectOptions) (minio.ObjectInfo, error)
+	GetObjectTags(bucket, key string) (map[string]string, error)
+	SetObjectTags(bucket, key string, tags map[string]string) error
+	RemoveObjectTags(bucket, key string) error
+	GetObject(bucket, key string, opts minio.GetObjectOptions) (io.ReadCloser, error)
+	PutObject(bucket, key string, r io.Reader, size int64, opts minio.PutObjectOptions) (int64, error)
+	// CopyObject copies an object on server side.
+	CopyObject(srcBucket, srcKey, dstBucket, dstKey string, opts copyOptions) error
+	RemoveObject(bucket, key string) error
+
+	// GetBucketVersioning returns "Enabled", "Suspended" or an empty string if versioning has never been enabled.
+	GetBucketVersioning(bucket string) (string, error)
+	SetBucketVersioning(bucket, status string) error
+	// ListObjectVersions returns all versions and delete markers with the given prefix sorted by key and newest first. Non-recursive listings return common prefixes with trailing "/".
+	ListObjectVersions(bucket, prefix string, recursive bool) ([]objectVersion, error)
+	// GetObjectVersion returns the content of a single version together with its size and headers.
+	GetObjectVersion(bucket, key, versionID string, opts minio.GetObjectOptions) (io.ReadCloser, minio.ObjectInfo, error)
+	// RemoveObjectVersion permanently deletes a single version or delete marker.
+	RemoveObjectVersion(bucket, key, versionID string) error
+
+	// NewMultipartUpload starts an upload of separate parts and returns its ID. The options apply to the completed object.
+	NewMultipartUpload(bucket, key string, opts minio.PutObjectOptions) (string, error)
+	// PutObjectPart uploads a single part. SSE-C encrypted uploads require the customer key for every part.
+	PutObjectPart(bucket, key, uploadID string, partNumber int, r io.Reader, size int64, sse encrypt.ServerSide) (minio.ObjectPart, error)
+	// ListObjectParts returns all parts of an incomplete upload sorted by part number.
+	ListObjectParts(bucket, key, uploadID string) ([]minio.ObjectPart, error)
+	CompleteMultipartUpload(bucket, key, uploadID string, parts []minio.CompletePart) error
+	AbortMultipartUpload(bucket, key, uploadID string) error
+	// ListMultipartUploads returns all incomplete uploads with the given prefix sorted by key.
+	ListMultipartUploads(bucket, prefix string) ([]minio.ObjectMultipartInfo, error)
+
+	// PresignGet returns a URL to download an object without credentials until it expires.
+	PresignGet(bucket, key string, expires time.Duration) (string, error)
+	PresignPut(bucket, key string, expires time.Duration) (string, error)
+	// PresignPost returns the URL and form fields for browser uploads restricted by the given policy.
+	PresignPost(policy uploadPolicy) (string, map[string]string, error)
+
+	// GetBucketPolicy returns the JSON policy of a bucket or an empty string if no policy is set.
+	GetBucketPolicy(bucket string) (string, error)
+	// SetBucketPolicy replaces the JSON policy of a bucket. An empty policy removes it.
+	SetBucketPolicy(bucket, policy string) error
+	// GetBucketLifecycle returns the XML lifecycle configuration of a bucket or an empty string if no rules are set.
+	GetBucketLifecycle(bucket string) (string, error)
+	// SetBucketLifecycle replaces the XML lifecycle configuration of a bucket. An empty configuration removes all rules.
+	SetBucketLifecycle(bucket, lifecycle string) error
+}
+
+// objectVersion is a single entry in the version history of a key.
+type objectVersion struct {
+	Key            string
+	VersionID      string
+	IsLatest       bool
+	IsDeleteMarker bool
+	LastModified   time.Time
+	Size           int64
+	ETag           string
+}
+
+// copyOptions contains the encryption and metadata of a server-side copy.
+type copyOptions struct {
+	// SourceEncryption is required to read SSE-C encrypted sources.
+	SourceEncryption encrypt.ServerSide
+	Encryption       encrypt.ServerSide
+	// Metadata of header names and values replaces all content headers and user metadata of the source object if not nil.
+	Metadata map[string]string
+}
+
+// uploadPolicy contains the conditions of a presigned POST upload.
+type uploadPolicy struct {
+	Bucket string
+	// Key is the object key, or the required key prefix if KeyPrefix is set.
+	Key       string
+	KeyPrefix bool
+	// ContentType is enforced if not empty.
+	ContentType string
+	// MaxSize limits the upload size in bytes if greater than zero.
+	MaxSize int64
+	Expires time.Duration
+}
+
+// minioStore is an ObjectStore backed by a remote S3 endpoint.
+type minioStore struct {
+	target S3Target
+	client *minio.Client
+	// creds returns the current credentials, which are refreshed before they expire for assumed roles.
+	creds *credentials.Credentials
+	sts   *stsProvider
+	// httpClient sends the raw API requests that minio-go does not cover.
+	httpClient *http.Client
+
+	// regions caches the location of all buckets used for raw API requests.
+	regionMutex sync.Mutex
+	regions     map[string]string
+}
+
+func newMinioStore(target S3Target) (*minioStore, error) {
+	creds, sts, err := newCredentials(target)
+	if err != nil {
+		return nil, err
+	}
+	client, err := minio.NewWithCredentials(target.Endpoint, creds, target.Secure, target.Region)
+	if err != nil {
+		return nil, err
+	}
+	if sts != nil {
+		// errors of the role assumption should show up when the environment is opened
+		if _, err := creds.Get(); err != nil {
+			return nil, err
+		}
+	}
+	return &minioStore{target: target, client: client, creds: creds, sts: sts, httpClient: newRawHTTPClient(), regions: make(map[string]string)}, nil
+}
+
+// credentialExpiration returns when the current credentials expire, or false if they do not expire or the expiry is unknown.
+func (s *minioStore) credentialExpiration() (time.Time, bool) {
+	if s.sts != nil {
+		return s.sts.Expiration()
+	}
+	if s.target.SessionExpiration != nil {
+		return *s.target.SessionExpiration, true
+	}
+	return time.Time{}, false
+}
+
+func (s *minioStore) ListBuckets() ([]minio.BucketInfo, error) {
+	return s.client.ListBuckets()
+}
+
+func (s *minioStore) BucketExists(bucket string) (bool, error) {
+	return s.client.BucketExists(bucket)
+}
+
+func (s *minioStore) MakeBucket(bucket string) error {
+	return s.client.MakeBucket(bucket, "")
+}
+
+func (s *minioStore) RemoveBucket(bucket string) error {
+	return s.client.RemoveBucket(bucket)
+}
+
+func (s *minioStore) ListObjects(bucket, prefix string, recursive bool, doneCh <-chan struct{}) <-chan minio.ObjectInfo {
+	return s.client.ListObjectsV2(bucket, prefix, recursive, doneCh)
+}
+
+func (s *minioStore) StatObject(bucket, key string, opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	return s.client.StatObject(bucket, key, opts)
+}
+
+func (s *minioStore) GetObject(bucket, key string, opts minio.GetObjectOptions) (io.ReadCloser, error) {
+	return s.client.GetObject(bucket, key, opts)
+}
+
+func (s *minioStore) PutObject(bucket, key string, r io.Reader, size int64, opts minio.PutObjectOptions) (int64, error) {
+	return s.client.PutObject(bucket, key, r, size, opts)
+}
+
+func (s *minioStore) CopyObject(srcBucket, srcKey, dstBucket, dstKey string, opts copyOptions) error {
+	src := minio.NewSourceInfo(srcBucket, srcKey, opts.SourceEncryption)
+	dst, err := minio.NewDestinationInfo(dstBucket, dstKey, opts.Encryption, opts.Metadata)
+	if err != nil {
+		return err
+	}
+	return s.client.CopyObject(dst, src)
+}
+
+func (s *minioStore) RemoveObject(bucket, key string) error {
+	return s.client.RemoveObject(bucket, key)
+}
+
+func (s *minioStore) NewMultipartUpload(bucket, key string, opts minio.PutObjectOptions) (string, error) {
+	return minio.Core{Client: s.client}.NewMultipartUpload(bucket, key, opts)
+}
+
+func (s *minioStore) PutObjectPart(bucket, key, uploadID string, partNumber int, r io.Reader, size int64, sse encrypt.ServerSide) (minio.ObjectPart, error) {
+	return minio.Core{Client: s.client}.PutObjectPart(bucket, key, uploadID, partNumber, r, size, "", "", sse)
+}
+
+func (s *minioStore) ListObjectParts(bucket, key, uploadID string) ([]minio.ObjectPart, error) {
+	parts := make([]minio.ObjectPart, 0)
+	marker := 0
+	for {
+		result, err := minio.Core{Client: s.client}.ListObjectParts(bucket, key, uploadID, marker, 1000)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, result.ObjectParts...)
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+func (s *minioStore) CompleteMultipartUpload(bucket, key, uploadID string, parts []minio.CompletePart) error {
+	_, err := minio.Core{Client: s.client}.CompleteMultipartUpload(bucket, key, uploadID, parts)
+	return err
+}
+
+func (s *minioStore) AbortMultipartUpload(bucket, key, uploadID string) error {
+	return minio.Core{Client: s.client}.AbortMultipartUpload(bucket, key, uploadID)
+}
+
+func (s *minioStore) ListMultipartUploads(bucket, prefix string) ([]minio.ObjectMultipartInfo, error) {
+	uploads := make([]minio.ObjectMultipartInfo, 0)
+	keyMarker, uploadIDMarker := "", ""
+	for {
+		result, err := minio.Core{Client: s.client}.ListMultipartUploads(bucket, prefix, keyMarker, uploadIDMarker, "", 1000)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, result.Uploads...)
+		if !result.IsTruncated {
+			return uploads, nil
+		}
+		keyMarker, uploadIDMarker = result.NextKeyMarker, result.NextUploadIDMarker
+	}
+}
+
+func (s *minioStore) GetBucketPolicy(bucket string) (string, error) {
+	return s.client.GetBucketPolicy(bucket)
+}
+
+func (s *minioStore) SetBucketPolicy(bucket, policy string) error {
+	return s.client.SetBucketPolicy(bucket, policy)
+}
+
+func (s *minioStore) GetBucketLifecycle(bucket string) (string, error) {
+	return s.client.GetBucketLifecycle(bucket)
+}
+
+func (s *minioStore) SetBucketLifecycle(bucket, lifecycle string) error {
+	return s.client.SetBucketLifecycle(bucket, lifecycle)
+}
+
+func (s *minioStore) PresignGet(bucket, key string, expires time.Duration) (string, error) {
+	u, err := s.client.PresignedGetObject(bucket, key, expires, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (s *minioStore) PresignPut(bucket, key string, expires time.Duration) (string, error) {
+	u, err := s.client.PresignedPutObject(bucket, key, expires)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (s *minioStore) PresignPost(policy uploadPolicy) (string, map[string]string, error) {
+	p := minio.NewPostPolicy()
+	if err := p.SetBucket(policy.Bucket); err != nil {
+		return "", nil, err
+	}
+	if policy.KeyPrefix {
+		if err := p.SetKeyStartsWith(policy.Key); err != nil {
+			return "", nil, err
+		}
+	} else if err := p.SetKey(policy.Key); err != nil {
+		return "", nil, err
+	}
+	if err := p.SetExpires(time.Now().UTC().Add(policy.Expires)); err != nil {
+		return "", nil, err
+	}
+	if len(policy.ContentType) > 0 {
+		if err := p.SetContentType(policy.ContentType); err != nil {
+			return "", nil, err
+		}
+	}
+	if policy.MaxSize > 0 {
+		if err := p.SetContentLengthRange(0, policy.MaxSize); err != nil {
+			return "", nil, err
+		}
+	}
+
+	u, formData, err := s.client.PresignedPostPolicy(p)
+	if err != nil {
+		return "", nil, err
+	}
+	if policy.KeyPrefix {
+		// S3 replaces this variable by the name of the uploaded file
+		formData["key"] = policy.Key + "${filename}"
+	}
+	return u.String(), formData, nil
+}
+
+// putFile uploads a local file and returns the MD5 of the content sent. The content type is detected from the file if not set in opts.
+func putFile(store ObjectStore, bucket, key, filePath string, opts minio.PutObjectOptions) (int64, []byte, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(opts.ContentType) == 0 {
+		if opts.ContentType, err = detectContentType(f); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	hash := md5.New()
+	n, err := store.PutObject(bucket, key, io.TeeReader(f, hash), fi.Size(), opts)
+	if err != nil {
+		return 0, nil, err
+	}
+	return n, hash.Sum(nil), nil
+}
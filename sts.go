@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/pkg/credentials"
+)
+
+const (
+	// stsRefreshWindow is the time before expiry when temporary credentials are requested again, so long transfers never run into expired credentials.
+	stsRefreshWindow = 5 * time.Minute
+	stsTimeout       = 30 * time.Second
+)
+
+// assumeRole configures temporary credentials that are requested from STS when the environment is opened and refreshed before they expire.
+type assumeRole struct {
+	RoleARN     string `json:"roleArn"`
+	SessionName string `json:"sessionName,omitempty"`
+	// Duration is the requested lifetime like "1h". STS chooses the lifetime if empty.
+	Duration   string `json:"duration,omitempty"`
+	ExternalID string `json:"externalId,omitempty"`
+	// WebIdentityTokenFile selects AssumeRoleWithWebIdentity with the OIDC token in this file instead of a request signed with the access key of the environment.
+	WebIdentityTokenFile string `json:"webIdentityTokenFile,omitempty"`
+	// STSEndpoint is the URL of the STS service. It defaults to the global AWS STS endpoint for AWS and to the S3 endpoint for other stores like MinIO.
+	STSEndpoint string `json:"stsEndpoint,omitempty"`
+}
+
+// hasCredentials returns true if the target contains credentials or can request them without.
+func (t S3Target) hasCredentials() bool {
+	return len(t.AccessKey) > 0 || (t.AssumeRole != nil && len(t.AssumeRole.WebIdentityTokenFile) > 0)
+}
+
+// stsEndpointURL returns the configured or default STS endpoint of a target.
+func stsEndpointURL(target S3Target) string {
+	if len(target.AssumeRole.STSEndpoint) > 0 {
+		return strings.TrimSuffix(target.AssumeRole.STSEndpoint, "/")
+	}
+	if target.Endpoint == awsDefaultEndpoint || strings.HasSuffix(target.Endpoint, ".amazonaws.com") {
+		return "https://sts.amazonaws.com"
+	}
+	return endpointURL(target)
+}
+
+// newCredentials returns the credentials used to sign all requests of a target.
+func newCredentials(target S3Target) (*credentials.Credentials, *stsProvider, error) {
+	if target.AssumeRole == nil {
+		return credentials.NewStaticV4(target.AccessKey, target.SecretKey, target.SessionToken), nil, nil
+	}
+
+	if len(target.AssumeRole.RoleARN) == 0 {
+		return nil, nil, fmt.Errorf("assumeRole requires a roleArn")
+	}
+	if len(target.AssumeRole.WebIdentityTokenFile) == 0 && len(target.AccessKey) == 0 {
+		return nil, nil, fmt.Errorf("assumeRole requires an access key or a webIdentityTokenFile")
+	}
+	var duration time.Duration
+	if len(target.AssumeRole.Duration) > 0 {
+		var err error
+		if duration, err = parseDuration(target.AssumeRole.Duration); err != nil || duration < time.Second {
+			return nil, nil, fmt.Errorf("invalid assumeRole duration %q. Please use a duration like \"15m\" or \"12h\"", target.AssumeRole.Duration)
+		}
+	}
+
+	provider := &stsProvider{target: target, duration: duration, client: &http.Client{Timeout: stsTimeout}}
+	return credentials.New(provider), provider, nil
+}
+
+// stsProvider requests temporary credentials from STS for minio-go, which asks for new ones as soon as IsExpired returns true.
+type stsProvider struct {
+	credentials.Expiry
+	target   S3Target
+	duration time.Duration
+	client   *http.Client
+
+	mutex      sync.Mutex
+	expiration time.Time
+}
+
+// Expiration returns when the current credentials expire, or false if none have been requested yet.
+func (p *stsProvider) Expiration() (time.Time, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.expiration, !p.expiration.IsZero()
+}
+
+// Retrieve requests new temporary credentials.
+func (p *stsProvider) Retrieve() (credentials.Value, error) {
+	cfg := p.target.AssumeRole
+	form := url.Values{}
+	form.Set("Version", "2011-06-15")
+	form.Set("RoleArn", cfg.RoleARN)
+	sessionName := cfg.SessionName
+	if len(sessionName) == 0 {
+		sessionName = fmt.Sprintf("s3client-%d", time.Now().Unix())
+	}
+	form.Set("RoleSessionName", sessionName)
+	if p.duration > 0 {
+		form.Set("DurationSeconds", strconv.Itoa(int(p.duration/time.Second)))
+	}
+
+	action := "AssumeRole"
+	if len(cfg.WebIdentityTokenFile) > 0 {
+		// the token file is read on every refresh, because it is usually rotated by the identity provider
+		token, err := ioutil.ReadFile(cfg.WebIdentityTokenFile)
+		if err != nil {
+			return credentials.Value{}, fmt.Errorf("unable to read web identity token: %s", err.Error())
+		}
+		action = "AssumeRoleWithWebIdentity"
+		form.Set("WebIdentityToken", strings.TrimSpace(string(token)))
+	} else if len(cfg.ExternalID) > 0 {
+		form.Set("ExternalId", cfg.ExternalID)
+	}
+	form.Set("Action", action)
+
+	endpoint := stsEndpointURL(p.target)
+	req, err := http.NewRequest(http.MethodPost, endpoint+"/", strings.NewReader(form.Encode()))
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	if action == "AssumeRole" {
+		region := p.target.Region
+		if len(region) == 0 {
+			region = "us-east-1"
+		}
+		signSTSRequest(req, []byte(form.Encode()), p.target.AccessKey, p.target.SecretKey, p.target.SessionToken, region, time.Now().UTC())
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("%s at %s failed: %s", action, endpoint, err.Error())
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp stsErrorResponse
+		if err := xml.Unmarshal(data, &errResp); err != nil || len(errResp.Error.Code) == 0 {
+			return credentials.Value{}, fmt.Errorf("%s at %s failed with status %s", action, endpoint, resp.Status)
+		}
+		return credentials.Value{}, fmt.Errorf("%s at %s failed: %s: %s", action, endpoint, errResp.Error.Code, errResp.Error.Message)
+	}
+
+	var result stsResponse
+	if err := xml.Unmarshal(data, &result); err != nil {
+		return credentials.Value{}, fmt.Errorf("malformed %s response: %s", action, err.Error())
+	}
+	creds := result.AssumeRoleResult.Credentials
+	if action != "AssumeRole" {
+		creds = result.AssumeRoleWithWebIdentityResult.Credentials
+	}
+	if len(creds.AccessKeyID) == 0 || creds.Expiration.IsZero() {
+		return credentials.Value{}, fmt.Errorf("%s at %s returned no credentials", action, endpoint)
+	}
+
+	// short-lived credentials are refreshed after three quarters of their lifetime
+	window := stsRefreshWindow
+	if lifetime := time.Until(creds.Expiration); lifetime < 4*window {
+		window = lifetime / 4
+	}
+	p.SetExpiration(creds.Expiration, window)
+	p.mutex.Lock()
+	p.expiration = creds.Expiration
+	p.mutex.Unlock()
+
+	return credentials.Value{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
+
+// stsResponse covers the responses of AssumeRole and AssumeRoleWithWebIdentity.
+type stsResponse struct {
+	AssumeRoleResult                struct{ Credentials stsCredentials } `xml:"AssumeRoleResult"`
+	AssumeRoleWithWebIdentityResult struct{ Credentials stsCredentials } `xml:"AssumeRoleWithWebIdentityResult"`
+}
+
+type stsCredentials struct {
+	AccessKeyID     string    `xml:"AccessKeyId"`
+	SecretAccessKey string    `xml:"SecretAccessKey"`
+	SessionToken    string    `xml:"SessionToken"`
+	Expiration      time.Time `xml:"Expiration"`
+}
+
+type stsErrorResponse struct {
+	Error struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Error"`
+}
+
+// signSTSRequest adds a signature version 4 for the STS service to a request with the given body. The signer of minio-go only supports S3.
+func signSTSRequest(req *http.Request, body []byte, accessKey, secretKey, sessionToken, region string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if len(sessionToken) > 0 {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	signedHeaders := []string{"content-type", "host", "x-amz-date"}
+	canonicalHeaders := "content-type:" + req.Header.Get("Content-Type") + "\nhost:" + req.URL.Host + "\nx-amz-date:" + amzDate + "\n"
+	if len(sessionToken) > 0 {
+		signedHeaders = append(signedHeaders, "x-amz-security-token")
+		canonicalHeaders += "x-amz-security-token:" + sessionToken + "\n"
+	}
+	canonicalURI := req.URL.EscapedPath()
+	if len(canonicalURI) == 0 {
+		canonicalURI = "/"
+	}
+	canonicalRequest := strings.Join([]string{req.Method, canonicalURI, req.URL.RawQuery, canonicalHeaders, strings.Join(signedHeaders, ";"), hexSHA256(body)}, "\n")
+
+	scope := now.Format("20060102") + "/" + region + "/sts/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{now.Format("20060102"), region, "sts", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// formatLifetime describes the remaining lifetime of temporary credentials.
+func formatLifetime(expiration time.Time) string {
+	remaining := time.Until(expiration).Round(time.Second)
+	if remaining <= 0 {
+		return fmt.Sprintf("expired at %s", expiration.Local().Format(time.RFC1123))
+	}
+	return fmt.Sprintf("expire in %s (%s)", remaining, expiration.Local().Format(time.RFC1123))
+}
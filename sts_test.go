@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignSTSRequest(t *testing.T) {
+	// reference signature computed independently with the algorithm of the AWS signature version 4 documentation
+	body := "Action=AssumeRole&Version=2011-06-15"
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:9000/", strings.NewReader(body))
+	must(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signSTSRequest(req, []byte(body), "AK", "SK", "TOK", "eu-west-1", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AK/20200101/eu-west-1/sts/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-amz-security-token, Signature=6617fb94916c3ffa27b8a1b06b4e788d68f181352b45868eeee19c87fd97459c"
+	if auth := req.Header.Get("Authorization"); auth != expected {
+		t.Errorf("got Authorization %q, expected %q", auth, expected)
+	}
+	if req.Header.Get("X-Amz-Date") != "20200101T000000Z" || req.Header.Get("X-Amz-Security-Token") != "TOK" {
+		t.Errorf("missing signed headers: %v", req.Header)
+	}
+}
+
+// stsStandIn answers AssumeRole and AssumeRoleWithWebIdentity like STS and checks the requests.
+type stsStandIn struct {
+	t         *testing.T
+	secretKey string
+	lifetime  time.Duration
+	// errCode lets all requests fail with this STS error code
+	errCode string
+
+	mutex sync.Mutex
+	forms []url.Values
+}
+
+func (st *stsStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	form, err := url.ParseQuery(string(body))
+	if err != nil || r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	st.mutex.Lock()
+	st.forms = append(st.forms, form)
+	st.mutex.Unlock()
+
+	if len(st.errCode) > 0 {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, `<ErrorResponse><Error><Type>Sender</Type><Code>%s</Code><Message>role can not be assumed</Message></Error></ErrorResponse>`, st.errCode)
+		return
+	}
+
+	action := form.Get("Action")
+	switch action {
+	case "AssumeRole":
+		// verify the signature like STS by signing the same request again
+		date, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+		if err != nil {
+			st.t.Errorf("AssumeRole without X-Amz-Date")
+		}
+		check, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.Path, bytes.NewReader(body))
+		check.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+		credential := strings.TrimPrefix(strings.Split(r.Header.Get("Authorization"), ",")[0], "AWS4-HMAC-SHA256 Credential=")
+		parts := strings.Split(credential, "/")
+		if len(parts) != 5 || parts[3] != "sts" {
+			st.t.Errorf("invalid credential scope %q", credential)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		signSTSRequest(check, body, parts[0], st.secretKey, r.Header.Get("X-Amz-Security-Token"), parts[2], date)
+		if check.Header.Get("Authorization") != r.Header.Get("Authorization") {
+			st.t.Errorf("signature mismatch: got %q, expected %q", r.Header.Get("Authorization"), check.Header.Get("Authorization"))
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+	case "AssumeRoleWithWebIdentity":
+		if len(r.Header.Get("Authorization")) > 0 {
+			st.t.Errorf("AssumeRoleWithWebIdentity must not be signed")
+		}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	expiration := time.Now().Add(st.lifetime).UTC().Format(time.RFC3339Nano)
+	fmt.Fprintf(w, `<%[1]sResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><%[1]sResult><Credentials><AccessKeyId>TMP%[2]d</AccessKeyId><SecretAccessKey>TMPSECRET</SecretAccessKey><SessionToken>TOKEN%[2]d</SessionToken><Expiration>%[3]s</Expiration></Credentials></%[1]sResult></%[1]sResponse>`, action, len(st.forms), expiration)
+}
+
+func (st *stsStandIn) requests() []url.Values {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	return append([]url.Values{}, st.forms...)
+}
+
+func TestSTSProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3client-test")
+	must(t, err)
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	must(t, ioutil.WriteFile(tokenFile, []byte("oidc-token\n"), 0600))
+
+	tests := []struct {
+		name string
+		role assumeRole
+		// form contains the expected request fields
+		form map[string]string
+	}{
+		{"assume role", assumeRole{RoleARN: "arn:aws:iam::1:role/a", SessionName: "test", Duration: "15m", ExternalID: "ext"},
+			map[string]string{"Action": "AssumeRole", "Version": "2011-06-15", "RoleArn": "arn:aws:iam::1:role/a", "RoleSessionName": "test", "DurationSeconds": "900", "ExternalId": "ext"}},
+		{"web identity", assumeRole{RoleARN: "arn:aws:iam::1:role/w", WebIdentityTokenFile: tokenFile},
+			map[string]string{"Action": "AssumeRoleWithWebIdentity", "Version": "2011-06-15", "RoleArn": "arn:aws:iam::1:role/w", "WebIdentityToken": "oidc-token"}},
+	}
+	for _, test := range tests {
+		st := &stsStandIn{t: t, secretKey: "SK", lifetime: time.Hour}
+		srv := httptest.NewServer(st)
+		role := test.role
+		role.STSEndpoint = srv.URL
+		target := S3Target{Endpoint: "s3.example.com", AccessKey: "AK", SecretKey: "SK", SessionToken: "BASETOKEN", Region: "eu-west-1", AssumeRole: &role}
+
+		creds, provider, err := newCredentials(target)
+		must(t, err)
+		value, err := creds.Get()
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err.Error())
+			srv.Close()
+			continue
+		}
+		if value.AccessKeyID != "TMP1" || value.SecretAccessKey != "TMPSECRET" || value.SessionToken != "TOKEN1" {
+			t.Errorf("%s: got credentials %+v", test.name, value)
+		}
+		if expiration, ok := provider.Expiration(); !ok || time.Until(expiration) < 59*time.Minute {
+			t.Errorf("%s: unexpected expiration %v", test.name, expiration)
+		}
+
+		forms := st.requests()
+		if len(forms) != 1 {
+			t.Fatalf("%s: expected one request, got %d", test.name, len(forms))
+		}
+		for key, value := range test.form {
+			if forms[0].Get(key) != value {
+				t.Errorf("%s: form field %s is %q, expected %q", test.name, key, forms[0].Get(key), value)
+			}
+		}
+		if _, ok := test.form["RoleSessionName"]; !ok && !strings.HasPrefix(forms[0].Get("RoleSessionName"), "s3client-") {
+			t.Errorf("%s: unexpected default session name %q", test.name, forms[0].Get("RoleSessionName"))
+		}
+
+		// valid credentials are not requested again
+		_, err = creds.Get()
+		must(t, err)
+		if len(st.requests()) != 1 {
+			t.Errorf("%s: credentials requested again before expiry", test.name)
+		}
+		srv.Close()
+	}
+}
+
+func TestSTSProviderRefresh(t *testing.T) {
+	st := &stsStandIn{t: t, secretKey: "SK", lifetime: 2 * time.Second}
+	srv := httptest.NewServer(st)
+	defer srv.Close()
+
+	target := S3Target{Endpoint: "s3.example.com", AccessKey: "AK", SecretKey: "SK", AssumeRole: &assumeRole{RoleARN: "arn", STSEndpoint: srv.URL}}
+	creds, _, err := newCredentials(target)
+	must(t, err)
+	first, err := creds.Get()
+	must(t, err)
+
+	// short lifetimes are refreshed after three quarters
+	time.Sleep(1600 * time.Millisecond)
+	second, err := creds.Get()
+	must(t, err)
+	if first.SessionToken == second.SessionToken || len(st.requests()) != 2 {
+		t.Errorf("credentials not refreshed before expiry: %q and %q after %d requests", first.SessionToken, second.SessionToken, len(st.requests()))
+	}
+}
+
+func TestSTSProviderErrors(t *testing.T) {
+	st := &stsStandIn{t: t, secretKey: "SK", lifetime: time.Hour, errCode: "AccessDenied"}
+	srv := httptest.NewServer(st)
+	defer srv.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	tests := []struct {
+		name   string
+		target S3Target
+		err    string
+	}{
+		{"sts error", S3Target{AccessKey: "AK", SecretKey: "SK", AssumeRole: &assumeRole{RoleARN: "arn", STSEndpoint: srv.URL}}, "AccessDenied: role can not be assumed"},
+		{"missing token file", S3Target{AssumeRole: &assumeRole{RoleARN: "arn", STSEndpoint: srv.URL, WebIdentityTokenFile: "/does/not/exist"}}, "unable to read web identity token"},
+		{"status only", S3Target{AccessKey: "AK", SecretKey: "SK", AssumeRole: &assumeRole{RoleARN: "arn", STSEndpoint: failing.URL}}, "failed with status 500"},
+	}
+	for _, test := range tests {
+		creds, _, err := newCredentials(test.target)
+		must(t, err)
+		_, err = creds.Get()
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, expected %q", test.name, err, test.err)
+		}
+	}
+
+	configTests := []struct {
+		role assumeRole
+		err  string
+	}{
+		{assumeRole{}, "requires a roleArn"},
+		{assumeRole{RoleARN: "arn", Duration: "1h"}, "requires an access key"},
+		{assumeRole{RoleARN: "arn", WebIdentityTokenFile: "token", Duration: "soon"}, "invalid assumeRole duration"},
+	}
+	for _, test := range configTests {
+		role := test.role
+		_, _, err := newCredentials(S3Target{AssumeRole: &role})
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%+v: got error %v, expected %q", test.role, err, test.err)
+		}
+	}
+}
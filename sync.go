@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/minio/minio-go"
+	"github.com/sbreitf1/errors"
+	"github.com/sbreitf1/fs"
+	"github.com/sbreitf1/fs/path"
+)
+
+// syncEntry describes a single file on either side of a sync operation.
+type syncEntry struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	ETag    string
+}
+
+type syncAction int
+
+const (
+	syncSkip syncAction = iota
+	syncCreate
+	syncUpdate
+	syncDelete
+)
+
+func syncDirs(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"--delete", "--checksum", "--up", "--down", "-n"}, Value: append([]string{"-j", "--checksum-algorithm"}, encryptionFlags...)})
+	if err != nil {
+		return err
+	}
+
+	// the direction is derived from the side given as "bucket:/" or "s3://" path if not specified explicitly
+	_, up := flags["--up"]
+	_, down := flags["--down"]
+	if up && down {
+		return fmt.Errorf("--up and --down can not be used together")
+	}
+	if !up && !down && len(args) == 2 {
+		srcRemote, dstRemote := isBucketPath(args[0]), isBucketPath(args[1])
+		if srcRemote == dstRemote {
+			return fmt.Errorf("Unable to tell the remote side of %q and %q. Please use a \"bucket:/\" or \"s3://\" path for the remote directory or choose the direction with \"--up\" or \"--down\"", args[0], args[1])
+		}
+		up = dstRemote
+	}
+
+	dryRun := isDryRun(s, flags)
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"source", "destination"}, MinArgs: 2, RequireBucket: false}); err != nil {
+		return err
+	}
+
+	workers, err := getWorkers(s, flags)
+	if err != nil {
+		return err
+	}
+	_, withDelete := flags["--delete"]
+	_, withChecksum := flags["--checksum"]
+
+	localDir, remoteArg := args[0], args[1]
+	if !up {
+		remoteArg, localDir = args[0], args[1]
+	}
+	// all remote operations use the environment of an "env:bucket:/key" path
+	s, remote, err := resolveSessionPath(s, remoteArg)
+	if err != nil {
+		return err
+	}
+	if up && !dryRun && s.Target.ReadOnly {
+		return errReadOnly(s)
+	}
+	sse, err := getEncryption(s, flags)
+	if err != nil {
+		return err
+	}
+	checksums, err := getChecksumAlgorithms(s, flags)
+	if err != nil {
+		return err
+	}
+	if !up {
+		if isFile, err := isFile(s, remote.Bucket, remote.Key); err != nil {
+			return err
+		} else if isFile {
+			return fmt.Errorf("%q is a file. Use \"dl\" to download single objects", args[0])
+		}
+	}
+	bucket, prefix := remote.Bucket, remote.Dir()
+
+	localFiles, err := listLocalTree(localDir)
+	if err != nil {
+		return err
+	}
+	remoteFiles, err := listRemoteTree(s, bucket, prefix)
+	if err != nil {
+		return err
+	}
+
+	// local files are compared with the size of their encrypted counterpart, checksums of encrypted objects never match
+	encrypted := make(map[string]bool)
+	for p, entry := range localFiles {
+		if isClientEncrypted(s, bucket, prefix+p) {
+			encrypted[p] = true
+			entry.Size = encryptedSize(entry.Size)
+			localFiles[p] = entry
+		}
+	}
+
+	src, dst := localFiles, remoteFiles
+	if !up {
+		src, dst = remoteFiles, localFiles
+	}
+
+	paths := make([]string, 0, len(src))
+	actions := make(map[string]syncAction)
+	for p, srcEntry := range src {
+		paths = append(paths, p)
+		if dstEntry, ok := dst[p]; !ok {
+			actions[p] = syncCreate
+		} else if syncDiffers(localDir, p, srcEntry, dstEntry, up, withChecksum && !encrypted[p]) {
+			actions[p] = syncUpdate
+		} else {
+			actions[p] = syncSkip
+		}
+	}
+	if withDelete {
+		for p := range dst {
+			if _, ok := src[p]; !ok {
+				paths = append(paths, p)
+				actions[p] = syncDelete
+			}
+		}
+	}
+	sort.Strings(paths)
+
+	var totalSize int64
+	tasks := make([]task, 0)
+	counts := make(map[syncAction]int)
+	for _, p := range paths {
+		p, action := p, actions[p]
+		counts[action]++
+		if action == syncSkip {
+			continue
+		}
+		if action != syncDelete {
+			totalSize += src[p].Size
+		}
+
+		tasks = append(tasks, task{Label: p, Run: func(log func(string, ...interface{})) error {
+			localPath := path.Join(localDir, p)
+			key := prefix + p
+
+			if dryRun {
+				target := key
+				if !up {
+					target = localPath
+				}
+				switch action {
+				case syncDelete:
+					printDryRun(log, "delete", target)
+				case syncUpdate:
+					printDryRun(log, "overwrite", target)
+				default:
+					printDryRun(log, "create", target)
+				}
+				return nil
+			}
+
+			switch action {
+			case syncDelete:
+				if up {
+					log("  delete %s", key)
+					return s.Store.RemoveObject(bucket, key)
+				}
+				log("  delete %s", localPath)
+				return os.Remove(localPath)
+
+			default:
+				if up {
+					log("  upload %s to %s", p, key)
+					_, err := uploadObject(s, localPath, bucket, key, uploadOptions{PutObjectOptions: minio.PutObjectOptions{ServerSideEncryption: sse}, Checksums: checksums}, nil)
+					return err
+				}
+
+				log("  download %s to %s", key, localPath)
+				if err := os.MkdirAll(path.Dir(localPath), os.ModePerm); err != nil {
+					return err
+				}
+				if _, err := downloadObject(s, bucket, key, localPath, minio.GetObjectOptions{ServerSideEncryption: sse}, nil, false); err != nil {
+					return err
+				}
+				// take over the remote modification time to detect changes in later runs
+				return os.Chtimes(localPath, src[p].ModTime, src[p].ModTime)
+			}
+		}})
+	}
+
+	if len(tasks) > 0 {
+		if err := runTasks(workers, tasks, nil); err != nil {
+			return err
+		}
+	}
+
+	if dryRun {
+		printlnf("Dry-run completed: %d to create, %d to update, %d to delete, %d unchanged (%s to transfer)",
+			counts[syncCreate], counts[syncUpdate], counts[syncDelete], counts[syncSkip], humanize.IBytes(uint64(totalSize)))
+		return nil
+	}
+
+	printlnf("Sync completed: %d created, %d updated, %d deleted, %d unchanged (%s transferred)",
+		counts[syncCreate], counts[syncUpdate], counts[syncDelete], counts[syncSkip], humanize.IBytes(uint64(totalSize)))
+	return nil
+}
+
+// syncDiffers returns true when the source file needs to be transferred to the destination.
+func syncDiffers(localDir, p string, src, dst syncEntry, up, withChecksum bool) bool {
+	if src.Size != dst.Size {
+		return true
+	}
+
+	if withChecksum {
+		remote := dst
+		if !up {
+			remote = src
+		}
+		// multipart ETags of unknown part size can not be compared -> fall back to modification times
+		if matches, ok := fileMatchesETag(path.Join(localDir, p), remote.ETag, remote.Size); ok {
+			return !matches
+		}
+	}
+
+	return src.ModTime.After(dst.ModTime)
+}
+
+// listLocalTree returns all files below dir indexed by their relative slash-separated path. A missing directory is treated as empty.
+func listLocalTree(dir string) (map[string]syncEntry, error) {
+	files := make(map[string]syncEntry)
+	if isDir, err := fs.IsDir(dir); err != nil || !isDir {
+		return files, nil
+	}
+
+	localPrefix, _ := path.Abs(dir)
+	if !strings.HasSuffix(localPrefix, "/") {
+		localPrefix += "/"
+	}
+
+	if err := fs.Walk(dir, func(parent string, f fs.FileInfo, isRoot bool) errors.Error {
+		if f.IsDir() {
+			return nil
+		}
+
+		localPath, _ := path.Abs(path.Join(parent, f.Name()))
+		fi, err := os.Stat(localPath)
+		if err != nil {
+			return errors.Wrap(err)
+		}
+
+		p := localPath[len(localPrefix):]
+		files[p] = syncEntry{Path: p, Size: fi.Size(), ModTime: fi.ModTime()}
+		return nil
+	}, nil, nil, nil); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// listRemoteTree returns all objects with the given prefix indexed by the key relative to prefix.
+func listRemoteTree(s *Session, bucket, prefix string) (map[string]syncEntry, error) {
+	list, err := listRecursive(s, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]syncEntry)
+	for _, obj := range list {
+		if strings.HasSuffix(obj.Key, "/") {
+			// skip directory markers
+			continue
+		}
+		p := obj.Key[len(prefix):]
+		files[p] = syncEntry{Path: p, Size: obj.Size, ModTime: obj.LastModified, ETag: obj.ETag}
+	}
+	return files, nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxTags is the maximum number of tags S3 allows per object.
+	maxTags = 10
+)
+
+func tagObjects(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"-r", "-n"}, Value: []string{"-j"}})
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("missing parameter action. Possible actions are \"get\", \"set\" and \"rm\"")
+	}
+
+	action := args[0]
+	dryRun := isDryRun(s, flags)
+	var labels []string
+	minArgs := 2
+	switch action {
+	case "get":
+		labels, minArgs = []string{"object name"}, 1
+	case "set":
+		labels = []string{"object name", "key=value"}
+	case "rm":
+		// without keys all tags are removed
+		labels, minArgs = []string{"object name", "key"}, 1
+	default:
+		return fmt.Errorf("unknown tag action %q. Possible actions are \"get\", \"set\" and \"rm\"", action)
+	}
+	args = args[1:]
+	if err := checkArgs(s, args, argOptions{ArgLabels: labels, MinArgs: minArgs, VarArgs: action != "get", Mutating: action != "get" && !dryRun}); err != nil {
+		return err
+	}
+
+	var changes map[string]string
+	if action == "set" {
+		if changes, err = parseTagArgs(args[1:]); err != nil {
+			return err
+		}
+	}
+
+	p, err := resolvePath(s, args[0])
+	if err != nil {
+		return err
+	}
+	_, recursive := flags["-r"]
+	prefix, keys, err := selectObjects(s, p, recursive, args[0])
+	if err != nil {
+		return err
+	}
+
+	workers, err := getWorkers(s, flags)
+	if err != nil {
+		return err
+	}
+
+	tasks := make([]task, len(keys))
+	for i := range keys {
+		key := keys[i]
+		tasks[i] = task{Label: key[len(prefix):], Run: func(log func(string, ...interface{})) error {
+			if action == "get" {
+				tags, err := s.Store.GetObjectTags(p.Bucket, key)
+				if err != nil {
+					return err
+				}
+				log("  %s  %s", key[len(prefix):], formatTags(tags))
+				return nil
+			}
+
+			if dryRun {
+				printDryRun(log, "update tags of", key)
+				return nil
+			}
+
+			tags, err := s.Store.GetObjectTags(p.Bucket, key)
+			if err != nil {
+				return err
+			}
+			if action == "set" {
+				for k, v := range changes {
+					tags[k] = v
+				}
+			} else if len(args) == 1 {
+				tags = map[string]string{}
+			} else {
+				for _, k := range args[1:] {
+					delete(tags, k)
+				}
+			}
+			if len(tags) > maxTags {
+				return fmt.Errorf("objects can not have more than %d tags", maxTags)
+			}
+
+			if len(tags) == 0 {
+				err = s.Store.RemoveObjectTags(p.Bucket, key)
+			} else {
+				err = s.Store.SetObjectTags(p.Bucket, key, tags)
+			}
+			if err != nil {
+				return err
+			}
+			log("  %s  %s", key[len(prefix):], formatTags(tags))
+			return nil
+		}}
+	}
+	return runTasks(workers, tasks, nil)
+}
+
+// selectObjects returns the keys of all objects addressed by p, which are the object itself, all objects of a directory if recursive is set, or all objects matching a glob. Also returns the prefix to strip for relative names.
+func selectObjects(s *Session, p remotePath, recursive bool, arg string) (string, []string, error) {
+	isFile, isDir, _, err := stat(s, p.Bucket, p.Key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if isFile {
+		return p.Key[:strings.LastIndex(p.Key, "/")+1], []string{p.Key}, nil
+
+	} else if isDir || hasGlob(p.Key) {
+		if isDir && !recursive {
+			return "", nil, fmt.Errorf("%q is a directory. Please use \"-r\" to include all objects of a directory", arg)
+		}
+
+		prefix, list, err := listSelected(s, p)
+		if err != nil {
+			return "", nil, err
+		}
+		keys := make([]string, 0, len(list))
+		for _, obj := range list {
+			if !strings.HasSuffix(obj.Key, "/") {
+				keys = append(keys, obj.Key)
+			}
+		}
+		return prefix, keys, nil
+
+	} else {
+		return "", nil, fmt.Errorf("Object %q does not exist", arg)
+	}
+}
+
+// parseTagArgs parses "key=value" pairs into a tag set.
+func parseTagArgs(args []string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, arg := range args {
+		pos := strings.Index(arg, "=")
+		if pos <= 0 {
+			return nil, fmt.Errorf("invalid tag %q. Please use \"key=value\"", arg)
+		}
+		tags[arg[:pos]] = arg[pos+1:]
+	}
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("objects can not have more than %d tags", maxTags)
+	}
+	return tags, nil
+}
+
+// matchTags returns true if all filter tags are present. Filters without value match any value.
+func matchTags(tags map[string]string, filter []string) bool {
+	for _, f := range filter {
+		if pos := strings.Index(f, "="); pos >= 0 {
+			if v, ok := tags[f[:pos]]; !ok || v != f[pos+1:] {
+				return false
+			}
+		} else if _, ok := tags[f]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// formatTags returns all tags sorted by key in a single line.
+func formatTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return "no tags"
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + tags[k]
+	}
+	return strings.Join(parts, ", ")
+}
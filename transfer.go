@@ -0,0 +1,469 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go"
+)
+
+const (
+	// multipartThreshold is the file size from which uploads are split into parts that can be resumed.
+	multipartThreshold = 64 * 1024 * 1024
+	multipartPartSize  = 16 * 1024 * 1024
+	// maxParts is the maximum number of parts of a single upload allowed by S3.
+	maxParts = 10000
+)
+
+// uploadCheckpoint records the progress of a multipart upload to continue it after failures.
+type uploadCheckpoint struct {
+	Bucket   string    `json:"bucket"`
+	Key      string    `json:"key"`
+	File     string    `json:"file"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"modTime"`
+	UploadID string    `json:"uploadId"`
+	PartSize int64     `json:"partSize"`
+	// Envelope contains the metadata of client-side encrypted uploads to encrypt the remaining parts with the same data key.
+	Envelope map[string]string    `json:"envelope,omitempty"`
+	Parts    []minio.CompletePart `json:"parts"`
+}
+
+// downloadCheckpoint identifies the object a partial download belongs to.
+type downloadCheckpoint struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+func uploads(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"-n"}, Value: []string{"--older-than"}})
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("missing parameter action. Possible actions are \"list\" and \"abort\"")
+	}
+
+	var olderThan time.Duration
+	if str, ok := flags["--older-than"]; ok {
+		if olderThan, err = parseDuration(str); err != nil {
+			return fmt.Errorf("invalid age %q. Please use a duration like \"12h\" or \"7d\"", str)
+		}
+	}
+
+	action := args[0]
+	args = args[1:]
+	switch action {
+	case "list":
+		if err := checkArgs(s, args, argOptions{ArgLabels: []string{"path"}, MinArgs: 0, RequireBucket: len(args) == 0}); err != nil {
+			return err
+		}
+		p := remotePath{Bucket: s.Bucket, Key: strings.TrimSuffix(s.Prefix, "/")}
+		if len(args) > 0 {
+			if p, err = resolvePath(s, args[0]); err != nil {
+				return err
+			}
+		}
+		return printUploads(s, p, olderThan)
+
+	case "abort":
+		dryRun := isDryRun(s, flags)
+		if err := checkArgs(s, args, argOptions{ArgLabels: []string{"path"}, MinArgs: 1, RequireBucket: false, Mutating: !dryRun}); err != nil {
+			return err
+		}
+		p, err := resolvePath(s, args[0])
+		if err != nil {
+			return err
+		}
+		return abortUploads(s, p, olderThan, dryRun)
+
+	default:
+		return fmt.Errorf("unknown uploads action %q. Possible actions are \"list\" and \"abort\"", action)
+	}
+}
+
+// incompleteUploads returns all incomplete uploads of the key or below the directory in p that have been started at least olderThan ago.
+func incompleteUploads(s *Session, p remotePath, olderThan time.Duration) ([]minio.ObjectMultipartInfo, error) {
+	list, err := s.Store.ListMultipartUploads(p.Bucket, p.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]minio.ObjectMultipartInfo, 0)
+	for _, upload := range list {
+		if upload.Key != p.Key && !strings.HasPrefix(upload.Key, p.Dir()) {
+			continue
+		}
+		if time.Since(upload.Initiated) < olderThan {
+			continue
+		}
+		matches = append(matches, upload)
+	}
+	return matches, nil
+}
+
+func printUploads(s *Session, p remotePath, olderThan time.Duration) error {
+	list, err := incompleteUploads(s, p, olderThan)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		printlnf("No incomplete uploads found.")
+		return nil
+	}
+	if len(list) == 1 {
+		printlnf("Found 1 incomplete upload:")
+	} else {
+		printlnf("Found %d incomplete uploads:", len(list))
+	}
+
+	checkpoints := uploadCheckpoints()
+	for _, upload := range list {
+		resumable := ""
+		if cp, ok := checkpoints[upload.UploadID]; ok {
+			resumable = fmt.Sprintf("  resumable from %q", cp.File)
+		}
+		printlnf("  %s  %s  %s%s%s%s", formatDate(upload.Initiated.Local()), upload.Key, colorPrefix, upload.UploadID, colorEnd, resumable)
+	}
+	return nil
+}
+
+func abortUploads(s *Session, p remotePath, olderThan time.Duration, dryRun bool) error {
+	list, err := incompleteUploads(s, p, olderThan)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		printlnf("No incomplete uploads found.")
+		return nil
+	}
+
+	checkpoints := uploadCheckpoints()
+	for _, upload := range list {
+		if dryRun {
+			printDryRun(printlnf, fmt.Sprintf("abort upload %s of", upload.UploadID), upload.Key)
+			continue
+		}
+		if err := s.Store.AbortMultipartUpload(p.Bucket, upload.Key, upload.UploadID); err != nil {
+			return err
+		}
+		if cp, ok := checkpoints[upload.UploadID]; ok {
+			removeCheckpoint(cp.path)
+		}
+		printlnf("  aborted upload %s of %q", upload.UploadID, upload.Key)
+	}
+
+	if dryRun {
+		return nil
+	}
+	if len(list) == 1 {
+		printlnf("Aborted 1 incomplete upload")
+	} else {
+		printlnf("Aborted %d incomplete uploads", len(list))
+	}
+	return nil
+}
+
+// uploadMultipart uploads a large local file part by part and records every completed part in a checkpoint. With resume an upload started before for the same file and key is continued.
+func uploadMultipart(s *Session, filePath, bucket, key string, opts minio.PutObjectOptions, bar *progressBar, resume bool) (int64, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if len(opts.ContentType) == 0 {
+		if opts.ContentType, err = detectContentType(f); err != nil {
+			return 0, err
+		}
+	}
+
+	cpPath, err := checkpointPath(s, "upload", bucket, key, filePath)
+	if err != nil {
+		return 0, err
+	}
+	var cp uploadCheckpoint
+	found, err := readCheckpoint(cpPath, &cp)
+	if err != nil {
+		return 0, err
+	}
+	encrypted := isClientEncrypted(s, bucket, key)
+	if found && (!resume || cp.Size != fi.Size() || !cp.ModTime.Equal(fi.ModTime()) || encrypted != (len(cp.Envelope) > 0)) {
+		// the previous upload can not be continued and would only cause costs
+		s.Store.AbortMultipartUpload(cp.Bucket, cp.Key, cp.UploadID)
+		found = false
+	}
+	if found {
+		if cp.Parts, err = confirmedParts(s, cp); err != nil {
+			return 0, err
+		}
+		// the upload might have been aborted in the meantime
+		found = cp.Parts != nil
+	}
+
+	if !found {
+		absPath, _ := filepath.Abs(filePath)
+		cp = uploadCheckpoint{Bucket: bucket, Key: key, File: absPath, Size: fi.Size(), ModTime: fi.ModTime(), PartSize: uploadPartSize(fi.Size()), Parts: make([]minio.CompletePart, 0)}
+		if encrypted {
+			if _, cp.Envelope, err = newEnvelope(s); err != nil {
+				return 0, err
+			}
+			addUserMetadata(&opts, cp.Envelope)
+		}
+		addUserMetadata(&opts, map[string]string{metaPartSize: strconv.FormatInt(cp.PartSize, 10)})
+		if cp.UploadID, err = s.Store.NewMultipartUpload(bucket, key, opts); err != nil {
+			return 0, err
+		}
+		if err := writeCheckpoint(cpPath, cp); err != nil {
+			return 0, err
+		}
+	}
+
+	var seal func(r io.Reader, offset int64, last bool) io.Reader
+	if len(cp.Envelope) > 0 {
+		header := make(http.Header)
+		for k, v := range cp.Envelope {
+			header.Set(k, v)
+		}
+		dataKey, err := openEnvelope(s, header)
+		if err != nil {
+			return 0, err
+		}
+		aead, err := newGCM(dataKey)
+		if err != nil {
+			return 0, err
+		}
+		seal = func(r io.Reader, offset int64, last bool) io.Reader {
+			return newEncryptingReader(r, aead, offset, !last)
+		}
+	}
+
+	done := make(map[int]bool)
+	for _, part := range cp.Parts {
+		done[part.PartNumber] = true
+	}
+	partCount := int((fi.Size() + cp.PartSize - 1) / cp.PartSize)
+	for number := 1; number <= partCount; number++ {
+		offset := int64(number-1) * cp.PartSize
+		size := cp.PartSize
+		if offset+size > fi.Size() {
+			size = fi.Size() - offset
+		}
+		if done[number] {
+			bar.Add(size)
+			continue
+		}
+
+		var r io.Reader = io.NewSectionReader(f, offset, size)
+		if bar != nil {
+			r = io.TeeReader(r, bar)
+		}
+		partSize := size
+		if seal != nil {
+			r = seal(r, offset, number == partCount)
+			partSize = encryptedSize(size)
+		}
+		hash := md5.New()
+		r = io.TeeReader(r, hash)
+
+		part, err := s.Store.PutObjectPart(bucket, key, cp.UploadID, number, r, partSize, opts.ServerSideEncryption)
+		if err == nil {
+			err = checkPartETag(part, hash.Sum(nil), opts.ServerSideEncryption)
+		}
+		if err != nil {
+			if len(cpPath) == 0 {
+				// without checkpoint the upload can never be continued
+				s.Store.AbortMultipartUpload(bucket, key, cp.UploadID)
+				return 0, fmt.Errorf("upload of part %d/%d failed: %s", number, partCount, err.Error())
+			}
+			return 0, fmt.Errorf("upload of part %d/%d failed: %s. Use \"ul --resume\" to continue", number, partCount, err.Error())
+		}
+		cp.Parts = append(cp.Parts, minio.CompletePart{PartNumber: number, ETag: part.ETag})
+		if err := writeCheckpoint(cpPath, cp); err != nil {
+			return 0, err
+		}
+	}
+
+	sort.Slice(cp.Parts, func(i, j int) bool { return cp.Parts[i].PartNumber < cp.Parts[j].PartNumber })
+	if err := s.Store.CompleteMultipartUpload(bucket, key, cp.UploadID, cp.Parts); err != nil {
+		// the rejected parts would be rejected again by a resume
+		s.Store.AbortMultipartUpload(bucket, key, cp.UploadID)
+		removeCheckpoint(cpPath)
+		return 0, err
+	}
+	removeCheckpoint(cpPath)
+	return fi.Size(), nil
+}
+
+// uploadPartSize returns the part size of a multipart upload of size bytes.
+func uploadPartSize(size int64) int64 {
+	partSize := int64(multipartPartSize)
+	if min := (size + maxParts - 1) / maxParts; min > partSize {
+		// whole MiB keep the parts aligned to the segments of client-side encryption
+		partSize = (min + 1<<20 - 1) / (1 << 20) * (1 << 20)
+	}
+	return partSize
+}
+
+// confirmedParts returns the parts of the checkpoint that are still present on the server, or nil if the upload does not exist anymore.
+func confirmedParts(s *Session, cp uploadCheckpoint) ([]minio.CompletePart, error) {
+	uploaded, err := s.Store.ListObjectParts(cp.Bucket, cp.Key, cp.UploadID)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchUpload" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	etags := make(map[int]string)
+	for _, part := range uploaded {
+		etags[part.PartNumber] = strings.Trim(part.ETag, "\"")
+	}
+	parts := make([]minio.CompletePart, 0, len(cp.Parts))
+	for _, part := range cp.Parts {
+		if etags[part.PartNumber] == strings.Trim(part.ETag, "\"") {
+			parts = append(parts, part)
+		}
+	}
+	return parts, nil
+}
+
+// resumeOffset returns the plaintext and remote offsets to continue a partial download, or zero if there is none for this version of the object.
+func resumeOffset(cpPath, partPath string, info minio.ObjectInfo) (int64, int64, error) {
+	var cp downloadCheckpoint
+	if found, err := readCheckpoint(cpPath, &cp); err != nil || !found {
+		return 0, 0, err
+	}
+	if cp.ETag != info.ETag || cp.Size != info.Size {
+		return 0, 0, nil
+	}
+	fi, err := os.Stat(partPath)
+	if err != nil {
+		return 0, 0, nil
+	}
+
+	offset := fi.Size()
+	if len(info.Metadata.Get(metaClientCipher)) > 0 {
+		// decryption can only continue at segment boundaries
+		offset = offset / clientSegmentSize * clientSegmentSize
+		if encryptedOffset(offset) > info.Size {
+			return 0, 0, nil
+		}
+		return offset, encryptedOffset(offset), nil
+	}
+	if offset > info.Size {
+		return 0, 0, nil
+	}
+	return offset, offset, nil
+}
+
+// checkpointPath returns the local file that records the progress of a transfer between the object and a local file. It is empty for in-memory sessions, whose transfers can not outlive the process.
+func checkpointPath(s *Session, kind, bucket, key, filePath string) (string, error) {
+	if s.Target.InMemory {
+		return "", nil
+	}
+	configDir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256([]byte(strings.Join([]string{s.Target.Key, bucket, key, absPath}, "\x00")))
+	return path.Join(configDir, "transfers", kind+"-"+hex.EncodeToString(hash[:8])+".json"), nil
+}
+
+// readCheckpoint decodes a checkpoint file into v and returns false if it does not exist. An empty path never has a checkpoint.
+func readCheckpoint(filePath string, v interface{}) (bool, error) {
+	if len(filePath) == 0 {
+		return false, nil
+	}
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		// a damaged checkpoint only means starting over
+		return false, nil
+	}
+	return true, nil
+}
+
+// writeCheckpoint replaces a checkpoint file atomically, so an interruption never leaves a partial checkpoint. Nothing is written for an empty path.
+func writeCheckpoint(filePath string, v interface{}) error {
+	if len(filePath) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(path.Dir(filePath), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filePath+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(filePath+".tmp", filePath)
+}
+
+func removeCheckpoint(filePath string) {
+	if len(filePath) > 0 {
+		os.Remove(filePath)
+	}
+}
+
+// localUploadCheckpoint is an upload checkpoint together with its location.
+type localUploadCheckpoint struct {
+	uploadCheckpoint
+	path string
+}
+
+// uploadCheckpoints returns all local upload checkpoints by upload ID.
+func uploadCheckpoints() map[string]localUploadCheckpoint {
+	checkpoints := make(map[string]localUploadCheckpoint)
+	configDir, err := getConfigDir()
+	if err != nil {
+		return checkpoints
+	}
+	dir := path.Join(configDir, "transfers")
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return checkpoints
+	}
+
+	for _, f := range files {
+		if !strings.HasPrefix(f.Name(), "upload-") || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		var cp uploadCheckpoint
+		if found, _ := readCheckpoint(path.Join(dir, f.Name()), &cp); found {
+			checkpoints[cp.UploadID] = localUploadCheckpoint{cp, path.Join(dir, f.Name())}
+		}
+	}
+	return checkpoints
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/minio/minio-go"
+)
+
+func versioning(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"-n"}})
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("missing parameter action. Possible actions are \"enable\", \"suspend\" and \"status\"")
+	}
+
+	action := args[0]
+	var status string
+	switch action {
+	case "enable":
+		status = "Enabled"
+	case "suspend":
+		status = "Suspended"
+	case "status":
+	default:
+		return fmt.Errorf("unknown versioning action %q. Possible actions are \"enable\", \"suspend\" and \"status\"", action)
+	}
+	dryRun := isDryRun(s, flags)
+	args = args[1:]
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"bucket name"}, MinArgs: 0, RequireBucket: len(args) == 0, Mutating: action != "status" && !dryRun}); err != nil {
+		return err
+	}
+
+	bucket := s.Bucket
+	if len(args) > 0 {
+		bucket = args[0]
+	}
+
+	if action == "status" {
+		current, err := s.Store.GetBucketVersioning(bucket)
+		if err != nil {
+			return err
+		}
+		switch current {
+		case "Enabled":
+			printlnf("Versioning of bucket %q is enabled", bucket)
+		case "Suspended":
+			printlnf("Versioning of bucket %q is suspended. Existing versions are kept, but new writes overwrite the \"null\" version", bucket)
+		default:
+			printlnf("Versioning of bucket %q has never been enabled", bucket)
+		}
+		return nil
+	}
+
+	if dryRun {
+		printDryRun(printlnf, action+" versioning of bucket", bucket)
+		return nil
+	}
+	if err := s.Store.SetBucketVersioning(bucket, status); err != nil {
+		return err
+	}
+	printlnf("Versioning of bucket %q is now %s", bucket, strings.ToLower(status))
+	return nil
+}
+
+// undelete restores an object by removing the delete marker that hides its previous version.
+func undelete(s *Session, args []string) error {
+	args, flags, err := parseFlags(args, flagSet{Bool: []string{"-n"}})
+	if err != nil {
+		return err
+	}
+	dryRun := isDryRun(s, flags)
+	if err := checkArgs(s, args, argOptions{ArgLabels: []string{"object name"}, MinArgs: 1, RequireBucket: false, Mutating: !dryRun}); err != nil {
+		return err
+	}
+
+	p, err := resolvePath(s, args[0])
+	if err != nil {
+		return err
+	}
+
+	versions, err := keyVersions(s, p)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return fmt.Errorf("Object %q has no versions", args[0])
+	}
+	if !versions[0].IsDeleteMarker {
+		return fmt.Errorf("Object %q is not deleted", args[0])
+	}
+
+	if dryRun {
+		printDryRun(printlnf, "remove delete marker of", p.Key)
+		return nil
+	}
+	if err := s.Store.RemoveObjectVersion(p.Bucket, p.Key, versions[0].VersionID); err != nil {
+		return err
+	}
+
+	if len(versions) > 1 && !versions[1].IsDeleteMarker {
+		printlnf("Object %q has been restored to version %s", args[0], versions[1].VersionID)
+	} else {
+		// older delete markers still hide the object
+		printlnf("Delete marker of %q has been removed", args[0])
+	}
+	return nil
+}
+
+// keyVersions returns all versions of exactly the object in p, newest first.
+func keyVersions(s *Session, p remotePath) ([]objectVersion, error) {
+	list, err := s.Store.ListObjectVersions(p.Bucket, p.Key, true)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]objectVersion, 0)
+	for _, v := range list {
+		if v.Key == p.Key {
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}
+
+// printVersions lists all versions and delete markers inside the directory or matching the glob in p.
+func printVersions(s *Session, p remotePath) error {
+	prefix := p.Dir()
+	if hasGlob(p.Key) {
+		prefix = globBase(p.Key)
+	}
+
+	list, err := s.Store.ListObjectVersions(p.Bucket, prefix, hasGlob(p.Key))
+	if err != nil {
+		return err
+	}
+	if hasGlob(p.Key) {
+		pattern := globPattern(p.Key)
+		matches := make([]objectVersion, 0)
+		for _, v := range list {
+			if pattern.MatchString(v.Key) {
+				matches = append(matches, v)
+			}
+		}
+		list = matches
+	}
+
+	if len(list) == 0 {
+		printlnf("No versions found.")
+		return nil
+	}
+	if len(list) == 1 {
+		printlnf("Found 1 entry:")
+	} else {
+		printlnf("Found %d entries:", len(list))
+	}
+
+	for _, v := range list {
+		name := v.Key[len(prefix):]
+		if len(v.VersionID) == 0 {
+			printlnf("  D  %s%s", strings.Repeat(" ", 27), name[:len(name)-1])
+			continue
+		}
+
+		latest := ""
+		if v.IsLatest {
+			latest = fmt.Sprintf("  %slatest%s", colorHighlight, colorEnd)
+		}
+		if v.IsDeleteMarker {
+			printlnf("  X  %11s  %s  %s  %s%s%s  delete marker%s", "-", formatDate(v.LastModified.Local()), name, colorPrefix, v.VersionID, colorEnd, latest)
+		} else {
+			sizeStr := humanize.IBytes(uint64(v.Size))
+			if strings.HasSuffix(sizeStr, " B") {
+				sizeStr = sizeStr + "  "
+			}
+			printlnf("  F  %11s  %s  %s  %s%s%s%s", sizeStr, formatDate(v.LastModified.Local()), name, colorPrefix, v.VersionID, colorEnd, latest)
+		}
+	}
+	return nil
+}
+
+// downloadVersion writes a specific version of an object to a local file.
+func downloadVersion(s *Session, p remotePath, versionID, filePath string, opts minio.GetObjectOptions) error {
+	printlnf("Source Object: %s (version %s)", p.Key, versionID)
+
+	obj, info, err := s.Store.GetObjectVersion(p.Bucket, p.Key, versionID, opts)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	bar := newProgressBar(p.Key, info.Size)
+	var r io.Reader = io.TeeReader(obj, bar)
+	verifier := newContentVerifier(info)
+	if verifier != nil {
+		r = io.TeeReader(r, verifier)
+	}
+	if r, _, err = decryptObject(s, info, r); err != nil {
+		bar.Clear()
+		return err
+	}
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		bar.Clear()
+		return err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, r)
+	bar.Finish()
+	if err != nil {
+		return err
+	}
+	if verifier != nil {
+		if _, err := verifier.Check(); err != nil {
+			return fmt.Errorf("download of %q is corrupted: %s", p.Key, err.Error())
+		}
+	}
+
+	printlnf("Completed: %s", humanize.IBytes(uint64(n)))
+	return nil
+}
+
+// removeVersion permanently deletes a single version or delete marker of an object.
+func removeVersion(s *Session, p remotePath, versionID string, dryRun bool) error {
+	if dryRun {
+		printDryRun(printlnf, fmt.Sprintf("permanently delete version %s of", versionID), p.Key)
+		return nil
+	}
+
+	if err := s.Store.RemoveObjectVersion(p.Bucket, p.Key, versionID); err != nil {
+		return err
+	}
+	printlnf("Version %s of %q has been permanently deleted", versionID, p.Key)
+	return nil
+}
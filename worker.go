@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	// defaultWorkers is used for bulk operations when neither "-j" nor the environment specify a worker count.
+	defaultWorkers = 1
+)
+
+// task is a single unit of work of a bulk operation. Output must be written using the given log function to keep it in order.
+type task struct {
+	Label string
+	Run   func(log func(format string, args ...interface{})) error
+}
+
+type taskResult struct {
+	lines []string
+	err   error
+}
+
+// errTasksFailed is returned by runTasks when at least one task failed.
+type errTasksFailed struct {
+	total  int
+	failed []error
+}
+
+func (e errTasksFailed) Error() string {
+	if e.total == 1 {
+		return e.failed[0].Error()
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%d of %d operations failed:", len(e.failed), e.total))
+	for _, err := range e.failed {
+		sb.WriteString("\n  ")
+		sb.WriteString(err.Error())
+	}
+	return sb.String()
+}
+
+// runTasks executes all tasks with the given number of concurrent workers. The output of every task is printed as a whole and in the order of the tasks, regardless of when it completes. Failing tasks do not stop the remaining ones, all errors are returned together.
+func runTasks(workers int, tasks []task, bar *progressBar) error {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(tasks) {
+		workers = len(tasks)
+	}
+
+	results := make([]*taskResult, len(tasks))
+	finished := make([]chan struct{}, len(tasks))
+	for i := range finished {
+		finished[i] = make(chan struct{})
+	}
+
+	taskCh := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range taskCh {
+				result := &taskResult{lines: make([]string, 0)}
+				result.err = tasks[i].Run(func(format string, args ...interface{}) {
+					result.lines = append(result.lines, fmt.Sprintf(format, args...))
+				})
+				results[i] = result
+				close(finished[i])
+			}
+		}()
+	}
+
+	go func() {
+		for i := range tasks {
+			taskCh <- i
+		}
+		close(taskCh)
+	}()
+
+	// print the output in order while later tasks might still be running
+	failed := make([]error, 0)
+	for i := range tasks {
+		<-finished[i]
+		for _, line := range results[i].lines {
+			bar.Printlnf("%s", line)
+		}
+		if results[i].err != nil {
+			bar.Printlnf("  %sfailed%s %s: %s", colorWarning, colorEnd, tasks[i].Label, results[i].err.Error())
+			failed = append(failed, fmt.Errorf("%s: %s", tasks[i].Label, results[i].err.Error()))
+		}
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return errTasksFailed{len(tasks), failed}
+	}
+	return nil
+}
+
+// getWorkers returns the worker count for bulk operations from the "-j" flag or the environment default.
+func getWorkers(s *Session, flags map[string]string) (int, error) {
+	if str, ok := flags["-j"]; ok {
+		var workers int
+		if _, err := fmt.Sscanf(str, "%d", &workers); err != nil || workers < 1 {
+			return 0, fmt.Errorf("invalid worker count %q", str)
+		}
+		return workers, nil
+	}
+	if s.Target.Workers > 0 {
+		return s.Target.Workers, nil
+	}
+	return defaultWorkers, nil
+}